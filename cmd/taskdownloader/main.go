@@ -2,6 +2,9 @@ package main
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
 	"os"
@@ -10,11 +13,30 @@ import (
 	"time"
 
 	"github.com/LashkaPashka/TaskDownloader/internal/config"
+	appendfiles "github.com/LashkaPashka/TaskDownloader/internal/http-server/handlers/appendFiles"
+	canceltask "github.com/LashkaPashka/TaskDownloader/internal/http-server/handlers/cancelTask"
+	getarchive "github.com/LashkaPashka/TaskDownloader/internal/http-server/handlers/getArchive"
+	getbandwidth "github.com/LashkaPashka/TaskDownloader/internal/http-server/handlers/getBandwidth"
+	getdeadletters "github.com/LashkaPashka/TaskDownloader/internal/http-server/handlers/getDeadLetters"
+	getfilecontent "github.com/LashkaPashka/TaskDownloader/internal/http-server/handlers/getFileContent"
 	gettask "github.com/LashkaPashka/TaskDownloader/internal/http-server/handlers/getTask"
+	pausetask "github.com/LashkaPashka/TaskDownloader/internal/http-server/handlers/pauseTask"
+	replaydeadletter "github.com/LashkaPashka/TaskDownloader/internal/http-server/handlers/replayDeadLetter"
+	resumetask "github.com/LashkaPashka/TaskDownloader/internal/http-server/handlers/resumeTask"
+	retrytask "github.com/LashkaPashka/TaskDownloader/internal/http-server/handlers/retryTask"
 	savelisturls "github.com/LashkaPashka/TaskDownloader/internal/http-server/handlers/saveListUrls"
+	setbandwidth "github.com/LashkaPashka/TaskDownloader/internal/http-server/handlers/setBandwidth"
+	streamevents "github.com/LashkaPashka/TaskDownloader/internal/http-server/handlers/streamEvents"
+	tasksocket "github.com/LashkaPashka/TaskDownloader/internal/http-server/handlers/taskSocket"
+	"github.com/LashkaPashka/TaskDownloader/internal/lib/deadletter"
 	eventbus "github.com/LashkaPashka/TaskDownloader/internal/lib/eventBus"
+	"github.com/LashkaPashka/TaskDownloader/internal/lib/eventlog"
+	"github.com/LashkaPashka/TaskDownloader/internal/lib/retry"
+	"github.com/LashkaPashka/TaskDownloader/internal/lib/webhook"
 	"github.com/LashkaPashka/TaskDownloader/internal/service"
+	"github.com/LashkaPashka/TaskDownloader/internal/storage/cache"
 	storage "github.com/LashkaPashka/TaskDownloader/internal/storage/json"
+	"github.com/LashkaPashka/TaskDownloader/internal/storage/sqlite"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 )
@@ -25,6 +47,15 @@ const (
 	envProd = "prod"
 )
 
+const (
+	storageJSON = "json"
+	storageSQLite = "sqlite"
+)
+const (
+	transportMemory = "memory"
+	transportNATS = "nats"
+)
+
 func main() {
 	// TODO: init config
 	cfg := config.MustLoad()
@@ -47,17 +78,61 @@ func main() {
 	router.Use(middleware.URLFormat)
 
 	// TODO: Init storage
-	storage, err := storage.New(cfg.StoragePath, logger)
+	storage, err := setupStorage(cfg, logger)
 	if err != nil {
-		logger.Error("Error init storage")
+		logger.Error("Error init storage", slog.String("driver", cfg.StorageDriver), slog.String("err", err.Error()))
 		return
 	}
+	// deferred before the cache, it is closed after the cache has flushed into it
+	if closer, ok := storage.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	if cfg.StorageCache.Enabled {
+		cached := cache.New(storage, cfg.StorageCache.FlushInterval, logger)
+		defer cached.Close()
+
+		storage = cached
+	}
 
 	// TODO: Init eventBus
-	eventbus := eventbus.NewEventBus()
+	eventbus, outbox, err := setupEventBus(cfg, logger)
+	if err != nil {
+		logger.Error("Error init event bus", slog.String("transport", cfg.EventBus.Transport), slog.String("err", err.Error()))
+		return
+	}
+	defer eventbus.Close()
+	if outbox != nil {
+		defer outbox.Close()
+	}
+
+	deadLetters, err := deadletter.Open(cfg.EventBus.DeadLetterPath)
+	if err != nil {
+		logger.Error("Error open dead-letter queue", slog.String("path", cfg.EventBus.DeadLetterPath), slog.String("err", err.Error()))
+		return
+	}
+
+	webhookLog, err := webhook.OpenLog(cfg.Webhooks.LogPath)
+	if err != nil {
+		logger.Error("Error open webhook log", slog.String("path", cfg.Webhooks.LogPath), slog.String("err", err.Error()))
+		return
+	}
+
+	webhooks := webhook.NewDispatcher(
+		webhookLog,
+		cfg.Webhooks.Secrets,
+		retry.Policy{MaxAttempts: cfg.Webhooks.MaxAttempts, BaseBackoff: cfg.Webhooks.BaseBackoff, MaxBackoff: cfg.Webhooks.MaxBackoff, Jitter: 0.2},
+		cfg.Webhooks.Timeout,
+		cfg.Webhooks.Senders,
+		logger,
+	)
+
+	webhooksCtx, stopWebhooks := context.WithCancel(context.Background())
+	defer stopWebhooks()
+	go webhooks.Run(webhooksCtx)
 
 	// TODO: Init storage
-	service, err := service.New(storage, cfg.LocalPathStoage, eventbus, logger)
+	service, err := service.New(storage, cfg.LocalPathStoage, cfg.Downloader, eventbus, outbox, deadLetters, webhooks, logger)
 	if err != nil {
 		logger.Error("Error init service")
 		return
@@ -66,14 +141,41 @@ func main() {
 	router.Route("/tasks", func(r chi.Router) {
 		r.Post("/", savelisturls.New(service, logger))
 		r.Get("/", gettask.New(service, logger))
+		r.Delete("/{id}", canceltask.New(service, logger))
+		r.Post("/{id}/cancel", canceltask.New(service, logger))
+		r.Post("/{id}/pause", pausetask.New(service, logger))
+		r.Post("/{id}/resume", resumetask.New(service, logger))
+		r.Post("/{id}/retry", retrytask.New(service, logger))
+		r.Post("/{id}/files", appendfiles.New(service, logger))
+		r.Get("/{id}/files/{index}/content", getfilecontent.New(service, logger))
+		r.Get("/{id}/archive", getarchive.New(service, logger))
+		r.Get("/{id}/events", streamevents.New(service, logger))
+		r.Post("/{id}/files/{index}/pause", pausetask.New(service, logger))
+		r.Post("/{id}/files/{index}/resume", resumetask.New(service, logger))
 	})
 
-	go service.CompleteTask()
+	router.Get("/ws", tasksocket.New(service, logger))
 
-	err = service.SearchQueuedAndComplete()
-	if err != nil {
-		logger.Error("Invalid searchQueuedAndComplete", slog.String("error", err.Error()))
-		return
+	router.Route("/clients", func(r chi.Router) {
+		r.Get("/{client_id}/events", streamevents.New(service, logger))
+	})
+
+	router.Route("/admin", func(r chi.Router) {
+		r.Get("/bandwidth", getbandwidth.New(service, logger))
+		r.Put("/bandwidth", setbandwidth.New(service, logger))
+		r.Get("/dead-letters", getdeadletters.New(service, logger))
+		r.Get("/dead-letters/{id}", getdeadletters.New(service, logger))
+		r.Post("/dead-letters/{id}/replay", replaydeadletter.New(service, logger))
+	})
+
+	if !cfg.Downloader.Disabled {
+		go service.CompleteTask()
+
+		err = service.SearchQueuedAndComplete()
+		if err != nil {
+			logger.Error("Invalid searchQueuedAndComplete", slog.String("error", err.Error()))
+			return
+		}
 	}
 
 	logger.Info("starting server", slog.String("address", cfg.Address))
@@ -88,6 +190,8 @@ func main() {
 		WriteTimeout: cfg.HTTPServer.Timeout,
 		IdleTimeout: cfg.HTTPServer.IdleTimeout,
 	}
+	// event streams never end by themselves, close them for the shutdown to finish
+	srv.RegisterOnShutdown(service.CloseEvents)
 
 	go func() {
 		if err := srv.ListenAndServe(); err != nil {
@@ -112,6 +216,69 @@ func main() {
 }	
 
 
+func setupStorage(cfg *config.Config, logger *slog.Logger) (service.Storage, error) {
+	// the processes of a split deployment share the storage: the json store locks within one process only
+	// and the cache never sees the writes of the other processes
+	if cfg.EventBus.Transport == transportNATS || cfg.Downloader.Disabled {
+		if cfg.StorageDriver != storageSQLite {
+			return nil, fmt.Errorf("storage driver %s cannot be shared between processes, use %s", cfg.StorageDriver, storageSQLite)
+		}
+		if cfg.StorageCache.Enabled {
+			return nil, errors.New("storage cache cannot be used by processes sharing the storage")
+		}
+	}
+
+	switch cfg.StorageDriver {
+	case storageSQLite:
+		return sqlite.New(cfg.StoragePath, logger)
+	case storageJSON:
+		return storage.New(cfg.StoragePath, logger)
+	}
+
+	return nil, fmt.Errorf("unknown storage driver: %s", cfg.StorageDriver)
+}
+
+// setupEventBus returns the bus and the outbox of its events. Only the bus of one process needs the outbox,
+// a NATS stream keeps the events itself until the downloader acknowledges them.
+func setupEventBus(cfg *config.Config, logger *slog.Logger) (eventbus.EventBus, *eventlog.Log, error) {
+	defaults := eventbus.Options{Buffer: cfg.EventBus.Buffer, Overflow: eventbus.Overflow(cfg.EventBus.Overflow)}
+
+	switch cfg.EventBus.Transport {
+	case transportMemory:
+		if cfg.Downloader.Disabled {
+			return nil, nil, fmt.Errorf("event bus transport %s needs the downloader in the same process", transportMemory)
+		}
+
+		bus, err := eventbus.NewLocal(defaults)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		outbox, err := eventlog.Open(cfg.EventBus.LogDir)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		return bus, outbox, nil
+	case transportNATS:
+		bus, err := eventbus.NewNATS(eventbus.NATSConfig{
+			URL: cfg.EventBus.NATS.URL,
+			Stream: cfg.EventBus.NATS.Stream,
+			Subject: cfg.EventBus.NATS.Subject,
+			MaxAge: cfg.EventBus.NATS.MaxAge,
+			Timeout: cfg.EventBus.NATS.Timeout,
+			AckWait: cfg.EventBus.NATS.AckWait,
+		}, defaults, logger)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		return bus, nil, nil
+	}
+
+	return nil, nil, fmt.Errorf("unknown event bus transport: %s", cfg.EventBus.Transport)
+}
+
 func setupLogger(env string) *slog.Logger {
 	var log *slog.Logger
 
@@ -12,8 +12,13 @@ import (
 type Config struct {
 	Env string `yaml:"env" env-default:"local"`
 	StoragePath string `yaml:"storage_path" env-default:"NOT"`
+	StorageDriver string `yaml:"storage_driver" env-default:"json"`
 	LocalPathStoage string `yaml:"local_path_storage"`
 	HTTPServer `yaml:"http_server"`
+	StorageCache `yaml:"storage_cache"`
+	Downloader `yaml:"downloader"`
+	Webhooks `yaml:"webhooks"`
+	EventBus `yaml:"event_bus"`
 }
 
 type HTTPServer struct {
@@ -22,6 +27,90 @@ type HTTPServer struct {
 	IdleTimeout time.Duration `yaml:"idle_timeout" env-default:"60s"`
 }
 
+type StorageCache struct {
+	// Enabled absorbs the progress saved for every chunk, without it each one is a write of the storage.
+	// It is for a single process only, the writes of other processes sharing the storage are not seen
+	Enabled bool `yaml:"enabled" env-default:"false"`
+	FlushInterval time.Duration `yaml:"flush_interval" env-default:"2s"`
+}
+
+type Downloader struct {
+	// Disabled leaves the downloader out of this process, the node only accepts the tasks.
+	// With the nats transport only one node may run the downloader: at start it requeues the files
+	// in progress of every node sharing the storage
+	Disabled bool `yaml:"disabled" env-default:"false"`
+	Workers int `yaml:"workers" env-default:"8"`
+	MaxFilesPerTask int `yaml:"max_files_per_task" env-default:"4"`
+	Segments int `yaml:"segments" env-default:"4"`
+	MinSegmentSize int64 `yaml:"min_segment_size" env-default:"8388608"`
+	Retry `yaml:"retry"`
+	Hosts `yaml:"hosts"`
+	Bandwidth `yaml:"bandwidth"`
+}
+
+type Bandwidth struct {
+	GlobalBytesPerSec int64 `yaml:"global_bytes_per_sec" env-default:"0"`
+	Clients map[string]int64 `yaml:"clients"`
+}
+
+type Hosts struct {
+	MaxConnections int `yaml:"max_connections" env-default:"4"`
+	MinDelay time.Duration `yaml:"min_delay" env-default:"0s"`
+	Overrides map[string]HostLimit `yaml:"overrides"`
+}
+
+type HostLimit struct {
+	MaxConnections int `yaml:"max_connections"`
+	MinDelay time.Duration `yaml:"min_delay"`
+}
+
+type Webhooks struct {
+	// LogPath keeps the deliveries, pending ones are sent after a restart
+	LogPath string `yaml:"log_path" env-default:"./tasks/webhooks.json"`
+	Timeout time.Duration `yaml:"timeout" env-default:"10s"`
+	MaxAttempts int `yaml:"max_attempts" env-default:"10"`
+	BaseBackoff time.Duration `yaml:"base_backoff" env-default:"5s"`
+	MaxBackoff time.Duration `yaml:"max_backoff" env-default:"10m"`
+	// Senders is how many callback urls are sent to at the same time, the webhooks of one url go one by one
+	Senders int `yaml:"senders" env-default:"8"`
+	// Secrets signs the webhooks of a client, tasks with a callback_url are accepted only for clients listed here
+	Secrets map[string]string `yaml:"secrets"`
+}
+
+type EventBus struct {
+	// Buffer is the queue size of every subscriber
+	Buffer int `yaml:"buffer" env-default:"256"`
+	// Overflow is what happens to an event for a full queue: block, drop_oldest or drop_newest.
+	// The downloader always blocks, it must not lose tasks
+	Overflow string `yaml:"overflow" env-default:"block"`
+	// LogDir keeps the events of the downloader until they are handled, they are delivered again after a restart.
+	// It is used by the memory transport only
+	LogDir string `yaml:"log_dir" env-default:"./tasks/events"`
+	// DeadLetterPath keeps the events the downloader failed to handle until they are replayed
+	DeadLetterPath string `yaml:"dead_letter_path" env-default:"./tasks/dead_letters.json"`
+	// Transport is memory for a single process or nats to share the events between processes
+	Transport string `yaml:"transport" env-default:"memory"`
+	NATS `yaml:"nats"`
+}
+
+type NATS struct {
+	URL string `yaml:"url" env-default:"nats://127.0.0.1:4222"`
+	Stream string `yaml:"stream" env-default:"TASKDOWNLOADER"`
+	Subject string `yaml:"subject" env-default:"taskdownloader"`
+	// MaxAge is how long an event is kept in the stream
+	MaxAge time.Duration `yaml:"max_age" env-default:"168h"`
+	Timeout time.Duration `yaml:"timeout" env-default:"5s"`
+	// AckWait is how long the stream waits for the downloader to handle an event before it delivers the event again
+	AckWait time.Duration `yaml:"ack_wait" env-default:"1m"`
+}
+
+type Retry struct {
+	MaxAttempts int `yaml:"max_attempts" env-default:"5"`
+	BaseBackoff time.Duration `yaml:"base_backoff" env-default:"1s"`
+	MaxBackoff time.Duration `yaml:"max_backoff" env-default:"1m"`
+	Jitter float64 `yaml:"jitter" env-default:"0.2"`
+}
+
 func MustLoad() *Config {
 	const op = "TaskDownloader.internal.configs.Mustload"
 	
@@ -0,0 +1,59 @@
+package appendfiles
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/LashkaPashka/TaskDownloader/internal/lib/req"
+	"github.com/LashkaPashka/TaskDownloader/internal/payload"
+	"github.com/LashkaPashka/TaskDownloader/internal/service"
+	"github.com/go-chi/chi/v5"
+)
+
+type Service interface {
+	AppendFiles(taskID string, body payload.AppendFilesRequest) ([]int, error)
+}
+
+func New(serv Service, logger *slog.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "TaskDownloader.handlers.appendFiles"
+
+		taskID := chi.URLParam(r, "id")
+
+		body, err := req.HandleBody[payload.AppendFilesRequest](w, r, logger)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		indexes, err := serv.AppendFiles(taskID, body)
+		if err != nil {
+			logger.Error("Failed to append files",
+				slog.String("op", op),
+				slog.String("task_id", taskID),
+				slog.String("err", err.Error()),
+			)
+
+			switch {
+			case errors.Is(err, service.ErrTaskNotFound):
+				w.WriteHeader(http.StatusNotFound)
+			case errors.Is(err, service.ErrTaskCancelled):
+				w.WriteHeader(http.StatusConflict)
+			case errors.Is(err, service.ErrEventNotSent):
+				w.WriteHeader(http.StatusServiceUnavailable)
+			default:
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+			return
+		}
+
+		w.Header().Set("Content-type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(&payload.AppendFilesResponse{
+			TaskID: taskID,
+			Indexes: indexes,
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package canceltask
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/LashkaPashka/TaskDownloader/internal/service"
+	"github.com/go-chi/chi/v5"
+)
+
+type Service interface {
+	CancelTask(taskID string, purge bool) error
+}
+
+func New(serv Service, logger *slog.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "TaskDownloader.handlers.cancelTask"
+
+		taskID := chi.URLParam(r, "id")
+
+		purge := false
+		if value := r.URL.Query().Get("purge"); value != "" {
+			var err error
+			if purge, err = strconv.ParseBool(value); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+		}
+
+		if err := serv.CancelTask(taskID, purge); err != nil {
+			logger.Error("Failed to cancel task",
+				slog.String("op", op),
+				slog.String("task_id", taskID),
+				slog.String("err", err.Error()),
+			)
+
+			switch {
+			case errors.Is(err, service.ErrTaskNotFound):
+				w.WriteHeader(http.StatusNotFound)
+			case errors.Is(err, service.ErrTaskFinished):
+				w.WriteHeader(http.StatusConflict)
+			default:
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,90 @@
+package getarchive
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/LashkaPashka/TaskDownloader/internal/lib/archive"
+	"github.com/LashkaPashka/TaskDownloader/internal/models"
+	"github.com/LashkaPashka/TaskDownloader/internal/service"
+	"github.com/go-chi/chi/v5"
+)
+
+type Service interface {
+	ArchiveTask(taskID string) (models.Task, error)
+	WriteArchive(ctx context.Context, w io.Writer, task models.Task, format string, manifest bool) error
+}
+
+// New streams the done files of the task as format=zip (default) or format=tar.gz,
+// manifest=true adds a manifest.json. The size is not known upfront, the response is chunked.
+func New(serv Service, logger *slog.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "TaskDownloader.handlers.getArchive"
+
+		taskID := chi.URLParam(r, "id")
+
+		format := r.URL.Query().Get("format")
+		if format == "" {
+			format = archive.FormatZip
+		}
+		if format != archive.FormatZip && format != archive.FormatTarGz {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		manifest := false
+		if value := r.URL.Query().Get("manifest"); value != "" {
+			var err error
+			if manifest, err = strconv.ParseBool(value); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+		}
+
+		task, err := serv.ArchiveTask(taskID)
+		if err != nil {
+			logger.Error("Failed to archive task",
+				slog.String("op", op),
+				slog.String("task_id", taskID),
+				slog.String("err", err.Error()),
+			)
+
+			switch {
+			case errors.Is(err, service.ErrTaskNotFound):
+				w.WriteHeader(http.StatusNotFound)
+			case errors.Is(err, service.ErrFileNotReady):
+				w.WriteHeader(http.StatusConflict)
+			default:
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+			return
+		}
+
+		// the archive takes longer than the write timeout of the server
+		if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+			logger.Debug("Write deadline is not supported",
+				slog.String("op", op),
+				slog.String("err", err.Error()),
+			)
+		}
+
+		w.Header().Set("Content-Type", archive.ContentType(format))
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": task.ID + "." + format}))
+		w.WriteHeader(http.StatusOK)
+
+		// the status is sent already, a failure can only cut the archive short
+		if err := serv.WriteArchive(r.Context(), w, task, format, manifest); err != nil {
+			logger.Error("Failed to write archive",
+				slog.String("op", op),
+				slog.String("task_id", taskID),
+				slog.String("err", err.Error()),
+			)
+		}
+	}
+}
@@ -0,0 +1,23 @@
+package getbandwidth
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/LashkaPashka/TaskDownloader/internal/payload"
+)
+
+type Service interface {
+	Bandwidth() payload.BandwidthResponse
+}
+
+func New(service Service, logger *slog.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		limits := service.Bandwidth()
+
+		w.Header().Set("Content-type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(&limits)
+	}
+}
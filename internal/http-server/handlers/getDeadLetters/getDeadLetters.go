@@ -0,0 +1,54 @@
+package getdeadletters
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/LashkaPashka/TaskDownloader/internal/payload"
+	"github.com/LashkaPashka/TaskDownloader/internal/service"
+	"github.com/go-chi/chi/v5"
+)
+
+type Service interface {
+	DeadLetters() payload.DeadLettersResponse
+	DeadLetter(id string) (payload.DeadLetterResponse, error)
+}
+
+// New returns the dead-letter queue, newest first, or a single letter when the route has an id.
+func New(serv Service, logger *slog.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "TaskDownloader.handlers.getDeadLetters"
+
+		id := chi.URLParam(r, "id")
+		if id == "" {
+			letters := serv.DeadLetters()
+
+			w.Header().Set("Content-type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			json.NewEncoder(w).Encode(&letters)
+			return
+		}
+
+		letter, err := serv.DeadLetter(id)
+		if err != nil {
+			logger.Error("Failed to get dead letter",
+				slog.String("op", op),
+				slog.String("id", id),
+				slog.String("err", err.Error()),
+			)
+
+			if errors.Is(err, service.ErrDeadLetterNotFound) {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(&letter)
+	}
+}
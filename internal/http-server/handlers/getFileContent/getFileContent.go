@@ -0,0 +1,84 @@
+package getfilecontent
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"mime"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/LashkaPashka/TaskDownloader/internal/models"
+	"github.com/LashkaPashka/TaskDownloader/internal/service"
+	"github.com/go-chi/chi/v5"
+)
+
+type Service interface {
+	OpenFile(taskID string, index int) (*os.File, models.File, error)
+}
+
+// New streams a downloaded file. Range, If-Range and the conditional headers are handled by http.ServeContent.
+func New(serv Service, logger *slog.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "TaskDownloader.handlers.getFileContent"
+
+		taskID := chi.URLParam(r, "id")
+
+		index, err := strconv.Atoi(chi.URLParam(r, "index"))
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		f, file, err := serv.OpenFile(taskID, index)
+		if err != nil {
+			logger.Error("Failed to open file",
+				slog.String("op", op),
+				slog.String("task_id", taskID),
+				slog.Int("index", index),
+				slog.String("err", err.Error()),
+			)
+
+			switch {
+			case errors.Is(err, service.ErrTaskNotFound), errors.Is(err, service.ErrFileNotFound):
+				w.WriteHeader(http.StatusNotFound)
+			case errors.Is(err, service.ErrFileNotReady):
+				w.WriteHeader(http.StatusConflict)
+			default:
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+			return
+		}
+		defer f.Close()
+
+		info, err := f.Stat()
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		// large files take longer than the write timeout of the server
+		if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+			logger.Debug("Write deadline is not supported",
+				slog.String("op", op),
+				slog.String("err", err.Error()),
+			)
+		}
+
+		w.Header().Set("ETag", etag(file, info))
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": file.Filename}))
+
+		http.ServeContent(w, r, file.Filename, info.ModTime(), f)
+	}
+}
+
+// etag is the digest of the file when it is known, otherwise it changes with the size and the modification time.
+func etag(file models.File, info os.FileInfo) string {
+	if file.Checksum != "" {
+		return fmt.Sprintf(`"%s-%s"`, file.ChecksumAlgo, file.Checksum)
+	}
+
+	return fmt.Sprintf(`"%x-%x"`, info.Size(), info.ModTime().UnixNano())
+}
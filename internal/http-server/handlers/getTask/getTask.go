@@ -2,20 +2,31 @@ package gettask
 
 import (
 	"encoding/json"
+	"errors"
 	"log/slog"
 	"net/http"
+	"strconv"
+	"time"
 
+	"github.com/LashkaPashka/TaskDownloader/internal/lib/pagination"
 	"github.com/LashkaPashka/TaskDownloader/internal/models"
 	"github.com/LashkaPashka/TaskDownloader/internal/payload"
 )
 
 type Service interface {
 	GetTaskByID(taskID string) (models.Task, error)
+	ListTasks(filter models.TaskFilter) (models.TaskPage, error)
+	TaskStatus(task models.Task) payload.GetStatusOfTaskResponse
 }
 
+// New returns the task of the task_id query parameter, without it the tasks matching the filter parameters.
 func New(service Service, logger *slog.Logger) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		taskID := r.URL.Query().Get("task_id")
+		if taskID == "" {
+			listTasks(w, r, service, logger)
+			return
+		}
 
 		task, err := service.GetTaskByID(taskID)
 		if err != nil {
@@ -25,23 +36,81 @@ func New(service Service, logger *slog.Logger) http.HandlerFunc {
 
 		w.WriteHeader(http.StatusOK)
 		w.Header().Set("Content-type", "application/json")
-		json.NewEncoder(w).Encode(&payload.GetStatusOfTaskResponse{
-			ClientID: task.ClientID,
-			TaskID: task.ID,
-			Files: getFileResponse(task),
-			Status: task.Status,
-		})
+		resp := service.TaskStatus(task)
+		json.NewEncoder(w).Encode(&resp)
+	}
+}
+
+func listTasks(w http.ResponseWriter, r *http.Request, service Service, logger *slog.Logger) {
+	const op = "TaskDownloader.handlers.getTask.listTasks"
+
+	filter, err := parseFilter(r)
+	if err != nil {
+		logger.Error("Invalid list parameters",
+			slog.String("op", op),
+			slog.String("err", err.Error()),
+		)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	page, err := service.ListTasks(filter)
+	if err != nil {
+		if errors.Is(err, pagination.ErrInvalidCursor) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		return
 	}
+
+	resp := payload.ListTasksResponse{
+		Tasks: make([]payload.GetStatusOfTaskResponse, 0, len(page.Tasks)),
+		NextCursor: page.NextCursor,
+	}
+	for _, task := range page.Tasks {
+		resp.Tasks = append(resp.Tasks, service.TaskStatus(task))
+	}
+
+	w.Header().Set("Content-type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(&resp)
 }
 
-func getFileResponse(task models.Task) (fileResponse []payload.StatusOfFileResponse) {
-	for _, file := range task.File {
-		fileResponse = append(fileResponse, payload.StatusOfFileResponse{
-			Filename: file.Filename,
-			Status: file.Status,
-			DownloadedBytes: file.DownloadedBytes,
-		})
-	}
-	
-	return fileResponse
-}
\ No newline at end of file
+func parseFilter(r *http.Request) (models.TaskFilter, error) {
+	query := r.URL.Query()
+
+	filter := models.TaskFilter{
+		ClientID: query.Get("client_id"),
+		Status: query.Get("status"),
+		URL: query.Get("url"),
+		Cursor: query.Get("cursor"),
+	}
+
+	var err error
+	if value := query.Get("created_from"); value != "" {
+		if filter.CreatedFrom, err = time.Parse(time.RFC3339, value); err != nil {
+			return filter, err
+		}
+	}
+	if value := query.Get("created_to"); value != "" {
+		if filter.CreatedTo, err = time.Parse(time.RFC3339, value); err != nil {
+			return filter, err
+		}
+	}
+	if value := query.Get("limit"); value != "" {
+		if filter.Limit, err = strconv.Atoi(value); err != nil {
+			return filter, err
+		}
+	}
+
+	switch order := query.Get("order"); order {
+	case "", "desc":
+	case "asc":
+		filter.Ascending = true
+	default:
+		return filter, errors.New("order must be asc or desc, got " + order)
+	}
+
+	return filter, nil
+}
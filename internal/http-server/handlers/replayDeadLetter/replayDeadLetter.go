@@ -0,0 +1,45 @@
+package replaydeadletter
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/LashkaPashka/TaskDownloader/internal/service"
+	"github.com/go-chi/chi/v5"
+)
+
+type Service interface {
+	ReplayDeadLetter(id string) error
+}
+
+// New queues the event of the dead letter again.
+func New(serv Service, logger *slog.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "TaskDownloader.handlers.replayDeadLetter"
+
+		id := chi.URLParam(r, "id")
+
+		if err := serv.ReplayDeadLetter(id); err != nil {
+			logger.Error("Failed to replay dead letter",
+				slog.String("op", op),
+				slog.String("id", id),
+				slog.String("err", err.Error()),
+			)
+
+			switch {
+			case errors.Is(err, service.ErrDeadLetterNotFound):
+				w.WriteHeader(http.StatusNotFound)
+			case errors.Is(err, service.ErrMalformedEvent):
+				w.WriteHeader(http.StatusUnprocessableEntity)
+			case errors.Is(err, service.ErrEventNotSent):
+				w.WriteHeader(http.StatusServiceUnavailable)
+			default:
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+			return
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
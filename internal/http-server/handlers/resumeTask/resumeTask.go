@@ -0,0 +1,57 @@
+package resumetask
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/LashkaPashka/TaskDownloader/internal/service"
+	"github.com/go-chi/chi/v5"
+)
+
+type Service interface {
+	ResumeTask(taskID string) error
+	ResumeFile(taskID string, index int) error
+}
+
+// New resumes the whole task, or a single file when the route has an index.
+func New(serv Service, logger *slog.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "TaskDownloader.handlers.resumeTask"
+
+		taskID := chi.URLParam(r, "id")
+
+		var err error
+		if value := chi.URLParam(r, "index"); value != "" {
+			index, convErr := strconv.Atoi(value)
+			if convErr != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			err = serv.ResumeFile(taskID, index)
+		} else {
+			err = serv.ResumeTask(taskID)
+		}
+
+		if err != nil {
+			logger.Error("Failed to resume",
+				slog.String("op", op),
+				slog.String("task_id", taskID),
+				slog.String("err", err.Error()),
+			)
+
+			switch {
+			case errors.Is(err, service.ErrTaskNotFound), errors.Is(err, service.ErrFileNotFound):
+				w.WriteHeader(http.StatusNotFound)
+			case errors.Is(err, service.ErrFileFinished):
+				w.WriteHeader(http.StatusConflict)
+			default:
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
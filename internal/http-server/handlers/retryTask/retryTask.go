@@ -0,0 +1,64 @@
+package retrytask
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/LashkaPashka/TaskDownloader/internal/lib/req"
+	"github.com/LashkaPashka/TaskDownloader/internal/payload"
+	"github.com/LashkaPashka/TaskDownloader/internal/service"
+	"github.com/go-chi/chi/v5"
+)
+
+type Service interface {
+	RetryTask(taskID string, body payload.RetryTaskRequest) ([]int, error)
+}
+
+func New(serv Service, logger *slog.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "TaskDownloader.handlers.retryTask"
+
+		taskID := chi.URLParam(r, "id")
+
+		// the body is optional, without it every failed file is retried from zero
+		var body payload.RetryTaskRequest
+		if r.ContentLength != 0 {
+			var err error
+			body, err = req.HandleBody[payload.RetryTaskRequest](w, r, logger)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+		}
+
+		indexes, err := serv.RetryTask(taskID, body)
+		if err != nil {
+			logger.Error("Failed to retry task",
+				slog.String("op", op),
+				slog.String("task_id", taskID),
+				slog.String("err", err.Error()),
+			)
+
+			switch {
+			case errors.Is(err, service.ErrTaskNotFound), errors.Is(err, service.ErrFileNotFound):
+				w.WriteHeader(http.StatusNotFound)
+			case errors.Is(err, service.ErrFileNotFailed):
+				w.WriteHeader(http.StatusConflict)
+			case errors.Is(err, service.ErrEventNotSent):
+				w.WriteHeader(http.StatusServiceUnavailable)
+			default:
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+			return
+		}
+
+		w.Header().Set("Content-type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(&payload.RetryTaskResponse{
+			TaskID: taskID,
+			Indexes: indexes,
+		})
+	}
+}
@@ -1,11 +1,13 @@
 package savelisturls
 
 import (
+	"errors"
 	"log/slog"
 	"net/http"
 
 	"github.com/LashkaPashka/TaskDownloader/internal/payload"
 	"github.com/LashkaPashka/TaskDownloader/internal/lib/req"
+	"github.com/LashkaPashka/TaskDownloader/internal/service"
 )
 
 type Service interface {
@@ -22,6 +24,10 @@ func New(serv Service, logger *slog.Logger) http.HandlerFunc {
 
 		// TODO: save task on Json
 		if _, err := serv.SaveTask(body); err != nil {
+			if errors.Is(err, service.ErrEventNotSent) {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
 			w.WriteHeader(http.StatusBadRequest)
 			return
 		}
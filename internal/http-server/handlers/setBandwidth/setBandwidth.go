@@ -0,0 +1,43 @@
+package setbandwidth
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/LashkaPashka/TaskDownloader/internal/lib/req"
+	"github.com/LashkaPashka/TaskDownloader/internal/payload"
+	"github.com/LashkaPashka/TaskDownloader/internal/service"
+)
+
+type Service interface {
+	SetBandwidth(body payload.BandwidthRequest) error
+}
+
+func New(serv Service, logger *slog.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "TaskDownloader.handlers.setBandwidth"
+
+		body, err := req.HandleBody[payload.BandwidthRequest](w, r, logger)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		if err := serv.SetBandwidth(body); err != nil {
+			logger.Error("Failed to set bandwidth limits",
+				slog.String("op", op),
+				slog.String("err", err.Error()),
+			)
+
+			if errors.Is(err, service.ErrTaskNotFound) {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
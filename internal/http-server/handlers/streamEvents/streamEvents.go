@@ -0,0 +1,106 @@
+package streamevents
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/LashkaPashka/TaskDownloader/internal/lib/hub"
+	"github.com/LashkaPashka/TaskDownloader/internal/lib/sse"
+	"github.com/LashkaPashka/TaskDownloader/internal/service"
+	"github.com/go-chi/chi/v5"
+)
+
+// keepAlive is how often an idle stream gets a comment, proxies close silent connections.
+const keepAlive = 15 * time.Second
+
+type Service interface {
+	SubscribeTask(taskID string, afterID uint64) ([]hub.Event, *hub.Subscription, error)
+	SubscribeClient(clientID string, afterID uint64) ([]hub.Event, *hub.Subscription, error)
+}
+
+// New streams the events of the task as server-sent events, or of all the tasks of a client when the route has a client_id.
+// A client that reconnects with Last-Event-ID first gets the events it missed.
+func New(serv Service, logger *slog.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "TaskDownloader.handlers.streamEvents"
+
+		afterID, err := sse.LastEventID(r)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		var (
+			replay []hub.Event
+			sub *hub.Subscription
+		)
+		clientID, taskID := chi.URLParam(r, "client_id"), chi.URLParam(r, "id")
+		if clientID != "" {
+			replay, sub, err = serv.SubscribeClient(clientID, afterID)
+		} else {
+			replay, sub, err = serv.SubscribeTask(taskID, afterID)
+		}
+		if err != nil {
+			logger.Error("Failed to subscribe to events",
+				slog.String("op", op),
+				slog.String("task_id", taskID),
+				slog.String("client_id", clientID),
+				slog.String("err", err.Error()),
+			)
+
+			switch {
+			case errors.Is(err, service.ErrTaskNotFound):
+				w.WriteHeader(http.StatusNotFound)
+			case errors.Is(err, hub.ErrUnknownEventID):
+				w.WriteHeader(http.StatusBadRequest)
+			default:
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+			return
+		}
+		defer sub.Close()
+
+		stream := sse.NewWriter(w)
+
+		for _, event := range replay {
+			if err := writeEvent(stream, event); err != nil {
+				return
+			}
+		}
+
+		ticker := time.NewTicker(keepAlive)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case event, ok := <-sub.C:
+				// the subscription is dropped when the client falls behind or the server stops,
+				// the client reconnects and gets the missed events
+				if !ok {
+					return
+				}
+				if err := writeEvent(stream, event); err != nil {
+					return
+				}
+			case <-ticker.C:
+				if err := stream.Comment("ping"); err != nil {
+					return
+				}
+			}
+		}
+	}
+}
+
+func writeEvent(stream *sse.Writer, event hub.Event) error {
+	data, err := json.Marshal(event.Data)
+	if err != nil {
+		return err
+	}
+
+	return stream.Event(event.ID, event.Type, data)
+}
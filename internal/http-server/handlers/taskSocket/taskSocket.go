@@ -0,0 +1,368 @@
+package tasksocket
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/LashkaPashka/TaskDownloader/internal/lib/hub"
+	"github.com/LashkaPashka/TaskDownloader/internal/payload"
+	"github.com/LashkaPashka/TaskDownloader/internal/service"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	writeWait = 10 * time.Second
+	// the client has to answer a ping within pongWait
+	pongWait = 60 * time.Second
+	pingPeriod = pongWait * 9 / 10
+	maxMessageSize = 64 * 1024
+	sendBuffer = 256
+)
+
+// Types of the messages.
+const (
+	typeSubscribe = "subscribe"
+	typeUnsubscribe = "unsubscribe"
+	typePause = "pause"
+	typeResume = "resume"
+	typeCancel = "cancel"
+	typeRetry = "retry"
+
+	typeEvent = "event"
+	typeAck = "ack"
+	typeError = "error"
+	typeUnsubscribed = "unsubscribed"
+)
+
+type Service interface {
+	SubscribeTask(taskID string, afterID uint64) ([]hub.Event, *hub.Subscription, error)
+	PauseTask(taskID string) error
+	PauseFile(taskID string, index int) error
+	ResumeTask(taskID string) error
+	ResumeFile(taskID string, index int) error
+	CancelTask(taskID string, purge bool) error
+	RetryTask(taskID string, body payload.RetryTaskRequest) ([]int, error)
+}
+
+// the origin must match the host, browsers on other sites can not control tasks
+var upgrader = websocket.Upgrader{
+	ReadBufferSize: 1024,
+	WriteBufferSize: 4096,
+}
+
+// New upgrades the request to a websocket. The client subscribes to the events of any number of tasks over it
+// and sends the same commands as the REST API, every message with a request_id gets an ack or an error.
+func New(serv Service, logger *slog.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "TaskDownloader.handlers.taskSocket"
+
+		// the upgrader has already replied to a failed handshake
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			logger.Error("Failed to upgrade to websocket",
+				slog.String("op", op),
+				slog.String("err", err.Error()),
+			)
+			return
+		}
+
+		c := &client{
+			conn: conn,
+			serv: serv,
+			logger: logger,
+			send: make(chan payload.SocketResponse, sendBuffer),
+			done: make(chan struct{}),
+			subs: make(map[string]*hub.Subscription),
+		}
+
+		go c.writeLoop()
+		c.readLoop()
+		c.close()
+	}
+}
+
+// client is a websocket connection, the read loop handles the messages and only the write loop writes to it.
+type client struct {
+	conn *websocket.Conn
+	serv Service
+	logger *slog.Logger
+	send chan payload.SocketResponse
+	done chan struct{}
+	stopOnce sync.Once
+	forwarders sync.WaitGroup
+
+	mu sync.Mutex
+	subs map[string]*hub.Subscription
+}
+
+func (c *client) readLoop() {
+	const op = "TaskDownloader.handlers.taskSocket.readLoop"
+
+	c.conn.SetReadLimit(maxMessageSize)
+	c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
+	for {
+		_, data, err := c.conn.ReadMessage()
+		if err != nil {
+			c.logger.Debug("Websocket closed",
+				slog.String("op", op),
+				slog.String("err", err.Error()),
+			)
+			return
+		}
+
+		// a malformed message does not end the connection
+		var msg payload.SocketRequest
+		if err := json.Unmarshal(data, &msg); err != nil {
+			c.reply(msg, http.StatusBadRequest, err)
+			continue
+		}
+
+		c.handle(msg)
+	}
+}
+
+func (c *client) handle(msg payload.SocketRequest) {
+	switch msg.Type {
+	case typeSubscribe:
+		for _, taskID := range msg.TaskIDs {
+			c.subscribe(withTask(msg, taskID))
+		}
+		if len(msg.TaskIDs) == 0 {
+			c.reply(msg, http.StatusBadRequest, errors.New("task_ids are required"))
+		}
+	case typeUnsubscribe:
+		for _, taskID := range msg.TaskIDs {
+			c.unsubscribe(taskID)
+		}
+		c.reply(msg, 0, nil)
+	case typePause:
+		if msg.Index > 0 {
+			c.reply(msg, 0, c.serv.PauseFile(msg.TaskID, msg.Index))
+		} else {
+			c.reply(msg, 0, c.serv.PauseTask(msg.TaskID))
+		}
+	case typeResume:
+		if msg.Index > 0 {
+			c.reply(msg, 0, c.serv.ResumeFile(msg.TaskID, msg.Index))
+		} else {
+			c.reply(msg, 0, c.serv.ResumeTask(msg.TaskID))
+		}
+	case typeCancel:
+		c.reply(msg, 0, c.serv.CancelTask(msg.TaskID, msg.Purge))
+	case typeRetry:
+		indexes, err := c.serv.RetryTask(msg.TaskID, payload.RetryTaskRequest{Indexes: msg.Indexes, KeepPartial: msg.KeepPartial})
+		if err != nil {
+			c.reply(msg, 0, err)
+			return
+		}
+		c.push(payload.SocketResponse{Type: typeAck, RequestID: msg.RequestID, TaskID: msg.TaskID, Data: indexes})
+	default:
+		c.reply(msg, http.StatusBadRequest, errors.New("unknown message type "+msg.Type))
+	}
+}
+
+// subscribe replaces a subscription to the same task, the client gets the events after LastEventID again.
+// The ack is queued before the first event of the task.
+func (c *client) subscribe(msg payload.SocketRequest) {
+	taskID := msg.TaskID
+
+	replay, sub, err := c.serv.SubscribeTask(taskID, msg.LastEventID)
+	if err != nil {
+		c.reply(msg, 0, err)
+		return
+	}
+
+	c.mu.Lock()
+	old := c.subs[taskID]
+	c.subs[taskID] = sub
+	c.mu.Unlock()
+
+	if old != nil {
+		old.Close()
+	}
+
+	c.reply(msg, 0, nil)
+
+	c.forwarders.Add(1)
+	go c.forward(taskID, sub, replay)
+}
+
+func (c *client) unsubscribe(taskID string) {
+	c.mu.Lock()
+	sub := c.subs[taskID]
+	delete(c.subs, taskID)
+	c.mu.Unlock()
+
+	if sub != nil {
+		sub.Close()
+	}
+}
+
+// forward sends the events of the subscription to the client until it ends.
+// The client is told when the hub ends it, it can subscribe again after the last event it got.
+func (c *client) forward(taskID string, sub *hub.Subscription, replay []hub.Event) {
+	defer c.forwarders.Done()
+
+	var lastID uint64
+	for _, event := range replay {
+		if !c.push(eventResponse(event)) {
+			return
+		}
+		lastID = event.ID
+	}
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case event, ok := <-sub.C:
+			if !ok {
+				c.mu.Lock()
+				dropped := c.subs[taskID] == sub
+				if dropped {
+					delete(c.subs, taskID)
+				}
+				c.mu.Unlock()
+
+				// unsubscribed or replaced by the client
+				if !dropped {
+					return
+				}
+
+				c.push(payload.SocketResponse{Type: typeUnsubscribed, TaskID: taskID, ID: lastID})
+				return
+			}
+
+			if !c.push(eventResponse(event)) {
+				return
+			}
+			lastID = event.ID
+		}
+	}
+}
+
+func eventResponse(event hub.Event) payload.SocketResponse {
+	return payload.SocketResponse{
+		Type: typeEvent,
+		TaskID: event.TaskID,
+		ID: event.ID,
+		Event: event.Type,
+		Data: event.Data,
+	}
+}
+
+// reply acks the message or sends the error, a zero code is derived from the error.
+func (c *client) reply(msg payload.SocketRequest, code int, err error) {
+	if err == nil {
+		c.push(payload.SocketResponse{Type: typeAck, RequestID: msg.RequestID, TaskID: msg.TaskID})
+		return
+	}
+
+	if code == 0 {
+		code = statusCode(err)
+	}
+
+	c.push(payload.SocketResponse{
+		Type: typeError,
+		RequestID: msg.RequestID,
+		TaskID: msg.TaskID,
+		Code: code,
+		Error: err.Error(),
+	})
+}
+
+// push queues the message for the write loop, it is false once the connection is closed.
+func (c *client) push(resp payload.SocketResponse) bool {
+	select {
+	case c.send <- resp:
+		return true
+	case <-c.done:
+		return false
+	}
+}
+
+func (c *client) writeLoop() {
+	const op = "TaskDownloader.handlers.taskSocket.writeLoop"
+
+	ticker := time.NewTicker(pingPeriod)
+	defer func() {
+		ticker.Stop()
+		// unblocks the read loop when the client stopped reading
+		c.stop()
+		c.conn.Close()
+	}()
+
+	for {
+		select {
+		case <-c.done:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			c.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+			return
+		case resp := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.conn.WriteJSON(&resp); err != nil {
+				c.logger.Debug("Failed to write to websocket",
+					slog.String("op", op),
+					slog.String("err", err.Error()),
+				)
+				return
+			}
+		case <-ticker.C:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// stop ends the write loop and makes push fail, whichever loop ends first calls it.
+func (c *client) stop() {
+	c.stopOnce.Do(func() {
+		close(c.done)
+	})
+}
+
+func (c *client) close() {
+	c.stop()
+
+	c.mu.Lock()
+	subs := c.subs
+	c.subs = nil
+	c.mu.Unlock()
+
+	for _, sub := range subs {
+		sub.Close()
+	}
+	c.forwarders.Wait()
+}
+
+func withTask(msg payload.SocketRequest, taskID string) payload.SocketRequest {
+	msg.TaskID = taskID
+	return msg
+}
+
+// statusCode is the status the REST API answers the error with.
+func statusCode(err error) int {
+	switch {
+	case errors.Is(err, service.ErrTaskNotFound), errors.Is(err, service.ErrFileNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrTaskFinished), errors.Is(err, service.ErrFileFinished),
+		errors.Is(err, service.ErrFileNotFailed), errors.Is(err, service.ErrTaskCancelled):
+		return http.StatusConflict
+	case errors.Is(err, hub.ErrUnknownEventID):
+		return http.StatusBadRequest
+	case errors.Is(err, service.ErrEventNotSent):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,103 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"io"
+	"time"
+)
+
+const (
+	FormatZip   = "zip"
+	FormatTarGz = "tar.gz"
+)
+
+var ErrUnknownFormat = errors.New("unknown archive format")
+
+// Entry describes a file written to the archive, tar needs the size before the content.
+type Entry struct {
+	Name    string
+	Size    int64
+	ModTime time.Time
+}
+
+// Writer streams entries into an archive, nothing is buffered besides the compressor state.
+type Writer interface {
+	Add(entry Entry, r io.Reader) error
+	// Close writes the end of the archive, it does not close the underlying writer.
+	Close() error
+}
+
+func New(format string, w io.Writer) (Writer, error) {
+	switch format {
+	case FormatZip:
+		return &zipWriter{zw: zip.NewWriter(w)}, nil
+	case FormatTarGz:
+		gz := gzip.NewWriter(w)
+		return &tarGzWriter{gz: gz, tw: tar.NewWriter(gz)}, nil
+	}
+
+	return nil, ErrUnknownFormat
+}
+
+// ContentType returns the media type of the format.
+func ContentType(format string) string {
+	if format == FormatTarGz {
+		return "application/gzip"
+	}
+
+	return "application/zip"
+}
+
+type zipWriter struct {
+	zw *zip.Writer
+}
+
+func (z *zipWriter) Add(entry Entry, r io.Reader) error {
+	w, err := z.zw.CreateHeader(&zip.FileHeader{
+		Name:     entry.Name,
+		Method:   zip.Deflate,
+		Modified: entry.ModTime,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(w, r)
+	return err
+}
+
+func (z *zipWriter) Close() error {
+	return z.zw.Close()
+}
+
+type tarGzWriter struct {
+	gz *gzip.Writer
+	tw *tar.Writer
+}
+
+func (t *tarGzWriter) Add(entry Entry, r io.Reader) error {
+	if err := t.tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     entry.Name,
+		Size:     entry.Size,
+		Mode:     0644,
+		ModTime:  entry.ModTime,
+	}); err != nil {
+		return err
+	}
+
+	// a reader giving less than the header promised corrupts the archive
+	_, err := io.CopyN(t.tw, r, entry.Size)
+	return err
+}
+
+func (t *tarGzWriter) Close() error {
+	if err := t.tw.Close(); err != nil {
+		return err
+	}
+
+	return t.gz.Close()
+}
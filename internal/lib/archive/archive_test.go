@@ -0,0 +1,100 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+var entries = map[string]string{
+	"a.txt": "first file",
+	"b.bin": strings.Repeat("x", 100000),
+}
+
+func write(t *testing.T, format string) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	w, err := New(format, &buf)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	for _, name := range []string{"a.txt", "b.bin"} {
+		content := entries[name]
+		if err := w.Add(Entry{Name: name, Size: int64(len(content)), ModTime: time.Now()}, strings.NewReader(content)); err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	return buf.Bytes()
+}
+
+func TestZip(t *testing.T) {
+	raw := write(t, FormatZip)
+
+	zr, err := zip.NewReader(bytes.NewReader(raw), int64(len(raw)))
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if len(zr.File) != len(entries) {
+		t.Fatalf("Error: %d entries, want %d", len(zr.File), len(entries))
+	}
+
+	for _, f := range zr.File {
+		r, err := f.Open()
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		got, _ := io.ReadAll(r)
+		r.Close()
+		if string(got) != entries[f.Name] {
+			t.Fatalf("Error: entry %s does not match", f.Name)
+		}
+	}
+}
+
+func TestTarGz(t *testing.T) {
+	raw := write(t, FormatTarGz)
+
+	gz, err := gzip.NewReader(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	tr := tar.NewReader(gz)
+
+	count := 0
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		got, _ := io.ReadAll(tr)
+		if string(got) != entries[header.Name] {
+			t.Fatalf("Error: entry %s does not match", header.Name)
+		}
+		count++
+	}
+
+	if count != len(entries) {
+		t.Fatalf("Error: %d entries, want %d", count, len(entries))
+	}
+}
+
+func TestUnknownFormat(t *testing.T) {
+	if _, err := New("rar", io.Discard); !errors.Is(err, ErrUnknownFormat) {
+		t.Fatalf("Error: got %v, want %v", err, ErrUnknownFormat)
+	}
+}
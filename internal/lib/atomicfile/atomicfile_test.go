@@ -0,0 +1,38 @@
+package atomicfile
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWrite(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "state.json")
+
+	if err := Write(path, []byte(`{"v":1}`)); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if err := Write(path, []byte(`{"v":2}`)); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	got, err := os.ReadFile(path)
+	if err != nil || string(got) != `{"v":2}` {
+		t.Fatalf("Error: got %q, %v", got, err)
+	}
+
+	info, _ := os.Stat(path)
+	if info.Mode().Perm() != 0o644 {
+		t.Fatalf("Error: mode %v, want 0644", info.Mode().Perm())
+	}
+
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Fatalf("Error: temporary files left %v", entries)
+	}
+
+	if err := Write(filepath.Join(dir, "missing", "state.json"), nil); err == nil {
+		t.Fatalf("Error: expected error for missing directory")
+	}
+}
@@ -0,0 +1,253 @@
+package bandwidth
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	"golang.org/x/time/rate"
+)
+
+// minBurst lets a limiter pass a whole read buffer of the downloader at once.
+const minBurst = 32 * 1024
+
+// Limits in bytes per second, 0 means unlimited.
+type Limits struct {
+	Global  int64
+	Clients map[string]int64
+	Tasks   map[string]int64
+}
+
+// Manager holds token buckets for the whole service, every client and every task.
+// Limits can be changed at any time, they apply to reads already in progress.
+type Manager struct {
+	mu      sync.Mutex
+	global  *rate.Limiter
+	clients map[string]*rate.Limiter
+	tasks   map[string]*task
+	limits  Limits
+}
+
+type task struct {
+	clientID string
+	limiter  *rate.Limiter
+}
+
+func New(global int64, clients map[string]int64) *Manager {
+	m := &Manager{
+		global:  newLimiter(global),
+		clients: make(map[string]*rate.Limiter),
+		tasks:   make(map[string]*task),
+		limits: Limits{
+			Global:  global,
+			Clients: make(map[string]int64),
+			Tasks:   make(map[string]int64),
+		},
+	}
+
+	for clientID, limit := range clients {
+		m.SetClient(clientID, limit)
+	}
+
+	return m
+}
+
+func newLimiter(bytesPerSec int64) *rate.Limiter {
+	l := rate.NewLimiter(rate.Inf, minBurst)
+	setLimit(l, bytesPerSec)
+
+	return l
+}
+
+func setLimit(l *rate.Limiter, bytesPerSec int64) {
+	if bytesPerSec <= 0 {
+		l.SetLimit(rate.Inf)
+		l.SetBurst(minBurst)
+		return
+	}
+
+	l.SetLimit(rate.Limit(bytesPerSec))
+	l.SetBurst(int(max(bytesPerSec, minBurst)))
+}
+
+func (m *Manager) SetGlobal(bytesPerSec int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	setLimit(m.global, bytesPerSec)
+	m.limits.Global = bytesPerSec
+}
+
+func (m *Manager) SetClient(clientID string, bytesPerSec int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	l, ok := m.clients[clientID]
+	if !ok {
+		l = newLimiter(0)
+		m.clients[clientID] = l
+	}
+	setLimit(l, bytesPerSec)
+
+	if bytesPerSec <= 0 {
+		delete(m.limits.Clients, clientID)
+	} else {
+		m.limits.Clients[clientID] = bytesPerSec
+	}
+}
+
+// SetTask registers the task with its client, reads of the task are limited by both.
+func (m *Manager) SetTask(taskID, clientID string, bytesPerSec int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.setTask(taskID, clientID, bytesPerSec)
+}
+
+// AddTask is SetTask for a task that is not registered yet, a registered task keeps the limit
+// it may have been given at runtime.
+func (m *Manager) AddTask(taskID, clientID string, bytesPerSec int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.tasks[taskID]; ok {
+		return
+	}
+	m.setTask(taskID, clientID, bytesPerSec)
+}
+
+func (m *Manager) setTask(taskID, clientID string, bytesPerSec int64) {
+	t, ok := m.tasks[taskID]
+	if !ok {
+		t = &task{limiter: newLimiter(0)}
+		m.tasks[taskID] = t
+	}
+	t.clientID = clientID
+	setLimit(t.limiter, bytesPerSec)
+
+	if bytesPerSec <= 0 {
+		delete(m.limits.Tasks, taskID)
+	} else {
+		m.limits.Tasks[taskID] = bytesPerSec
+	}
+}
+
+// SetTaskLimit changes the limit of a registered task, it reports false for unknown tasks.
+func (m *Manager) SetTaskLimit(taskID string, bytesPerSec int64) bool {
+	m.mu.Lock()
+	t, ok := m.tasks[taskID]
+	m.mu.Unlock()
+
+	if !ok {
+		return false
+	}
+
+	m.SetTask(taskID, t.clientID, bytesPerSec)
+
+	return true
+}
+
+// RemoveTask forgets the limiter of a finished task.
+func (m *Manager) RemoveTask(taskID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.tasks, taskID)
+	delete(m.limits.Tasks, taskID)
+}
+
+// Limits returns a copy of the configured limits.
+func (m *Manager) Limits() Limits {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	limits := Limits{
+		Global:  m.limits.Global,
+		Clients: make(map[string]int64, len(m.limits.Clients)),
+		Tasks:   make(map[string]int64, len(m.limits.Tasks)),
+	}
+	for k, v := range m.limits.Clients {
+		limits.Clients[k] = v
+	}
+	for k, v := range m.limits.Tasks {
+		limits.Tasks[k] = v
+	}
+
+	return limits
+}
+
+func (m *Manager) limiters(taskID string) []*rate.Limiter {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	limiters := []*rate.Limiter{m.global}
+
+	t, ok := m.tasks[taskID]
+	if !ok {
+		return limiters
+	}
+	limiters = append(limiters, t.limiter)
+
+	if l, ok := m.clients[t.clientID]; ok {
+		limiters = append(limiters, l)
+	}
+
+	return limiters
+}
+
+// Reader limits reads from r by the global limit and the limits of the task and its client.
+func (m *Manager) Reader(ctx context.Context, taskID string, r io.Reader) io.Reader {
+	if m == nil {
+		return r
+	}
+
+	return &reader{ctx: ctx, r: r, m: m, taskID: taskID}
+}
+
+type reader struct {
+	ctx    context.Context
+	r      io.Reader
+	m      *Manager
+	taskID string
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	limiters := r.m.limiters(r.taskID)
+
+	// never ask a bucket for more tokens than it can hold
+	for _, l := range limiters {
+		if burst := l.Burst(); len(p) > burst {
+			p = p[:burst]
+		}
+	}
+
+	n, err := r.r.Read(p)
+	if n <= 0 {
+		return n, err
+	}
+
+	for _, l := range limiters {
+		if werr := wait(r.ctx, l, n); werr != nil {
+			return n, werr
+		}
+	}
+
+	return n, err
+}
+
+// wait takes n tokens in parts, the burst may have been lowered since the read.
+func wait(ctx context.Context, l *rate.Limiter, n int) error {
+	for n > 0 {
+		if l.Limit() == rate.Inf {
+			return nil
+		}
+
+		k := min(n, l.Burst())
+		if err := l.WaitN(ctx, k); err != nil {
+			return err
+		}
+		n -= k
+	}
+
+	return nil
+}
@@ -0,0 +1,90 @@
+package bandwidth
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+	"time"
+)
+
+func readAll(t *testing.T, r io.Reader) time.Duration {
+	start := time.Now()
+	if _, err := io.Copy(io.Discard, r); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	return time.Since(start)
+}
+
+func TestUnlimited(t *testing.T) {
+	m := New(0, nil)
+
+	elapsed := readAll(t, m.Reader(context.Background(), "task", bytes.NewReader(make([]byte, 1<<20))))
+	if elapsed > 100*time.Millisecond {
+		t.Fatalf("Error: unlimited read took %v", elapsed)
+	}
+}
+
+func TestTaskLimit(t *testing.T) {
+	m := New(0, nil)
+	m.SetTask("task", "client", 64*1024)
+
+	// the first burst is free, the rest takes about a second
+	elapsed := readAll(t, m.Reader(context.Background(), "task", bytes.NewReader(make([]byte, 128*1024))))
+	if elapsed < 800*time.Millisecond {
+		t.Fatalf("Error: limited read took only %v", elapsed)
+	}
+}
+
+func TestClientLimitAppliesToItsTasks(t *testing.T) {
+	m := New(0, map[string]int64{"client": 64 * 1024})
+	m.SetTask("task", "client", 0)
+	m.SetTask("other", "other-client", 0)
+
+	elapsed := readAll(t, m.Reader(context.Background(), "other", bytes.NewReader(make([]byte, 128*1024))))
+	if elapsed > 100*time.Millisecond {
+		t.Fatalf("Error: task of another client was limited for %v", elapsed)
+	}
+
+	elapsed = readAll(t, m.Reader(context.Background(), "task", bytes.NewReader(make([]byte, 128*1024))))
+	if elapsed < 800*time.Millisecond {
+		t.Fatalf("Error: client limited read took only %v", elapsed)
+	}
+}
+
+func TestLimitChangedAtRuntime(t *testing.T) {
+	m := New(32*1024, nil)
+	m.SetGlobal(0)
+
+	elapsed := readAll(t, m.Reader(context.Background(), "task", bytes.NewReader(make([]byte, 256*1024))))
+	if elapsed > 100*time.Millisecond {
+		t.Fatalf("Error: lifted limit still applied, read took %v", elapsed)
+	}
+
+	if limits := m.Limits(); limits.Global != 0 {
+		t.Fatalf("Error: limits not updated %+v", limits)
+	}
+}
+
+func TestReadCancelled(t *testing.T) {
+	m := New(32*1024, nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if _, err := io.Copy(io.Discard, m.Reader(ctx, "task", bytes.NewReader(make([]byte, 1<<20)))); err == nil {
+		t.Fatalf("Error: expected the read to be cancelled")
+	}
+}
+
+func TestAddTaskKeepsRuntimeLimit(t *testing.T) {
+	m := New(0, nil)
+	m.AddTask("task", "client", 1024)
+	m.SetTaskLimit("task", 64*1024)
+
+	m.AddTask("task", "client", 1024)
+	if limit := m.Limits().Tasks["task"]; limit != 64*1024 {
+		t.Fatalf("Error: runtime limit replaced by %d", limit)
+	}
+}
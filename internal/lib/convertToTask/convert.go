@@ -1,7 +1,9 @@
 package converttotask
 
 import (
+	"fmt"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/LashkaPashka/TaskDownloader/internal/payload"
@@ -12,25 +14,69 @@ const (
 	statusQueued = "queued"
 )
 
+const (
+	algoSHA256 = "sha256"
+	algoSHA1 = "sha1"
+	algoMD5 = "md5"
+)
+
 func Convert(body *payload.SaveTaskRequest) models.Task {	
+	return models.Task{
+		ID: random.RandomString("task_", 10),
+		ClientID:  body.ClientID,
+		File: ConvertFiles(body.Urls, 1),
+		Status: statusQueued,
+		CreatedAt: time.Now(),
+		MaxBytesPerSec: body.MaxBytesPerSec,
+		CallbackURL: body.CallbackURL,
+	}
+}
+
+// ConvertFiles makes queued files of the urls, they are numbered from firstIndex.
+// The files of a task share a folder: a filename taken by a file before it or listed in taken
+// gets the index of the file prepended.
+func ConvertFiles(urls []payload.FileRequest, firstIndex int, taken ...string) []models.File {
 	var fl []models.File
+
+	names := make(map[string]bool, len(taken)+len(urls))
+	for _, name := range taken {
+		names[name] = true
+	}
 	
-	for index, url := range body.Urls {
+	for index, url := range urls {
+		algo, checksum := expectedChecksum(url)
+
+		name := filepath.Base(url.Url)
+		for names[name] {
+			name = fmt.Sprintf("%d_%s", firstIndex+index, name)
+		}
+		names[name] = true
+
 		fl = append(fl, models.File{
-			Index: index+1,
-			Url: url,
-			Filename: filepath.Base(url),
+			Index: firstIndex+index,
+			Url: url.Url,
+			Filename: name,
 			Status: statusQueued,
 			StartedAt: time.Time{},
 			FinishedAt: time.Time{},
+			ChecksumAlgo: algo,
+			ExpectedChecksum: checksum,
 		})
 	}
 
-	return models.Task{
-		ID: random.RandomString("task_", 10),
-		ClientID:  body.ClientID,
-		File: fl,
-		Status: statusQueued,
-		CreatedAt: time.Now(),
+	return fl
+}
+
+// expectedChecksum picks the strongest digest sent by the client, sha256 is computed when none is sent.
+func expectedChecksum(url payload.FileRequest) (algo string, checksum string) {
+	switch {
+	case url.SHA256 != "":
+		return algoSHA256, strings.ToLower(url.SHA256)
+	case url.SHA1 != "":
+		return algoSHA1, strings.ToLower(url.SHA1)
+	case url.MD5 != "":
+		return algoMD5, strings.ToLower(url.MD5)
 	}
+
+	return algoSHA256, ""
 }
\ No newline at end of file
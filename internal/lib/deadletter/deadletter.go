@@ -0,0 +1,145 @@
+package deadletter
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/LashkaPashka/TaskDownloader/internal/lib/atomicfile"
+	"github.com/LashkaPashka/TaskDownloader/internal/lib/random"
+)
+
+// keepLetters is how many letters stay in the queue, the oldest ones are dropped first.
+const keepLetters = 1000
+
+// Letter is an event its consumer failed to handle, Payload is the data of the event as it was received.
+type Letter struct {
+	ID        string          `json:"id"`
+	Topic     string          `json:"topic"`
+	Payload   json.RawMessage `json:"payload"`
+	Error     string          `json:"error"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// Queue keeps the letters in a json file, every change is written before it returns.
+type Queue struct {
+	path string
+	keep int
+
+	mu      sync.Mutex
+	letters []Letter
+}
+
+// Open loads the letters of the file, it is created on the first write.
+func Open(path string) (*Queue, error) {
+	q := &Queue{path: path, keep: keepLetters}
+
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return q, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, &q.letters); err != nil {
+			return nil, fmt.Errorf("dead-letter queue %s: %w", path, err)
+		}
+	}
+
+	return q, nil
+}
+
+// Add puts the event into the queue. A payload that is not valid json is kept as a json string.
+func (q *Queue) Add(topic string, payload []byte, reason string) (Letter, error) {
+	if !json.Valid(payload) {
+		payload, _ = json.Marshal(string(payload))
+	}
+
+	letter := Letter{
+		ID:        random.RandomString("dl_", 16),
+		Topic:     topic,
+		Payload:   payload,
+		Error:     reason,
+		CreatedAt: time.Now().UTC(),
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	letters := q.letters
+	q.letters = append(slices.Clone(letters), letter)
+	if len(q.letters) > q.keep {
+		q.letters = q.letters[len(q.letters)-q.keep:]
+	}
+
+	if err := q.save(); err != nil {
+		q.letters = letters
+		return Letter{}, err
+	}
+
+	return letter, nil
+}
+
+// Letters returns a copy of the queue, oldest first.
+func (q *Queue) Letters() []Letter {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return slices.Clone(q.letters)
+}
+
+func (q *Queue) Get(id string) (Letter, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	i := slices.IndexFunc(q.letters, func(l Letter) bool { return l.ID == id })
+	if i < 0 {
+		return Letter{}, false
+	}
+
+	return q.letters[i], true
+}
+
+// Remove deletes the letter, it is false when there is no letter with the id.
+func (q *Queue) Remove(id string) (bool, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	i := slices.IndexFunc(q.letters, func(l Letter) bool { return l.ID == id })
+	if i < 0 {
+		return false, nil
+	}
+
+	letters := q.letters
+	q.letters = slices.Delete(slices.Clone(letters), i, i+1)
+
+	if err := q.save(); err != nil {
+		q.letters = letters
+		return false, err
+	}
+
+	return true, nil
+}
+
+// save replaces the file of the queue atomically, a crash never leaves a partial queue.
+// It must be called with mu held.
+func (q *Queue) save() error {
+	data, err := json.Marshal(q.letters)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(q.path), os.ModePerm); err != nil {
+		return err
+	}
+
+	return atomicfile.Write(q.path, data)
+}
@@ -0,0 +1,47 @@
+package deadletter
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestQueue(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dead_letters.json")
+
+	q, err := Open(path)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	q.keep = 2
+
+	first, err := q.Add("task.created", []byte(`{"task_id":"task_1"}`), "storage is down")
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	malformed, _ := q.Add("task.created", []byte(`{"task_id":`), "unexpected end of JSON input")
+	last, _ := q.Add("task.retry", []byte(`"task_3"`), "wrong data")
+
+	if _, ok := q.Get(first.ID); ok {
+		t.Fatalf("Error: letter over the limit was kept")
+	}
+	if string(malformed.Payload) != `"{\"task_id\":"` {
+		t.Fatalf("Error: invalid json payload was not kept as a string: %s", malformed.Payload)
+	}
+
+	if removed, err := q.Remove(malformed.ID); !removed || err != nil {
+		t.Fatalf("Error: letter was not removed: %v", err)
+	}
+
+	reopened, err := Open(path)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	letters := reopened.Letters()
+	if len(letters) != 1 || letters[0].ID != last.ID || letters[0].Error != "wrong data" || string(letters[0].Payload) != `"task_3"` {
+		t.Fatalf("Error: unexpected letters %+v", letters)
+	}
+	if removed, _ := reopened.Remove("dl_unknown"); removed {
+		t.Fatalf("Error: unknown letter was removed")
+	}
+}
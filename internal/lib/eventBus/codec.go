@@ -0,0 +1,60 @@
+package eventbus
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/LashkaPashka/TaskDownloader/internal/models"
+)
+
+var ErrUnknownTopic = errors.New("no type is registered for the topic")
+
+var (
+	decodersMu sync.RWMutex
+	decoders   = make(map[Topic]func(data []byte) (any, error))
+)
+
+func init() {
+	Register[models.EventData](EventCreateTask)
+	Register[models.EventData](EventRetryTask)
+	Register[models.EventData](EventAppendFiles)
+	Register[models.EventData](EventResumeFiles)
+	Register[models.EventData](EventPauseFiles)
+	Register[models.EventData](EventCancelTask)
+	Register[map[string][]models.File](EventUnfinishedTask)
+}
+
+// Register sets the type the data of the topic is decoded to when an event is read back from its JSON.
+// Consumers receive the same type as the publisher has sent.
+func Register[T any](topic Topic) {
+	decodersMu.Lock()
+	defer decodersMu.Unlock()
+
+	decoders[topic] = func(data []byte) (any, error) {
+		var value T
+		if err := json.Unmarshal(data, &value); err != nil {
+			return nil, err
+		}
+		return value, nil
+	}
+}
+
+// Decode returns the event of the topic with its data decoded to the registered type.
+func Decode(topic Topic, data []byte) (Event, error) {
+	decodersMu.RLock()
+	decode, ok := decoders[topic]
+	decodersMu.RUnlock()
+
+	if !ok {
+		return Event{}, fmt.Errorf("%w: %s", ErrUnknownTopic, topic)
+	}
+
+	value, err := decode(data)
+	if err != nil {
+		return Event{}, fmt.Errorf("decode %s: %w", topic, err)
+	}
+
+	return Event{Type: topic, Data: value}, nil
+}
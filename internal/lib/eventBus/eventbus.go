@@ -1,29 +1,326 @@
 package eventbus
 
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// Topic is the type of an event, subscribers choose the topics they receive.
+type Topic string
+
+const (
+	EventCreateTask     Topic = "task.created"
+	EventUnfinishedTask Topic = "task.unfinished"
+	EventRetryTask      Topic = "task.retry"
+	EventAppendFiles    Topic = "task.files_appended"
+	EventResumeFiles    Topic = "task.resumed"
+	EventPauseFiles     Topic = "task.paused"
+	EventCancelTask     Topic = "task.cancelled"
+)
+
+// Overflow is what Publish does when the queue of a subscriber is full.
+type Overflow string
+
 const (
-	EventCreateTask = "task.created"
-	EventUnfinishedTask = "task.unfinished"
+	// OverflowBlock makes Publish wait until the subscriber takes an event, nothing is lost.
+	OverflowBlock Overflow = "block"
+	// OverflowDropOldest drops the oldest queued event to make room for the new one.
+	OverflowDropOldest Overflow = "drop_oldest"
+	// OverflowDropNewest drops the new event and keeps the queue as it is.
+	OverflowDropNewest Overflow = "drop_newest"
+)
+
+// DefaultBuffer is the queue size of a subscriber when none is given.
+const DefaultBuffer = 256
+
+var (
+	ErrClosed          = errors.New("event bus is closed")
+	ErrUnknownOverflow = errors.New("unknown overflow policy")
 )
 
 type Event struct {
-	Type string
+	Type Topic
 	Data any
+	// Offset of the event in the durable log, 0 when it was not written there
+	Offset uint64
+
+	// ack is set by the transport for the subscriptions with ManualAck
+	ack func()
+}
+
+// Ack tells the transport the event is handled, it is not delivered again.
+// It does nothing for the events of a subscription without ManualAck.
+func (e Event) Ack() {
+	if e.ack != nil {
+		e.ack()
+	}
+}
+
+// Options of a subscription, zero fields are taken from the defaults of the bus.
+type Options struct {
+	Buffer   int
+	Overflow Overflow
+	// Group shares the events between its subscribers, each event goes to one of them.
+	// Subscribers without a group receive every event.
+	Group string
+	// ManualAck keeps the event in a durable transport until the subscriber calls Event.Ack,
+	// an event that was not acknowledged is delivered again. Local has nothing to deliver again and ignores it.
+	ManualAck bool
+}
+
+// EventBus delivers every published event to all subscribers of its topic.
+// Each subscriber has its own queue, a slow one only affects the others when its policy is OverflowBlock.
+type EventBus interface {
+	// Publish sends the event to the subscribers of its topic.
+	Publish(event Event) error
+	// Subscribe to the topics with the defaults of the bus, no topics means all of them.
+	// The subscription is closed already when the bus fails to create it, SubscribeWith returns the error.
+	Subscribe(topics ...Topic) *Subscription
+	// SubscribeWith is Subscribe with its own queue size, overflow policy and group.
+	SubscribeWith(options Options, topics ...Topic) (*Subscription, error)
+	// Unsubscribe stops the delivery to the subscription and closes its channel, queued events can still be read.
+	Unsubscribe(sub *Subscription)
+	// Close unsubscribes everyone, later calls of Publish return ErrClosed.
+	Close()
+}
+
+// Local is the EventBus of a single process.
+type Local struct {
+	defaults Options
+
+	mu     sync.RWMutex
+	closed bool
+	subs   map[*Subscription]struct{}
+}
+
+// Subscription receives the events of its topics from C until it is unsubscribed or the bus is closed.
+type Subscription struct {
+	C <-chan Event
+
+	c        chan Event
+	topics   map[Topic]struct{}
+	overflow Overflow
+	group    string
+	dropped  atomic.Uint64
+
+	// done is closed first, it releases a Publish blocked on a full queue
+	done     chan struct{}
+	doneOnce sync.Once
+
+	mu     sync.Mutex
+	closed bool
+}
+
+// NewEventBus returns a local bus whose subscribers have DefaultBuffer events queued and block publishers when full.
+func NewEventBus() *Local {
+	bus, _ := NewLocal(Options{})
+	return bus
+}
+
+// NewLocal returns a local bus with the given defaults of the subscriptions.
+func NewLocal(defaults Options) (*Local, error) {
+	defaults, err := defaults.withDefaults(Options{Buffer: DefaultBuffer, Overflow: OverflowBlock})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Local{
+		defaults: defaults,
+		subs:     make(map[*Subscription]struct{}),
+	}, nil
+}
+
+func (o Options) withDefaults(defaults Options) (Options, error) {
+	if o.Buffer <= 0 {
+		o.Buffer = defaults.Buffer
+	}
+	if o.Overflow == "" {
+		o.Overflow = defaults.Overflow
+	}
+
+	switch o.Overflow {
+	case OverflowBlock, OverflowDropOldest, OverflowDropNewest:
+		return o, nil
+	default:
+		return o, fmt.Errorf("%w: %s", ErrUnknownOverflow, o.Overflow)
+	}
+}
+
+// Publish queues the event for every subscriber of its topic and for one subscriber of every group.
+func (e *Local) Publish(event Event) error {
+	e.mu.RLock()
+	if e.closed {
+		e.mu.RUnlock()
+		return ErrClosed
+	}
+
+	subs := make([]*Subscription, 0, len(e.subs))
+	groups := make(map[string]bool)
+	// the order of the map is random, the events of a group are spread between its subscribers
+	for sub := range e.subs {
+		if !sub.wants(event.Type) || sub.group != "" && groups[sub.group] {
+			continue
+		}
+		if sub.group != "" {
+			groups[sub.group] = true
+		}
+		subs = append(subs, sub)
+	}
+	e.mu.RUnlock()
+
+	// sent outside of the lock, a blocked subscriber must still be able to unsubscribe
+	for _, sub := range subs {
+		sub.push(event)
+	}
+
+	return nil
+}
+
+// Subscribe to the topics with the defaults of the bus, no topics means all of them.
+func (e *Local) Subscribe(topics ...Topic) *Subscription {
+	sub, _ := e.SubscribeWith(Options{}, topics...)
+	return sub
+}
+
+// SubscribeWith is Subscribe with its own queue size, overflow policy and group.
+// The subscription of a closed bus has its channel closed already.
+func (e *Local) SubscribeWith(options Options, topics ...Topic) (*Subscription, error) {
+	options, err := options.withDefaults(e.defaults)
+	if err != nil {
+		return nil, err
+	}
+
+	sub := newSubscription(options, topics)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.closed {
+		sub.close()
+		return sub, nil
+	}
+	e.subs[sub] = struct{}{}
+
+	return sub, nil
+}
+
+// Unsubscribe stops the delivery to the subscription and closes its channel, queued events can still be read.
+func (e *Local) Unsubscribe(sub *Subscription) {
+	e.mu.Lock()
+	delete(e.subs, sub)
+	e.mu.Unlock()
+
+	sub.close()
+}
+
+// Close unsubscribes everyone, later calls of Publish return ErrClosed.
+func (e *Local) Close() {
+	e.mu.Lock()
+	if e.closed {
+		e.mu.Unlock()
+		return
+	}
+	e.closed = true
+	subs := e.subs
+	e.subs = nil
+	e.mu.Unlock()
+
+	for sub := range subs {
+		sub.close()
+	}
+}
+
+func newSubscription(options Options, topics []Topic) *Subscription {
+	c := make(chan Event, options.Buffer)
+	sub := &Subscription{
+		C:        c,
+		c:        c,
+		overflow: options.Overflow,
+		group:    options.Group,
+		done:     make(chan struct{}),
+	}
+	if len(topics) > 0 {
+		sub.topics = make(map[Topic]struct{}, len(topics))
+		for _, topic := range topics {
+			sub.topics[topic] = struct{}{}
+		}
+	}
+
+	return sub
+}
+
+// closedSubscription is returned by Subscribe when the bus fails to subscribe.
+func closedSubscription() *Subscription {
+	sub := newSubscription(Options{}, nil)
+	sub.close()
+	return sub
 }
 
-type EventBus struct {
-	Bus chan Event
+// Dropped is how many events did not fit in the queue of the subscription.
+func (s *Subscription) Dropped() uint64 {
+	return s.dropped.Load()
 }
 
-func NewEventBus() *EventBus {
-	return &EventBus{
-		Bus: make(chan Event),
+func (s *Subscription) wants(topic Topic) bool {
+	if s.topics == nil {
+		return true
 	}
+	_, ok := s.topics[topic]
+	return ok
 }
 
-func (e *EventBus) Publish(event Event) {
-	e.Bus <- event
+// push queues the event by the overflow policy. It is false when the event was neither queued nor dropped
+// because the subscription is closed, a transport with acknowledgements delivers it again.
+func (s *Subscription) push(event Event) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return false
+	}
+
+	switch s.overflow {
+	case OverflowDropNewest:
+		select {
+		case s.c <- event:
+		default:
+			s.dropped.Add(1)
+		}
+		return true
+	case OverflowDropOldest:
+		for {
+			select {
+			case s.c <- event:
+				return true
+			default:
+			}
+
+			select {
+			case <-s.c:
+				s.dropped.Add(1)
+			default:
+			}
+		}
+	default:
+		select {
+		case s.c <- event:
+			return true
+		case <-s.done:
+			return false
+		}
+	}
 }
 
-func (e *EventBus) Subscribe() <- chan Event {
-	return e.Bus
-}
\ No newline at end of file
+func (s *Subscription) close() {
+	s.doneOnce.Do(func() { close(s.done) })
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.closed {
+		s.closed = true
+		close(s.c)
+	}
+}
@@ -0,0 +1,167 @@
+package eventbus
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/LashkaPashka/TaskDownloader/internal/models"
+)
+
+func receive(t *testing.T, sub *Subscription) Event {
+	t.Helper()
+
+	select {
+	case event, ok := <-sub.C:
+		if !ok {
+			t.Fatalf("Error: subscription is closed")
+		}
+		return event
+	case <-time.After(time.Second):
+		t.Fatalf("Error: no event received")
+	}
+	return Event{}
+}
+
+func TestTopics(t *testing.T) {
+	bus := NewEventBus()
+
+	created := bus.Subscribe(EventCreateTask)
+	all := bus.Subscribe()
+
+	bus.Publish(Event{Type: EventCreateTask, Data: "task_1"})
+	bus.Publish(Event{Type: EventRetryTask, Data: "task_2"})
+
+	if event := receive(t, created); event.Data != "task_1" {
+		t.Fatalf("Error: unexpected event %+v", event)
+	}
+	if len(created.C) != 0 {
+		t.Fatalf("Error: subscriber got an event of another topic")
+	}
+
+	if event := receive(t, all); event.Type != EventCreateTask {
+		t.Fatalf("Error: unexpected event %+v", event)
+	}
+	if event := receive(t, all); event.Type != EventRetryTask {
+		t.Fatalf("Error: unexpected event %+v", event)
+	}
+}
+
+func TestOverflow(t *testing.T) {
+	bus := NewEventBus()
+
+	oldest, err := bus.SubscribeWith(Options{Buffer: 2, Overflow: OverflowDropOldest})
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	newest, _ := bus.SubscribeWith(Options{Buffer: 2, Overflow: OverflowDropNewest})
+
+	for i := 1; i <= 3; i++ {
+		bus.Publish(Event{Type: EventCreateTask, Data: i})
+	}
+
+	if a, b := receive(t, oldest), receive(t, oldest); a.Data != 2 || b.Data != 3 || oldest.Dropped() != 1 {
+		t.Fatalf("Error: drop_oldest kept %v and %v, dropped %d", a.Data, b.Data, oldest.Dropped())
+	}
+	if a, b := receive(t, newest), receive(t, newest); a.Data != 1 || b.Data != 2 || newest.Dropped() != 1 {
+		t.Fatalf("Error: drop_newest kept %v and %v, dropped %d", a.Data, b.Data, newest.Dropped())
+	}
+
+	if _, err := bus.SubscribeWith(Options{Overflow: "spill"}); !errors.Is(err, ErrUnknownOverflow) {
+		t.Fatalf("Error: got %v, want %v", err, ErrUnknownOverflow)
+	}
+}
+
+func TestBlockUntilUnsubscribed(t *testing.T) {
+	bus := NewEventBus()
+
+	slow, _ := bus.SubscribeWith(Options{Buffer: 1, Overflow: OverflowBlock})
+	fast, _ := bus.SubscribeWith(Options{Buffer: 8, Overflow: OverflowDropNewest})
+
+	bus.Publish(Event{Type: EventCreateTask, Data: 1})
+
+	published := make(chan struct{})
+	go func() {
+		bus.Publish(Event{Type: EventCreateTask, Data: 2})
+		close(published)
+	}()
+
+	select {
+	case <-published:
+		t.Fatalf("Error: publish did not wait for a full blocking subscriber")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	bus.Unsubscribe(slow)
+
+	select {
+	case <-published:
+	case <-time.After(time.Second):
+		t.Fatalf("Error: publish is still blocked after unsubscribe")
+	}
+
+	// queued events are still delivered after unsubscribe
+	if event := receive(t, slow); event.Data != 1 {
+		t.Fatalf("Error: unexpected event %+v", event)
+	}
+	if _, ok := <-slow.C; ok {
+		t.Fatalf("Error: subscription is not closed")
+	}
+
+	if a, b := receive(t, fast), receive(t, fast); a.Data != 1 || b.Data != 2 {
+		t.Fatalf("Error: other subscriber got %v and %v", a.Data, b.Data)
+	}
+}
+
+func TestClose(t *testing.T) {
+	bus := NewEventBus()
+	sub := bus.Subscribe()
+
+	bus.Close()
+	bus.Close()
+
+	if _, ok := <-sub.C; ok {
+		t.Fatalf("Error: subscription is not closed")
+	}
+	if err := bus.Publish(Event{Type: EventCreateTask}); !errors.Is(err, ErrClosed) {
+		t.Fatalf("Error: got %v, want %v", err, ErrClosed)
+	}
+	if _, ok := <-bus.Subscribe().C; ok {
+		t.Fatalf("Error: subscription of a closed bus is not closed")
+	}
+}
+
+func TestDecode(t *testing.T) {
+	event, err := Decode(EventRetryTask, []byte(`{"client_id":"client","task_id":"task_1","indexes":[2]}`))
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	data, ok := event.Data.(models.EventData)
+	if !ok || data.TaskID != "task_1" || len(data.Indexes) != 1 || data.Indexes[0] != 2 {
+		t.Fatalf("Error: unexpected event %+v", event)
+	}
+
+	if _, err := Decode("task.unknown", []byte(`{}`)); !errors.Is(err, ErrUnknownTopic) {
+		t.Fatalf("Error: got %v, want %v", err, ErrUnknownTopic)
+	}
+}
+
+func TestGroup(t *testing.T) {
+	bus := NewEventBus()
+
+	first, _ := bus.SubscribeWith(Options{Group: "downloader"})
+	second, _ := bus.SubscribeWith(Options{Group: "downloader"})
+	all := bus.Subscribe()
+
+	for i := 0; i < 10; i++ {
+		bus.Publish(Event{Type: EventCreateTask, Data: i})
+	}
+
+	if got := len(first.C) + len(second.C); got != 10 {
+		t.Fatalf("Error: group received %d events, want 10", got)
+	}
+	if len(all.C) != 10 {
+		t.Fatalf("Error: subscriber without a group received %d events, want 10", len(all.C))
+	}
+}
@@ -0,0 +1,270 @@
+package eventbus
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+var (
+	_ EventBus = (*Local)(nil)
+	_ EventBus = (*NATS)(nil)
+)
+
+// NATSConfig of the JetStream stream the events are kept in.
+type NATSConfig struct {
+	URL string
+	// Stream is the name of the stream, it is created or updated on connect
+	Stream string
+	// Subject prefixes the topics: the event of task.created is published to <Subject>.task.created
+	Subject string
+	// MaxAge is how long an event is kept in the stream, 0 keeps it until the limits of the server
+	MaxAge time.Duration
+	// Timeout of a publish and of the requests to the JetStream API
+	Timeout time.Duration
+	// AckWait is how long an event of a ManualAck subscription waits for Event.Ack before it is delivered again,
+	// 0 keeps the default of the server
+	AckWait time.Duration
+}
+
+// NATS is the EventBus over a NATS JetStream stream, it connects processes: an event is kept in the stream
+// and delivered to the subscribers of every process.
+//
+// A group is a durable consumer: its subscribers share the events, events published while none of them
+// is running are delivered once one subscribes, and an event taken by a subscriber that closed before
+// queueing it is delivered again. With ManualAck an event is delivered again until the subscriber acknowledges it,
+// also when the process stopped with the event in its queue. Subscribers without a group only receive
+// the events published after they subscribed.
+type NATS struct {
+	config   NATSConfig
+	defaults Options
+	logger   *slog.Logger
+
+	conn   *nats.Conn
+	js     jetstream.JetStream
+	stream jetstream.Stream
+
+	mu     sync.Mutex
+	closed bool
+	subs   map[*Subscription]jetstream.ConsumeContext
+}
+
+// NewNATS connects to the server and creates the stream of the events.
+func NewNATS(config NATSConfig, defaults Options, logger *slog.Logger) (*NATS, error) {
+	const op = "TaskDownloader.lib.eventbus.NewNATS"
+
+	defaults, err := defaults.withDefaults(Options{Buffer: DefaultBuffer, Overflow: OverflowBlock})
+	if err != nil {
+		return nil, err
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 5 * time.Second
+	}
+
+	conn, err := nats.Connect(config.URL, nats.Name("TaskDownloader"), nats.MaxReconnects(-1))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	js, err := jetstream.New(conn)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), config.Timeout)
+	defer cancel()
+
+	stream, err := js.CreateOrUpdateStream(ctx, jetstream.StreamConfig{
+		Name:     config.Stream,
+		Subjects: []string{config.Subject + ".>"},
+		MaxAge:   config.MaxAge,
+		Storage:  jetstream.FileStorage,
+	})
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &NATS{
+		config:   config,
+		defaults: defaults,
+		logger:   logger,
+		conn:     conn,
+		js:       js,
+		stream:   stream,
+		subs:     make(map[*Subscription]jetstream.ConsumeContext),
+	}, nil
+}
+
+// Publish returns once the stream has stored the event. The data is sent as JSON,
+// subscribers decode it to the type registered for the topic. The offset of the event is not sent.
+func (n *NATS) Publish(event Event) error {
+	const op = "TaskDownloader.lib.eventbus.NATS.Publish"
+
+	n.mu.Lock()
+	closed := n.closed
+	n.mu.Unlock()
+	if closed {
+		return ErrClosed
+	}
+
+	data, err := json.Marshal(event.Data)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), n.config.Timeout)
+	defer cancel()
+
+	if _, err := n.js.Publish(ctx, n.subject(event.Type), data); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (n *NATS) Subscribe(topics ...Topic) *Subscription {
+	const op = "TaskDownloader.lib.eventbus.NATS.Subscribe"
+
+	sub, err := n.SubscribeWith(Options{}, topics...)
+	if err != nil {
+		n.logger.Error("Failed to subscribe",
+			slog.String("op", op),
+			slog.String("err", err.Error()),
+		)
+		return closedSubscription()
+	}
+
+	return sub
+}
+
+func (n *NATS) SubscribeWith(options Options, topics ...Topic) (*Subscription, error) {
+	const op = "TaskDownloader.lib.eventbus.NATS.SubscribeWith"
+
+	options, err := options.withDefaults(n.defaults)
+	if err != nil {
+		return nil, err
+	}
+
+	sub := newSubscription(options, topics)
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.closed {
+		sub.close()
+		return sub, nil
+	}
+
+	config := jetstream.ConsumerConfig{
+		AckPolicy:     jetstream.AckExplicitPolicy,
+		DeliverPolicy: jetstream.DeliverNewPolicy,
+		// a blocked subscriber holds at most its queue and the event it waits with
+		MaxAckPending:     options.Buffer + 1,
+		InactiveThreshold: time.Minute,
+	}
+	if options.Group != "" {
+		config.Durable = options.Group
+		config.DeliverPolicy = jetstream.DeliverAllPolicy
+		config.InactiveThreshold = 0
+	}
+	if options.ManualAck {
+		config.AckWait = n.config.AckWait
+	}
+	for _, topic := range topics {
+		config.FilterSubjects = append(config.FilterSubjects, n.subject(topic))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), n.config.Timeout)
+	defer cancel()
+
+	consumer, err := n.stream.CreateOrUpdateConsumer(ctx, config)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	consume, err := consumer.Consume(func(msg jetstream.Msg) {
+		n.deliver(sub, options.ManualAck, msg)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	n.subs[sub] = consume
+
+	return sub, nil
+}
+
+// deliver acknowledges the message once the subscription took it, or leaves it to Event.Ack with manualAck.
+// A message of a closed subscription goes back to the stream. The data that cannot be decoded
+// is delivered as json.RawMessage, the subscriber decides what to do with it.
+func (n *NATS) deliver(sub *Subscription, manualAck bool, msg jetstream.Msg) {
+	const op = "TaskDownloader.lib.eventbus.NATS.deliver"
+
+	topic := Topic(strings.TrimPrefix(msg.Subject(), n.config.Subject+"."))
+
+	event, err := Decode(topic, msg.Data())
+	if err != nil {
+		n.logger.Error("Failed to decode event",
+			slog.String("op", op),
+			slog.String("subject", msg.Subject()),
+			slog.String("err", err.Error()),
+		)
+		event = Event{Type: topic, Data: json.RawMessage(msg.Data())}
+	}
+	if manualAck {
+		event.ack = func() { msg.Ack() }
+	}
+
+	if !sub.push(event) {
+		msg.Nak()
+		return
+	}
+	if !manualAck {
+		msg.Ack()
+	}
+}
+
+func (n *NATS) Unsubscribe(sub *Subscription) {
+	n.mu.Lock()
+	consume, ok := n.subs[sub]
+	delete(n.subs, sub)
+	n.mu.Unlock()
+
+	// closed first, it releases a handler blocked on the full queue
+	sub.close()
+	if ok {
+		consume.Stop()
+	}
+}
+
+// Close unsubscribes everyone and closes the connection, the durable consumers of the groups stay on the server.
+func (n *NATS) Close() {
+	n.mu.Lock()
+	if n.closed {
+		n.mu.Unlock()
+		return
+	}
+	n.closed = true
+	subs := n.subs
+	n.subs = nil
+	n.mu.Unlock()
+
+	for sub, consume := range subs {
+		sub.close()
+		consume.Stop()
+	}
+
+	n.conn.Close()
+}
+
+func (n *NATS) subject(topic Topic) string {
+	return n.config.Subject + "." + string(topic)
+}
@@ -0,0 +1,184 @@
+package eventbus
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+
+	"github.com/LashkaPashka/TaskDownloader/internal/models"
+)
+
+var logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+// runServer starts an in-process NATS server with JetStream.
+func runServer(t *testing.T) *server.Server {
+	t.Helper()
+
+	srv, err := server.NewServer(&server.Options{
+		Host:      "127.0.0.1",
+		Port:      server.RANDOM_PORT,
+		JetStream: true,
+		StoreDir:  t.TempDir(),
+		NoLog:     true,
+		NoSigs:    true,
+	})
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	go srv.Start()
+	if !srv.ReadyForConnections(5 * time.Second) {
+		t.Fatalf("Error: nats server is not ready")
+	}
+	t.Cleanup(srv.Shutdown)
+
+	return srv
+}
+
+func newNATS(t *testing.T, srv *server.Server) *NATS {
+	t.Helper()
+
+	bus, err := NewNATS(NATSConfig{URL: srv.ClientURL(), Stream: "TASKS", Subject: "taskdownloader"}, Options{Buffer: 8}, logger)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	t.Cleanup(bus.Close)
+
+	return bus
+}
+
+func TestNATSGroup(t *testing.T) {
+	srv := runServer(t)
+
+	// the api node publishes before any worker is running
+	api := newNATS(t, srv)
+	created := models.EventData{ClientID: "client", TaskID: "task_1"}
+	if err := api.Publish(Event{Type: EventCreateTask, Data: created}); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	worker := newNATS(t, srv)
+	sub, err := worker.SubscribeWith(Options{Group: "downloader"}, EventCreateTask, EventUnfinishedTask)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	event := receive(t, sub)
+	if data, ok := event.Data.(models.EventData); event.Type != EventCreateTask || !ok || data.TaskID != "task_1" {
+		t.Fatalf("Error: unexpected event %+v", event)
+	}
+
+	unfinished := map[string][]models.File{"task_2": {{Index: 1, Url: "http://example.com/a.bin", Status: "queued"}}}
+	api.Publish(Event{Type: EventRetryTask, Data: created})
+	api.Publish(Event{Type: EventUnfinishedTask, Data: unfinished})
+
+	event = receive(t, sub)
+	if files, ok := event.Data.(map[string][]models.File); event.Type != EventUnfinishedTask || !ok || files["task_2"][0].Url != "http://example.com/a.bin" {
+		t.Fatalf("Error: unexpected event %+v", event)
+	}
+
+	// a restarted worker continues the group, the events it handled are not delivered again
+	worker.Close()
+	restarted := newNATS(t, srv)
+	sub, err = restarted.SubscribeWith(Options{Group: "downloader"}, EventCreateTask, EventUnfinishedTask)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	api.Publish(Event{Type: EventCreateTask, Data: models.EventData{ClientID: "client", TaskID: "task_3"}})
+	if event := receive(t, sub); event.Data.(models.EventData).TaskID != "task_3" {
+		t.Fatalf("Error: unexpected event %+v", event)
+	}
+}
+
+func TestNATSManualAck(t *testing.T) {
+	srv := runServer(t)
+
+	config := NATSConfig{URL: srv.ClientURL(), Stream: "TASKS", Subject: "taskdownloader", AckWait: 200 * time.Millisecond}
+	worker, err := NewNATS(config, Options{Buffer: 8}, logger)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	sub, err := worker.SubscribeWith(Options{Group: "downloader", ManualAck: true}, EventCreateTask)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	for _, taskID := range []string{"task_1", "task_2"} {
+		if err := worker.Publish(Event{Type: EventCreateTask, Data: models.EventData{TaskID: taskID}}); err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+	}
+
+	receive(t, sub).Ack()
+	// the worker stops before it handled the second event
+	receive(t, sub)
+	worker.Close()
+
+	restarted, err := NewNATS(config, Options{Buffer: 8}, logger)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	t.Cleanup(restarted.Close)
+
+	sub, err = restarted.SubscribeWith(Options{Group: "downloader", ManualAck: true}, EventCreateTask)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	event := receive(t, sub)
+	if event.Data.(models.EventData).TaskID != "task_2" {
+		t.Fatalf("Error: unexpected event %+v", event)
+	}
+	event.Ack()
+
+	select {
+	case event := <-sub.C:
+		t.Fatalf("Error: acknowledged event delivered again %+v", event)
+	case <-time.After(500 * time.Millisecond):
+	}
+}
+
+func TestNATSFanOut(t *testing.T) {
+	srv := runServer(t)
+	bus := newNATS(t, srv)
+
+	first := bus.Subscribe()
+	second := bus.Subscribe(EventCreateTask)
+
+	if err := bus.Publish(Event{Type: EventCreateTask, Data: models.EventData{TaskID: "task_1"}}); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	for _, sub := range []*Subscription{first, second} {
+		if event := receive(t, sub); event.Data.(models.EventData).TaskID != "task_1" {
+			t.Fatalf("Error: unexpected event %+v", event)
+		}
+	}
+
+	// a message of another publisher that does not decode
+	if _, err := bus.js.Publish(context.Background(), bus.subject(EventCreateTask), []byte(`{"task_id":`)); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	for _, sub := range []*Subscription{first, second} {
+		if event := receive(t, sub); event.Type != EventCreateTask || string(event.Data.(json.RawMessage)) != `{"task_id":` {
+			t.Fatalf("Error: unexpected event %+v", event)
+		}
+	}
+
+	bus.Unsubscribe(second)
+	if _, ok := <-second.C; ok {
+		t.Fatalf("Error: subscription is not closed")
+	}
+
+	bus.Close()
+	if err := bus.Publish(Event{Type: EventCreateTask}); err != ErrClosed {
+		t.Fatalf("Error: got %v, want %v", err, ErrClosed)
+	}
+}
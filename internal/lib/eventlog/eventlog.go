@@ -0,0 +1,325 @@
+package eventlog
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/LashkaPashka/TaskDownloader/internal/lib/atomicfile"
+)
+
+const (
+	recordsFile = "events.log"
+	offsetsFile = "offsets.json"
+
+	// compactAfter is how many acknowledged records are dropped from memory before the file is rewritten without them
+	compactAfter = 1000
+)
+
+var ErrCorrupted = errors.New("event log is corrupted")
+
+// Record is an event appended to the log, offsets grow by one starting from 1.
+type Record struct {
+	Offset    uint64          `json:"offset"`
+	Topic     string          `json:"topic"`
+	Data      json.RawMessage `json:"data"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// Log is an append-only file of events with the offsets of their consumers.
+// A record is kept until every consumer acknowledged it, the ones that were not are delivered again after a restart.
+//
+// The offset of a consumer only moves over records acknowledged without gaps,
+// so records handled out of order are not skipped when the process stops in between.
+type Log struct {
+	dir          string
+	compactAfter int
+
+	mu      sync.Mutex
+	file    *os.File
+	size    int64
+	next    uint64
+	records []Record
+	// offsets are the persisted offsets of the consumers, acked the records acknowledged after them
+	offsets map[string]uint64
+	acked   map[string]map[uint64]bool
+	dropped int
+}
+
+// Open reads the log in dir, the directory is created when missing.
+// A record cut short by a crash at the end of the file is discarded, it was never acknowledged to the writer.
+func Open(dir string) (*Log, error) {
+	const op = "TaskDownloader.lib.eventlog.Open"
+
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	l := &Log{
+		dir:          dir,
+		compactAfter: compactAfter,
+		next:         1,
+		offsets:      make(map[string]uint64),
+		acked:        make(map[string]map[uint64]bool),
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, offsetsFile))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &l.offsets); err != nil {
+			return nil, fmt.Errorf("%s: %w: %v", op, ErrCorrupted, err)
+		}
+	}
+	for _, offset := range l.offsets {
+		l.next = max(l.next, offset+1)
+	}
+
+	valid, err := l.load()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	path := filepath.Join(dir, recordsFile)
+	if err := os.Truncate(path, valid); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	l.file = file
+	l.size = valid
+
+	l.compact()
+
+	return l, nil
+}
+
+// load reads the records and returns the size of the file without a torn record at its end.
+func (l *Log) load() (int64, error) {
+	file, err := os.Open(filepath.Join(l.dir, recordsFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	var valid int64
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			// the last record was not written completely
+			return valid, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		var record Record
+		if err := json.Unmarshal(bytes.TrimSpace(line), &record); err != nil {
+			return 0, fmt.Errorf("%w: record after byte %d: %v", ErrCorrupted, valid, err)
+		}
+		valid += int64(len(line))
+
+		l.records = append(l.records, record)
+		l.next = max(l.next, record.Offset+1)
+	}
+}
+
+// Append writes the event to the disk and returns its record.
+func (l *Log) Append(topic string, data any) (Record, error) {
+	const op = "TaskDownloader.lib.eventlog.Append"
+
+	body, err := json.Marshal(data)
+	if err != nil {
+		return Record{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	record := Record{Offset: l.next, Topic: topic, Data: body, CreatedAt: time.Now().UTC()}
+
+	line, err := json.Marshal(&record)
+	if err != nil {
+		return Record{}, fmt.Errorf("%s: %w", op, err)
+	}
+	line = append(line, '\n')
+
+	_, err = l.file.Write(line)
+	if err == nil {
+		err = l.file.Sync()
+	}
+	if err != nil {
+		// the offset is given to the next record, a part of this one must not be read back with it
+		l.file.Truncate(l.size)
+		return Record{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	l.size += int64(len(line))
+	l.next++
+	l.records = append(l.records, record)
+
+	return record, nil
+}
+
+// Pending returns the records the consumer has not acknowledged yet, oldest first.
+func (l *Log) Pending(consumer string) []Record {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	offset := l.offsets[consumer]
+	acked := l.acked[consumer]
+
+	var pending []Record
+	for _, record := range l.records {
+		if record.Offset > offset && !acked[record.Offset] {
+			pending = append(pending, record)
+		}
+	}
+
+	return pending
+}
+
+// Offset is the last record the consumer handled together with all the records before it.
+func (l *Log) Offset(consumer string) uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.offsets[consumer]
+}
+
+// Ack marks the record as handled by the consumer. The offset of the consumer is saved when it moves.
+func (l *Log) Ack(consumer string, offset uint64) error {
+	const op = "TaskDownloader.lib.eventlog.Ack"
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	current := l.offsets[consumer]
+	if offset <= current {
+		return nil
+	}
+
+	acked := l.acked[consumer]
+	if acked == nil {
+		acked = make(map[uint64]bool)
+		l.acked[consumer] = acked
+	}
+	acked[offset] = true
+
+	// records before the first one in memory were acknowledged by every consumer already
+	base := l.next - 1
+	if len(l.records) > 0 {
+		base = l.records[0].Offset - 1
+	}
+	current = max(current, base)
+	moved := current
+	for acked[moved+1] {
+		moved++
+		delete(acked, moved)
+	}
+	if moved == l.offsets[consumer] {
+		return nil
+	}
+
+	l.offsets[consumer] = moved
+	if err := l.saveOffsets(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	l.compact()
+
+	return nil
+}
+
+// Close closes the file, the log must not be used after it.
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.file.Close()
+}
+
+// compact drops the records acknowledged by every consumer and rewrites the file once enough of them are dropped.
+// Nothing is dropped while no consumer has acknowledged a record.
+func (l *Log) compact() {
+	if len(l.offsets) == 0 {
+		return
+	}
+
+	var lowest uint64
+	first := true
+	for _, offset := range l.offsets {
+		if first || offset < lowest {
+			lowest = offset
+			first = false
+		}
+	}
+
+	n := 0
+	for n < len(l.records) && l.records[n].Offset <= lowest {
+		n++
+	}
+	l.records = l.records[n:]
+	l.dropped += n
+
+	if l.dropped < l.compactAfter {
+		return
+	}
+
+	// a failed rewrite leaves the old file, the dropped records are skipped by their offsets after a restart
+	if err := l.rewrite(); err == nil {
+		l.dropped = 0
+	}
+}
+
+func (l *Log) rewrite() error {
+	path := filepath.Join(l.dir, recordsFile)
+
+	var buf bytes.Buffer
+	for _, record := range l.records {
+		line, err := json.Marshal(&record)
+		if err != nil {
+			return err
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+
+	if err := atomicfile.Write(path, buf.Bytes()); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	l.file.Close()
+	l.file = file
+	l.size = int64(buf.Len())
+
+	return nil
+}
+
+func (l *Log) saveOffsets() error {
+	data, err := json.Marshal(l.offsets)
+	if err != nil {
+		return err
+	}
+
+	return atomicfile.Write(filepath.Join(l.dir, offsetsFile), data)
+}
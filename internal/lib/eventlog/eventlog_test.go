@@ -0,0 +1,138 @@
+package eventlog
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func offsets(records []Record) []uint64 {
+	result := make([]uint64, 0, len(records))
+	for _, record := range records {
+		result = append(result, record.Offset)
+	}
+	return result
+}
+
+func TestAckAndRedeliver(t *testing.T) {
+	dir := t.TempDir()
+
+	log, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	for _, task := range []string{"task_1", "task_2", "task_3"} {
+		if _, err := log.Append("task.created", map[string]string{"task_id": task}); err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+	}
+
+	// the second record is handled before the first one, the offset waits for the gap
+	log.Ack("downloader", 2)
+	if offset := log.Offset("downloader"); offset != 0 {
+		t.Fatalf("Error: offset moved over an unacknowledged record: %d", offset)
+	}
+	if pending := offsets(log.Pending("downloader")); len(pending) != 2 || pending[0] != 1 || pending[1] != 3 {
+		t.Fatalf("Error: unexpected pending records %v", pending)
+	}
+
+	log.Ack("downloader", 1)
+	if offset := log.Offset("downloader"); offset != 2 {
+		t.Fatalf("Error: got offset %d, want 2", offset)
+	}
+	log.Close()
+
+	reopened, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	defer reopened.Close()
+
+	pending := reopened.Pending("downloader")
+	if len(pending) != 1 || pending[0].Offset != 3 || string(pending[0].Data) != `{"task_id":"task_3"}` {
+		t.Fatalf("Error: unexpected records after restart %+v", pending)
+	}
+
+	record, err := reopened.Append("task.retry", nil)
+	if err != nil || record.Offset != 4 {
+		t.Fatalf("Error: got offset %d and %v, want 4", record.Offset, err)
+	}
+}
+
+func TestTornRecord(t *testing.T) {
+	dir := t.TempDir()
+
+	log, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	log.Append("task.created", "task_1")
+	log.Close()
+
+	// a crash in the middle of the second record
+	file, err := os.OpenFile(filepath.Join(dir, recordsFile), os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	file.WriteString(`{"offset":2,"topic":"task.cre`)
+	file.Close()
+
+	reopened, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	defer reopened.Close()
+
+	if pending := offsets(reopened.Pending("downloader")); len(pending) != 1 || pending[0] != 1 {
+		t.Fatalf("Error: unexpected pending records %v", pending)
+	}
+
+	record, err := reopened.Append("task.created", "task_2")
+	if err != nil || record.Offset != 2 {
+		t.Fatalf("Error: got offset %d and %v, want 2", record.Offset, err)
+	}
+	if _, err := Open(dir); err != nil {
+		t.Fatalf("Error: log with a replaced torn record: %v", err)
+	}
+}
+
+func TestCompact(t *testing.T) {
+	dir := t.TempDir()
+
+	log, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	log.compactAfter = 2
+
+	for i := 0; i < 4; i++ {
+		log.Append("task.created", i)
+	}
+	for offset := uint64(1); offset <= 3; offset++ {
+		if err := log.Ack("downloader", offset); err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+	}
+	log.Close()
+
+	data, err := os.ReadFile(filepath.Join(dir, recordsFile))
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if want := `"offset":4`; !strings.Contains(string(data), want) || strings.Contains(string(data), `"offset":1`) {
+		t.Fatalf("Error: file was not compacted: %s", data)
+	}
+
+	reopened, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	defer reopened.Close()
+
+	reopened.Ack("downloader", 4)
+	if record, _ := reopened.Append("task.created", 5); record.Offset != 5 {
+		t.Fatalf("Error: got offset %d after compaction, want 5", record.Offset)
+	}
+}
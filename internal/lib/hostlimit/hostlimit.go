@@ -0,0 +1,128 @@
+package hostlimit
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Limit of a single host. MaxConnections <= 0 means unlimited.
+type Limit struct {
+	MaxConnections int
+	MinDelay       time.Duration
+}
+
+// Limiter bounds the number of concurrent connections to a host
+// and spaces the starts of requests to the same host by MinDelay.
+// A nil Limiter does not limit anything.
+type Limiter struct {
+	defaults  Limit
+	overrides map[string]Limit
+
+	mu    sync.Mutex
+	hosts map[string]*host
+}
+
+type host struct {
+	sem       chan struct{}
+	nextStart time.Time
+}
+
+func New(defaults Limit, overrides map[string]Limit) *Limiter {
+	normalized := make(map[string]Limit, len(overrides))
+	for name, limit := range overrides {
+		normalized[strings.ToLower(name)] = limit
+	}
+
+	return &Limiter{
+		defaults:  defaults,
+		overrides: normalized,
+		hosts:     make(map[string]*host),
+	}
+}
+
+// Host returns the key used for limiting requests to rawURL.
+func Host(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+
+	return strings.ToLower(u.Hostname())
+}
+
+// Limit returns the limit applied to the host.
+func (l *Limiter) Limit(name string) Limit {
+	if l == nil {
+		return Limit{}
+	}
+
+	if limit, ok := l.overrides[name]; ok {
+		return limit
+	}
+
+	return l.defaults
+}
+
+// Acquire waits for a free connection slot of the host and for its politeness delay.
+// The returned release must be called once the connection is not used anymore.
+func (l *Limiter) Acquire(ctx context.Context, name string) (release func(), err error) {
+	if l == nil {
+		return func() {}, nil
+	}
+
+	limit := l.Limit(name)
+
+	l.mu.Lock()
+	h, ok := l.hosts[name]
+	if !ok {
+		h = &host{}
+		if limit.MaxConnections > 0 {
+			h.sem = make(chan struct{}, limit.MaxConnections)
+		}
+		l.hosts[name] = h
+	}
+	l.mu.Unlock()
+
+	if h.sem != nil {
+		select {
+		case h.sem <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	release = func() {
+		if h.sem != nil {
+			<-h.sem
+		}
+	}
+
+	if limit.MinDelay > 0 {
+		// reserve the next start time so that concurrent callers queue up behind each other
+		l.mu.Lock()
+		now := time.Now()
+		start := h.nextStart
+		if start.Before(now) {
+			start = now
+		}
+		h.nextStart = start.Add(limit.MinDelay)
+		l.mu.Unlock()
+
+		if wait := time.Until(start); wait > 0 {
+			timer := time.NewTimer(wait)
+			defer timer.Stop()
+
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				release()
+				return nil, ctx.Err()
+			}
+		}
+	}
+
+	return release, nil
+}
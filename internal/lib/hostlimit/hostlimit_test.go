@@ -0,0 +1,92 @@
+package hostlimit
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMaxConnections(t *testing.T) {
+	l := New(Limit{MaxConnections: 2}, nil)
+
+	var running, peak atomic.Int32
+	var wg sync.WaitGroup
+
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			release, err := l.Acquire(context.Background(), "example.com")
+			if err != nil {
+				t.Errorf("Error: %v", err)
+				return
+			}
+			defer release()
+
+			n := running.Add(1)
+			for {
+				p := peak.Load()
+				if n <= p || peak.CompareAndSwap(p, n) {
+					break
+				}
+			}
+			time.Sleep(5 * time.Millisecond)
+			running.Add(-1)
+		}()
+	}
+	wg.Wait()
+
+	if peak.Load() > 2 {
+		t.Fatalf("Error: %d connections at once, limit is 2", peak.Load())
+	}
+}
+
+func TestMinDelay(t *testing.T) {
+	l := New(Limit{}, map[string]Limit{"Slow.example.com": {MinDelay: 20 * time.Millisecond}})
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		release, err := l.Acquire(context.Background(), "slow.example.com")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		release()
+	}
+
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+		t.Fatalf("Error: 3 requests took %v, expected at least 40ms", elapsed)
+	}
+
+	// other hosts are not delayed
+	start = time.Now()
+	for i := 0; i < 3; i++ {
+		release, _ := l.Acquire(context.Background(), "fast.example.com")
+		release()
+	}
+	if elapsed := time.Since(start); elapsed > 20*time.Millisecond {
+		t.Fatalf("Error: unlimited host was delayed for %v", elapsed)
+	}
+}
+
+func TestAcquireCancelled(t *testing.T) {
+	l := New(Limit{MaxConnections: 1}, nil)
+
+	release, _ := l.Acquire(context.Background(), "example.com")
+	defer release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if _, err := l.Acquire(ctx, "example.com"); err == nil {
+		t.Fatalf("Error: expected context error")
+	}
+}
+
+func TestHost(t *testing.T) {
+	if got := Host("https://Echo.EPA.gov:443/files/a.zip"); got != "echo.epa.gov" {
+		t.Fatalf("Error: got %q", got)
+	}
+}
@@ -0,0 +1,163 @@
+package hub
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrUnknownEventID is returned for an id after the last event the hub published.
+var ErrUnknownEventID = errors.New("unknown event id")
+
+// Event is numbered by the hub in the order it was published. The numbers of a hub start
+// at its creation time in microseconds: they continue above the ids of the hubs before a restart,
+// and stay exact as json numbers (below 2^53).
+type Event struct {
+	ID       uint64
+	Type     string
+	TaskID   string
+	ClientID string
+	Data     any
+}
+
+// Filter selects the events of a subscription, zero fields do not filter.
+type Filter struct {
+	TaskID   string
+	ClientID string
+}
+
+func (f Filter) match(e Event) bool {
+	return (f.TaskID == "" || f.TaskID == e.TaskID) && (f.ClientID == "" || f.ClientID == e.ClientID)
+}
+
+// Hub fans events out to subscribers and keeps the last of them for subscribers that reconnect.
+// A subscriber that does not keep up is dropped rather than slowing down the publisher,
+// it can subscribe again after the last event it received and get the missed ones replayed.
+// A nil Hub drops every event.
+type Hub struct {
+	history int
+	buffer  int
+
+	mu     sync.Mutex
+	lastID uint64
+	events []Event
+	subs   map[*Subscription]struct{}
+	closed bool
+}
+
+// Subscription receives the events matching its filter on C.
+// C is closed when the subscription is closed or dropped by the hub.
+type Subscription struct {
+	C <-chan Event
+
+	c      chan Event
+	filter Filter
+	hub    *Hub
+}
+
+// New keeps the last history events and buffers up to buffer events per subscriber.
+func New(history, buffer int) *Hub {
+	return &Hub{
+		history: history,
+		buffer:  buffer,
+		lastID:  uint64(time.Now().UnixMicro()),
+		subs:    make(map[*Subscription]struct{}),
+	}
+}
+
+// Publish numbers the event and sends it to the matching subscribers.
+func (h *Hub) Publish(e Event) Event {
+	if h == nil {
+		return e
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.lastID++
+	e.ID = h.lastID
+
+	if h.history > 0 {
+		if len(h.events) == h.history {
+			copy(h.events, h.events[1:])
+			h.events = h.events[:len(h.events)-1]
+		}
+		h.events = append(h.events, e)
+	}
+
+	for sub := range h.subs {
+		if !sub.filter.match(e) {
+			continue
+		}
+
+		select {
+		case sub.c <- e:
+		default:
+			h.drop(sub)
+		}
+	}
+
+	return e
+}
+
+// Subscribe returns the kept events matching the filter published after the event afterID
+// and a subscription to the following ones. No event is lost or repeated between the two.
+// An id of a hub before a restart is lower than the ids of this one, all the kept events are after it.
+// An id this hub has not published yet is ErrUnknownEventID.
+func (h *Hub) Subscribe(filter Filter, afterID uint64) ([]Event, *Subscription, error) {
+	c := make(chan Event, h.buffer)
+	sub := &Subscription{C: c, c: c, filter: filter, hub: h}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if afterID > h.lastID {
+		return nil, nil, ErrUnknownEventID
+	}
+
+	var replay []Event
+	for _, e := range h.events {
+		if e.ID > afterID && filter.match(e) {
+			replay = append(replay, e)
+		}
+	}
+
+	if h.closed {
+		close(c)
+		return replay, sub, nil
+	}
+	h.subs[sub] = struct{}{}
+
+	return replay, sub, nil
+}
+
+// Close stops the subscription, it is safe to call more than once.
+func (s *Subscription) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+
+	if _, ok := s.hub.subs[s]; ok {
+		s.hub.drop(s)
+	}
+}
+
+// Close closes every subscription, later ones are closed right away.
+func (h *Hub) Close() {
+	if h == nil {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.closed = true
+	for sub := range h.subs {
+		h.drop(sub)
+	}
+}
+
+// drop must be called with mu held.
+func (h *Hub) drop(sub *Subscription) {
+	delete(h.subs, sub)
+	close(sub.c)
+}
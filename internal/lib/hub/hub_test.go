@@ -0,0 +1,128 @@
+package hub
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func receive(t *testing.T, sub *Subscription) Event {
+	select {
+	case e, ok := <-sub.C:
+		if !ok {
+			t.Fatalf("Error: subscription was closed")
+		}
+		return e
+	default:
+		t.Fatalf("Error: no event was sent")
+	}
+
+	return Event{}
+}
+
+func TestPublishFilters(t *testing.T) {
+	h := New(10, 10)
+	start := h.lastID
+
+	_, task, _ := h.Subscribe(Filter{TaskID: "a"}, 0)
+	_, client, _ := h.Subscribe(Filter{ClientID: "c2"}, 0)
+
+	h.Publish(Event{Type: "x", TaskID: "a", ClientID: "c1"})
+	h.Publish(Event{Type: "x", TaskID: "b", ClientID: "c2"})
+
+	if e := receive(t, task); e.ID != start+1 || e.TaskID != "a" {
+		t.Fatalf("Error: unexpected event %+v", e)
+	}
+	if e := receive(t, client); e.ID != start+2 || e.TaskID != "b" {
+		t.Fatalf("Error: unexpected event %+v", e)
+	}
+	if len(task.C) != 0 || len(client.C) != 0 {
+		t.Fatalf("Error: events of other tasks were sent")
+	}
+}
+
+func TestReplayAfterID(t *testing.T) {
+	h := New(3, 10)
+	start := h.lastID
+
+	for _, taskID := range []string{"a", "b", "a", "a", "a"} {
+		h.Publish(Event{Type: "x", TaskID: taskID})
+	}
+
+	// only the last three events are kept
+	replay, sub, err := h.Subscribe(Filter{TaskID: "a"}, start+3)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	defer sub.Close()
+
+	if len(replay) != 2 || replay[0].ID != start+4 || replay[1].ID != start+5 {
+		t.Fatalf("Error: unexpected replay %+v", replay)
+	}
+
+	h.Publish(Event{Type: "x", TaskID: "a"})
+	if e := receive(t, sub); e.ID != start+6 {
+		t.Fatalf("Error: unexpected event %+v", e)
+	}
+}
+
+func TestSlowSubscriberIsDropped(t *testing.T) {
+	h := New(0, 1)
+
+	_, slow, _ := h.Subscribe(Filter{}, 0)
+	h.Publish(Event{Type: "x"})
+	h.Publish(Event{Type: "x"})
+
+	receive(t, slow)
+	if _, ok := <-slow.C; ok {
+		t.Fatalf("Error: slow subscriber was not dropped")
+	}
+
+	slow.Close()
+}
+
+func TestClose(t *testing.T) {
+	h := New(10, 10)
+
+	_, sub, _ := h.Subscribe(Filter{}, 0)
+	h.Close()
+	if _, ok := <-sub.C; ok {
+		t.Fatalf("Error: subscription is open after close")
+	}
+
+	_, late, _ := h.Subscribe(Filter{}, 0)
+	if _, ok := <-late.C; ok {
+		t.Fatalf("Error: subscription to a closed hub is open")
+	}
+
+	var nilHub *Hub
+	nilHub.Publish(Event{})
+	nilHub.Close()
+}
+
+func TestIDsContinueAfterRestart(t *testing.T) {
+	before := New(10, 10)
+	before.Publish(Event{Type: "x", TaskID: "a"})
+	last := before.Publish(Event{Type: "x", TaskID: "a"})
+
+	// the service restarted, the client reconnects with the last id it received
+	time.Sleep(time.Millisecond)
+	h := New(10, 10)
+	first := h.Publish(Event{Type: "x", TaskID: "a"})
+	if first.ID <= last.ID {
+		t.Fatalf("Error: id %d after a restart is not above %d", first.ID, last.ID)
+	}
+
+	replay, sub, err := h.Subscribe(Filter{TaskID: "a"}, last.ID)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	defer sub.Close()
+	if len(replay) != 1 || replay[0].ID != first.ID {
+		t.Fatalf("Error: unexpected replay %+v", replay)
+	}
+
+	if _, _, err := h.Subscribe(Filter{TaskID: "a"}, first.ID+1); !errors.Is(err, ErrUnknownEventID) {
+		t.Fatalf("Error: got %v, want %v", err, ErrUnknownEventID)
+	}
+}
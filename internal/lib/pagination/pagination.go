@@ -0,0 +1,135 @@
+package pagination
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/LashkaPashka/TaskDownloader/internal/models"
+)
+
+const (
+	DefaultLimit = 50
+	MaxLimit     = 500
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Cursor points at the last task of a page. Tasks are ordered by creation time and id,
+// so the next page starts right after it even if tasks were added in the meantime.
+type Cursor struct {
+	CreatedAt time.Time `json:"created_at"`
+	ID        string    `json:"id"`
+}
+
+func Encode(task models.Task) string {
+	raw, _ := json.Marshal(Cursor{CreatedAt: task.CreatedAt, ID: task.ID})
+
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// Decode returns the zero cursor for an empty string.
+func Decode(value string) (Cursor, error) {
+	var cursor Cursor
+	if value == "" {
+		return cursor, nil
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return cursor, ErrInvalidCursor
+	}
+	if err := json.Unmarshal(raw, &cursor); err != nil || cursor.ID == "" {
+		return cursor, ErrInvalidCursor
+	}
+
+	return cursor, nil
+}
+
+// Limit clamps the page size asked for by the client.
+func Limit(limit int) int {
+	if limit <= 0 {
+		return DefaultLimit
+	}
+
+	return min(limit, MaxLimit)
+}
+
+// Match tells whether the task passes the filter, the cursor is not checked.
+func Match(task models.Task, filter models.TaskFilter) bool {
+	if filter.ClientID != "" && task.ClientID != filter.ClientID {
+		return false
+	}
+	if filter.Status != "" && task.Status != filter.Status {
+		return false
+	}
+	if !filter.CreatedFrom.IsZero() && task.CreatedAt.Before(filter.CreatedFrom) {
+		return false
+	}
+	if !filter.CreatedTo.IsZero() && !task.CreatedAt.Before(filter.CreatedTo) {
+		return false
+	}
+	if filter.URL != "" {
+		needle := strings.ToLower(filter.URL)
+		return slices.ContainsFunc(task.File, func(file models.File) bool {
+			return strings.Contains(strings.ToLower(file.Url), needle)
+		})
+	}
+
+	return true
+}
+
+// compare orders tasks by creation time and id, ascending.
+func compare(a, b Cursor) int {
+	if c := a.CreatedAt.Compare(b.CreatedAt); c != 0 {
+		return c
+	}
+
+	return strings.Compare(a.ID, b.ID)
+}
+
+// Page filters, sorts and cuts the tasks of a storage that keeps all of them in memory.
+func Page(tasks []models.Task, filter models.TaskFilter) (models.TaskPage, error) {
+	cursor, err := Decode(filter.Cursor)
+	if err != nil {
+		return models.TaskPage{}, err
+	}
+
+	sign := -1
+	if filter.Ascending {
+		sign = 1
+	}
+
+	var matched []models.Task
+	for _, task := range tasks {
+		if !Match(task, filter) {
+			continue
+		}
+		if filter.Cursor != "" && sign*compare(Cursor{CreatedAt: task.CreatedAt, ID: task.ID}, cursor) <= 0 {
+			continue
+		}
+		matched = append(matched, task)
+	}
+
+	slices.SortFunc(matched, func(a, b models.Task) int {
+		return sign * compare(Cursor{CreatedAt: a.CreatedAt, ID: a.ID}, Cursor{CreatedAt: b.CreatedAt, ID: b.ID})
+	})
+
+	return Cut(matched, filter.Limit), nil
+}
+
+// Cut keeps the first limit tasks of sorted ones, a storage fetching limit+1 tasks
+// learns from the extra one that there is a next page.
+func Cut(tasks []models.Task, limit int) models.TaskPage {
+	limit = Limit(limit)
+	if len(tasks) <= limit {
+		return models.TaskPage{Tasks: tasks}
+	}
+
+	tasks = tasks[:limit]
+
+	return models.TaskPage{Tasks: tasks, NextCursor: Encode(tasks[limit-1])}
+}
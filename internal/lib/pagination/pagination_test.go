@@ -0,0 +1,91 @@
+package pagination
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/LashkaPashka/TaskDownloader/internal/models"
+)
+
+func testTasks() []models.Task {
+	base := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	var tasks []models.Task
+	for i := 0; i < 7; i++ {
+		tasks = append(tasks, models.Task{
+			ID:        fmt.Sprintf("task_%d", i),
+			ClientID:  []string{"a", "b"}[i%2],
+			Status:    "queued",
+			CreatedAt: base.Add(time.Duration(i/2) * time.Hour),
+			File:      []models.File{{Index: 1, Url: fmt.Sprintf("https://example.com/File_%d.zip", i)}},
+		})
+	}
+
+	return tasks
+}
+
+func TestPageWalksAllTasks(t *testing.T) {
+	tasks := testTasks()
+
+	for _, ascending := range []bool{true, false} {
+		filter := models.TaskFilter{Limit: 3, Ascending: ascending}
+
+		var seen []string
+		for {
+			page, err := Page(tasks, filter)
+			if err != nil {
+				t.Fatalf("Error: %v", err)
+			}
+			for _, task := range page.Tasks {
+				seen = append(seen, task.ID)
+			}
+			if page.NextCursor == "" {
+				break
+			}
+			filter.Cursor = page.NextCursor
+		}
+
+		if len(seen) != len(tasks) {
+			t.Fatalf("Error: ascending %v walked %v", ascending, seen)
+		}
+		// tasks created at the same time are ordered by id
+		want := "task_0"
+		if !ascending {
+			want = "task_6"
+		}
+		if seen[0] != want {
+			t.Fatalf("Error: ascending %v starts with %s, want %s", ascending, seen[0], want)
+		}
+	}
+}
+
+func TestPageFilters(t *testing.T) {
+	tasks := testTasks()
+	base := tasks[0].CreatedAt
+
+	page, err := Page(tasks, models.TaskFilter{
+		ClientID:    "a",
+		CreatedFrom: base.Add(time.Hour),
+		CreatedTo:   base.Add(3 * time.Hour),
+	})
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	// task_2 and task_4 of client a were created in the second and the third hour
+	if len(page.Tasks) != 2 || page.Tasks[0].ID != "task_4" || page.Tasks[1].ID != "task_2" {
+		t.Fatalf("Error: unexpected page %+v", page.Tasks)
+	}
+
+	page, _ = Page(tasks, models.TaskFilter{URL: "file_5"})
+	if len(page.Tasks) != 1 || page.Tasks[0].ID != "task_5" {
+		t.Fatalf("Error: url filter returned %+v", page.Tasks)
+	}
+}
+
+func TestInvalidCursor(t *testing.T) {
+	if _, err := Page(testTasks(), models.TaskFilter{Cursor: "not a cursor"}); !errors.Is(err, ErrInvalidCursor) {
+		t.Fatalf("Error: got %v, want %v", err, ErrInvalidCursor)
+	}
+}
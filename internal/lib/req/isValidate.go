@@ -1,7 +1,9 @@
 package req
 
 import (
+	"encoding/hex"
 	"log/slog"
+	"strconv"
 
 	"github.com/go-playground/validator/v10"
 )
@@ -11,6 +13,8 @@ func isValid[T any](payload T, logger *slog.Logger) error {
 	const op = "AuthService.pkg.req.isValidate.go"
 
 	validate := validator.New()
+	validate.RegisterValidation("hexdigest", isHexDigest)
+
 	err := validate.Struct(payload)
 	
 	if err != nil {
@@ -22,4 +26,20 @@ func isValid[T any](payload T, logger *slog.Logger) error {
 	}
 
 	return nil
-}
\ No newline at end of file
+}
+
+// isHexDigest checks that the field is a hex digest of as many characters as the param says.
+func isHexDigest(fl validator.FieldLevel) bool {
+	size, err := strconv.Atoi(fl.Param())
+	if err != nil {
+		return false
+	}
+
+	digest := fl.Field().String()
+	if len(digest) != size {
+		return false
+	}
+
+	_, err = hex.DecodeString(digest)
+	return err == nil
+}
@@ -0,0 +1,46 @@
+package req
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/LashkaPashka/TaskDownloader/internal/payload"
+)
+
+func TestChecksumValidation(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	cases := []struct {
+		file  string
+		valid bool
+	}{
+		{`"https://example.com/a.zip"`, true},
+		{`{"url": "https://example.com/a.zip", "sha256": "9F86D081884C7D659A2FEAA0C55AD015A3BF4F1B2B0B822CD15D6C15B0F00A08"}`, true},
+		{`{"url": "https://example.com/a.zip", "sha1": "a94a8fe5ccb19ba61c4c0873d391e987982fbbd3"}`, true},
+		{`{"url": "https://example.com/a.zip", "md5": "098f6bcd4621d373cade4e832627b4f6"}`, true},
+		{`{"url": "https://example.com/a.zip", "sha256": "098f6bcd4621d373cade4e832627b4f6"}`, false},
+		{`{"url": "https://example.com/a.zip", "md5": "zz8f6bcd4621d373cade4e832627b4f6"}`, false},
+		{`{"url": "https://example.com/a.zip", "sha1": "0x4a8fe5ccb19ba61c4c0873d391e987982fbbd3"}`, false},
+		{`"not a url"`, false},
+		{`{"url": "example.com/a.zip", "md5": "098f6bcd4621d373cade4e832627b4f6"}`, false},
+		{`{"sha256": "9F86D081884C7D659A2FEAA0C55AD015A3BF4F1B2B0B822CD15D6C15B0F00A08"}`, false},
+	}
+
+	for _, c := range cases {
+		var body payload.SaveTaskRequest
+		if err := json.Unmarshal([]byte(`{"client_id": "client", "urls": [`+c.file+`]}`), &body); err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+
+		if err := isValid(body, logger); (err == nil) != c.valid {
+			t.Fatalf("Error: %s validated with %v, want valid=%v", c.file, err, c.valid)
+		}
+
+		appendBody := payload.AppendFilesRequest{Urls: body.Urls}
+		if err := isValid(appendBody, logger); (err == nil) != c.valid {
+			t.Fatalf("Error: appended %s validated with %v, want valid=%v", c.file, err, c.valid)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package retry
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	p := Policy{MaxAttempts: 5, BaseBackoff: time.Second, MaxBackoff: 5 * time.Second}
+
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	for i, w := range want {
+		if got := p.Backoff(i + 1); got != w {
+			t.Fatalf("Error: attempt %d backoff %v, want %v", i+1, got, w)
+		}
+	}
+}
+
+func TestBackoffJitter(t *testing.T) {
+	p := Policy{BaseBackoff: time.Second, MaxBackoff: time.Minute, Jitter: 0.5}
+
+	for i := 0; i < 100; i++ {
+		got := p.Backoff(1)
+		if got < 500*time.Millisecond || got > 1500*time.Millisecond {
+			t.Fatalf("Error: backoff %v out of jitter range", got)
+		}
+	}
+}
+
+func TestExhausted(t *testing.T) {
+	p := Policy{MaxAttempts: 3}
+
+	if p.Exhausted(2) || !p.Exhausted(3) {
+		t.Fatalf("Error: unexpected exhaustion")
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2025, 9, 26, 12, 0, 0, 0, time.UTC)
+
+	if got := ParseRetryAfter("120", now); got != 2*time.Minute {
+		t.Fatalf("Error: got %v, want 2m", got)
+	}
+
+	date := now.Add(30 * time.Second).Format(http.TimeFormat)
+	if got := ParseRetryAfter(date, now); got != 30*time.Second {
+		t.Fatalf("Error: got %v, want 30s", got)
+	}
+
+	if got := ParseRetryAfter("soon", now); got != 0 {
+		t.Fatalf("Error: got %v, want 0", got)
+	}
+}
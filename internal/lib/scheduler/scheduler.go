@@ -0,0 +1,182 @@
+package scheduler
+
+import "sync"
+
+// Job is a unit of work belonging to a task.
+type Job struct {
+	TaskID string
+	// Host the job connects to, jobs of a host at its limit wait in the queue.
+	Host string
+	Run  func()
+}
+
+// Scheduler runs jobs on a fixed number of workers. Tasks are served round-robin,
+// so a task with many files does not hold back the tasks submitted after it,
+// no task runs more than perTask jobs and no host more than perHost(host) jobs at once.
+type Scheduler struct {
+	mu   sync.Mutex
+	cond *sync.Cond
+
+	perTask int
+	perHost func(host string) int
+	queues  map[string][]Job
+	// order is the round-robin ring of tasks having queued jobs
+	order       []string
+	running     map[string]int
+	hostRunning map[string]int
+	closed      bool
+}
+
+// New starts workers goroutines. perTask <= 0 means no per-task limit,
+// perHost may be nil or return <= 0 for hosts without a limit.
+func New(workers, perTask int, perHost func(host string) int) *Scheduler {
+	if workers < 1 {
+		workers = 1
+	}
+
+	s := &Scheduler{
+		perTask:     perTask,
+		perHost:     perHost,
+		queues:      make(map[string][]Job),
+		running:     make(map[string]int),
+		hostRunning: make(map[string]int),
+	}
+	s.cond = sync.NewCond(&s.mu)
+
+	for i := 0; i < workers; i++ {
+		go s.work()
+	}
+
+	return s
+}
+
+// Submit queues the job, it never blocks.
+func (s *Scheduler) Submit(job Job) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return
+	}
+
+	if len(s.queues[job.TaskID]) == 0 {
+		s.order = append(s.order, job.TaskID)
+	}
+	s.queues[job.TaskID] = append(s.queues[job.TaskID], job)
+
+	s.cond.Signal()
+}
+
+// Close stops the workers once their current jobs are done, queued jobs are dropped.
+func (s *Scheduler) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closed = true
+	s.queues = make(map[string][]Job)
+	s.order = nil
+	s.cond.Broadcast()
+}
+
+// Cancel drops the queued jobs of the task and returns how many were dropped, running jobs are not affected.
+func (s *Scheduler) Cancel(taskID string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	dropped := len(s.queues[taskID])
+	if dropped == 0 {
+		return 0
+	}
+
+	delete(s.queues, taskID)
+	for i, id := range s.order {
+		if id == taskID {
+			s.order = append(s.order[:i:i], s.order[i+1:]...)
+			break
+		}
+	}
+
+	return dropped
+}
+
+// Queued returns the number of jobs of the task waiting for a worker.
+func (s *Scheduler) Queued(taskID string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.queues[taskID])
+}
+
+func (s *Scheduler) work() {
+	for {
+		s.mu.Lock()
+		job, ok := s.next()
+		for !ok {
+			if s.closed {
+				s.mu.Unlock()
+				return
+			}
+			s.cond.Wait()
+			job, ok = s.next()
+		}
+		s.running[job.TaskID]++
+		s.hostRunning[job.Host]++
+		s.mu.Unlock()
+
+		job.Run()
+
+		s.mu.Lock()
+		s.running[job.TaskID]--
+		if s.running[job.TaskID] == 0 {
+			delete(s.running, job.TaskID)
+		}
+		s.hostRunning[job.Host]--
+		if s.hostRunning[job.Host] == 0 {
+			delete(s.hostRunning, job.Host)
+		}
+		// a slot of the task is free, a waiting worker may take its next job
+		s.cond.Broadcast()
+		s.mu.Unlock()
+	}
+}
+
+// next pops the first job whose host is below its limit from the first task in the ring
+// that is below its limit, and moves that task to the end of the ring. It must be called with mu held.
+func (s *Scheduler) next() (Job, bool) {
+	for i, taskID := range s.order {
+		if s.perTask > 0 && s.running[taskID] >= s.perTask {
+			continue
+		}
+
+		queue := s.queues[taskID]
+		for ji, job := range queue {
+			if !s.hostAvailable(job.Host) {
+				continue
+			}
+
+			queue = append(queue[:ji:ji], queue[ji+1:]...)
+
+			s.order = append(s.order[:i:i], s.order[i+1:]...)
+			if len(queue) == 0 {
+				delete(s.queues, taskID)
+			} else {
+				s.queues[taskID] = queue
+				s.order = append(s.order, taskID)
+			}
+
+			return job, true
+		}
+	}
+
+	return Job{}, false
+}
+
+func (s *Scheduler) hostAvailable(host string) bool {
+	if s.perHost == nil {
+		return true
+	}
+
+	limit := s.perHost(host)
+
+	return limit <= 0 || s.hostRunning[host] < limit
+}
@@ -0,0 +1,183 @@
+package scheduler
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func trackPeak(running, peak *atomic.Int32) {
+	n := running.Add(1)
+	for {
+		p := peak.Load()
+		if n <= p || peak.CompareAndSwap(p, n) {
+			return
+		}
+	}
+}
+
+func TestGlobalLimit(t *testing.T) {
+	s := New(3, 0, nil)
+	defer s.Close()
+
+	var running, peak atomic.Int32
+	var wg sync.WaitGroup
+
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		s.Submit(Job{TaskID: fmt.Sprintf("task_%d", i%4), Run: func() {
+			defer wg.Done()
+
+			trackPeak(&running, &peak)
+			time.Sleep(5 * time.Millisecond)
+			running.Add(-1)
+		}})
+	}
+	wg.Wait()
+
+	if peak.Load() > 3 {
+		t.Fatalf("Error: %d jobs ran at once, limit is 3", peak.Load())
+	}
+}
+
+func TestPerTaskLimit(t *testing.T) {
+	s := New(10, 2, nil)
+	defer s.Close()
+
+	var running, peak atomic.Int32
+	var wg sync.WaitGroup
+
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		s.Submit(Job{TaskID: "task", Run: func() {
+			defer wg.Done()
+
+			trackPeak(&running, &peak)
+			time.Sleep(5 * time.Millisecond)
+			running.Add(-1)
+		}})
+	}
+	wg.Wait()
+
+	if peak.Load() > 2 {
+		t.Fatalf("Error: %d jobs of one task ran at once, limit is 2", peak.Load())
+	}
+}
+
+func TestRoundRobin(t *testing.T) {
+	s := New(1, 0, nil)
+	defer s.Close()
+
+	// hold the only worker until all jobs are queued
+	release := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	s.Submit(Job{TaskID: "blocker", Run: func() {
+		defer wg.Done()
+		<-release
+	}})
+
+	var mu sync.Mutex
+	var order []string
+
+	record := func(name string) func() {
+		return func() {
+			defer wg.Done()
+			mu.Lock()
+			order = append(order, name)
+			mu.Unlock()
+		}
+	}
+
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		s.Submit(Job{TaskID: "a", Run: record("a")})
+	}
+	wg.Add(1)
+	s.Submit(Job{TaskID: "b", Run: record("b")})
+
+	close(release)
+	wg.Wait()
+
+	want := []string{"a", "b", "a", "a"}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Fatalf("Error: order %v, want %v", order, want)
+		}
+	}
+}
+
+func TestPerHostLimit(t *testing.T) {
+	s := New(10, 0, func(host string) int {
+		if host == "slow.example.com" {
+			return 1
+		}
+		return 0
+	})
+	defer s.Close()
+
+	var slowRunning, slowPeak atomic.Int32
+	var fastDone atomic.Int32
+	var wg sync.WaitGroup
+
+	for i := 0; i < 5; i++ {
+		wg.Add(2)
+		s.Submit(Job{TaskID: fmt.Sprintf("task_%d", i), Host: "slow.example.com", Run: func() {
+			defer wg.Done()
+
+			trackPeak(&slowRunning, &slowPeak)
+			time.Sleep(5 * time.Millisecond)
+			slowRunning.Add(-1)
+		}})
+		s.Submit(Job{TaskID: fmt.Sprintf("task_%d", i), Host: "fast.example.com", Run: func() {
+			defer wg.Done()
+			fastDone.Add(1)
+		}})
+	}
+	wg.Wait()
+
+	if slowPeak.Load() > 1 {
+		t.Fatalf("Error: %d jobs of a host ran at once, limit is 1", slowPeak.Load())
+	}
+	if fastDone.Load() != 5 {
+		t.Fatalf("Error: jobs of other hosts did not run")
+	}
+}
+
+func TestCancel(t *testing.T) {
+	s := New(1, 0, nil)
+	defer s.Close()
+
+	// the only worker is busy, everything else stays queued
+	release := make(chan struct{})
+	started := make(chan struct{})
+	s.Submit(Job{TaskID: "busy", Run: func() {
+		close(started)
+		<-release
+	}})
+	<-started
+
+	var ran atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		s.Submit(Job{TaskID: "cancelled", Run: func() { ran.Add(1) }})
+	}
+	wg.Add(1)
+	s.Submit(Job{TaskID: "other", Run: wg.Done})
+
+	if dropped := s.Cancel("cancelled"); dropped != 3 {
+		t.Fatalf("Error: dropped %d jobs, want 3", dropped)
+	}
+	if s.Queued("cancelled") != 0 {
+		t.Fatalf("Error: %d jobs still queued", s.Queued("cancelled"))
+	}
+
+	close(release)
+	wg.Wait()
+
+	if ran.Load() != 0 {
+		t.Fatalf("Error: %d cancelled jobs ran", ran.Load())
+	}
+}
@@ -0,0 +1,126 @@
+package speed
+
+import (
+	"sync"
+	"time"
+)
+
+// resolution merges the reads of a file that come close together into one sample.
+const resolution = 100 * time.Millisecond
+
+// Key identifies a file of a task.
+type Key struct {
+	TaskID string
+	Index  int
+}
+
+// Meter counts the bytes read per file over a sliding window and derives the current speed from them.
+// A nil Meter does not measure anything.
+type Meter struct {
+	window time.Duration
+	now    func() time.Time
+
+	mu    sync.Mutex
+	files map[Key]*file
+}
+
+type file struct {
+	started time.Time
+	samples []sample
+}
+
+type sample struct {
+	at    time.Time
+	bytes int64
+}
+
+func New(window time.Duration) *Meter {
+	return &Meter{
+		window: window,
+		now:    time.Now,
+		files:  make(map[Key]*file),
+	}
+}
+
+// Add records n bytes read for the file.
+func (m *Meter) Add(key Key, n int64) {
+	if m == nil || n <= 0 {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+
+	f, ok := m.files[key]
+	if !ok {
+		f = &file{started: now}
+		m.files[key] = f
+	}
+
+	if last := len(f.samples) - 1; last >= 0 && now.Sub(f.samples[last].at) < resolution {
+		f.samples[last].bytes += n
+	} else {
+		f.samples = append(f.samples, sample{at: now, bytes: n})
+	}
+
+	m.trim(f, now)
+}
+
+// Rate returns the speed of the file in bytes per second over the window, 0 when nothing was read lately.
+func (m *Meter) Rate(key Key) int64 {
+	if m == nil {
+		return 0
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f, ok := m.files[key]
+	if !ok {
+		return 0
+	}
+
+	now := m.now()
+	m.trim(f, now)
+
+	var total int64
+	for _, s := range f.samples {
+		total += s.bytes
+	}
+	if total == 0 {
+		return 0
+	}
+
+	// a file measured for less than the window is averaged over the time it has been read
+	span := min(m.window, now.Sub(f.started))
+	if span < resolution {
+		span = resolution
+	}
+
+	return int64(float64(total) / span.Seconds())
+}
+
+// Remove forgets the file, its rate is 0 until it is read again.
+func (m *Meter) Remove(key Key) {
+	if m == nil {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.files, key)
+}
+
+// trim drops the samples older than the window, it must be called with mu held.
+func (m *Meter) trim(f *file, now time.Time) {
+	from := now.Add(-m.window)
+
+	i := 0
+	for i < len(f.samples) && !f.samples[i].at.After(from) {
+		i++
+	}
+	f.samples = f.samples[i:]
+}
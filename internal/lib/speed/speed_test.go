@@ -0,0 +1,88 @@
+package speed
+
+import (
+	"testing"
+	"time"
+)
+
+type clock struct {
+	now time.Time
+}
+
+func (c *clock) advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+func newMeter(window time.Duration) (*Meter, *clock) {
+	c := &clock{now: time.Unix(1000, 0)}
+	m := New(window)
+	m.now = func() time.Time { return c.now }
+
+	return m, c
+}
+
+func TestRateOverWindow(t *testing.T) {
+	m, c := newMeter(5 * time.Second)
+	key := Key{TaskID: "task", Index: 1}
+
+	for range 10 {
+		c.advance(time.Second)
+		m.Add(key, 1000)
+	}
+
+	// the last five seconds hold five samples of 1000 bytes
+	if rate := m.Rate(key); rate != 1000 {
+		t.Fatalf("Error: expected 1000 bytes/s, got %d", rate)
+	}
+}
+
+func TestRateOfNewFile(t *testing.T) {
+	m, c := newMeter(5 * time.Second)
+	key := Key{TaskID: "task", Index: 1}
+
+	m.Add(key, 1000)
+	c.advance(time.Second)
+	m.Add(key, 1000)
+
+	if rate := m.Rate(key); rate != 2000 {
+		t.Fatalf("Error: expected 2000 bytes/s, got %d", rate)
+	}
+}
+
+func TestRateDropsToZero(t *testing.T) {
+	m, c := newMeter(5 * time.Second)
+	key := Key{TaskID: "task", Index: 1}
+
+	m.Add(key, 1000)
+	c.advance(6 * time.Second)
+
+	if rate := m.Rate(key); rate != 0 {
+		t.Fatalf("Error: expected 0 bytes/s after the window, got %d", rate)
+	}
+}
+
+func TestRemove(t *testing.T) {
+	m, _ := newMeter(5 * time.Second)
+	key := Key{TaskID: "task", Index: 1}
+
+	m.Add(key, 1000)
+	m.Add(Key{TaskID: "task", Index: 2}, 1000)
+	m.Remove(key)
+
+	if rate := m.Rate(key); rate != 0 {
+		t.Fatalf("Error: expected 0 bytes/s of a removed file, got %d", rate)
+	}
+	if rate := m.Rate(Key{TaskID: "task", Index: 2}); rate == 0 {
+		t.Fatalf("Error: removing a file reset another one")
+	}
+}
+
+func TestNilMeter(t *testing.T) {
+	var m *Meter
+
+	m.Add(Key{}, 1000)
+	m.Remove(Key{})
+	if rate := m.Rate(Key{}); rate != 0 {
+		t.Fatalf("Error: expected 0 bytes/s of a nil meter, got %d", rate)
+	}
+}
@@ -0,0 +1,79 @@
+package sse
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Writer writes a text/event-stream response, every event is flushed to the client right away.
+type Writer struct {
+	w  io.Writer
+	rc *http.ResponseController
+}
+
+// NewWriter sends the headers of the stream. The write deadline of the server is cleared, a stream stays open.
+func NewWriter(w http.ResponseWriter) *Writer {
+	rc := http.NewResponseController(w)
+	// not every ResponseWriter supports deadlines, the stream then ends with the write timeout of the server
+	_ = rc.SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	// proxies such as nginx would buffer the stream otherwise
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	return &Writer{w: w, rc: rc}
+}
+
+// Event writes an event with the id, a data line is written for every line of data.
+func (s *Writer) Event(id uint64, event string, data []byte) error {
+	var buf bytes.Buffer
+
+	fmt.Fprintf(&buf, "id: %d\n", id)
+	if event != "" {
+		fmt.Fprintf(&buf, "event: %s\n", event)
+	}
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		buf.WriteString("data: ")
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	buf.WriteByte('\n')
+
+	return s.write(buf.Bytes())
+}
+
+// Comment is ignored by clients, it keeps idle connections from being closed by proxies.
+func (s *Writer) Comment(text string) error {
+	return s.write([]byte(": " + strings.ReplaceAll(text, "\n", " ") + "\n\n"))
+}
+
+func (s *Writer) write(b []byte) error {
+	if _, err := s.w.Write(b); err != nil {
+		return err
+	}
+
+	return s.rc.Flush()
+}
+
+// LastEventID returns the id of the last event the client received before it reconnected,
+// sent by browsers in the Last-Event-ID header or as the last_event_id query parameter.
+// It is 0 for a new stream.
+func LastEventID(r *http.Request) (uint64, error) {
+	value := r.Header.Get("Last-Event-ID")
+	if value == "" {
+		value = r.URL.Query().Get("last_event_id")
+	}
+	if value == "" {
+		return 0, nil
+	}
+
+	return strconv.ParseUint(value, 10, 64)
+}
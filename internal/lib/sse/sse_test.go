@@ -0,0 +1,49 @@
+package sse
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWriter(t *testing.T) {
+	rec := httptest.NewRecorder()
+
+	s := NewWriter(rec)
+	if err := s.Event(7, "file.status", []byte("{\"a\":1}\n{\"b\":2}")); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if err := s.Comment("ping"); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	want := "id: 7\nevent: file.status\ndata: {\"a\":1}\ndata: {\"b\":2}\n\n: ping\n\n"
+	if got := rec.Body.String(); got != want {
+		t.Fatalf("Error: got %q, want %q", got, want)
+	}
+	if rec.Header().Get("Content-Type") != "text/event-stream" || !rec.Flushed {
+		t.Fatalf("Error: stream was not flushed as text/event-stream")
+	}
+}
+
+func TestLastEventID(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/events?last_event_id=3", nil)
+	if id, err := LastEventID(r); err != nil || id != 3 {
+		t.Fatalf("Error: got %d, %v from the query", id, err)
+	}
+
+	r.Header.Set("Last-Event-ID", "5")
+	if id, err := LastEventID(r); err != nil || id != 5 {
+		t.Fatalf("Error: got %d, %v, the header must win over the query", id, err)
+	}
+
+	r = httptest.NewRequest(http.MethodGet, "/events", nil)
+	if id, err := LastEventID(r); err != nil || id != 0 {
+		t.Fatalf("Error: got %d, %v for a new stream", id, err)
+	}
+
+	r.Header.Set("Last-Event-ID", "x")
+	if _, err := LastEventID(r); err == nil {
+		t.Fatalf("Error: invalid id was accepted")
+	}
+}
@@ -0,0 +1,54 @@
+package taskstatus
+
+import "github.com/LashkaPashka/TaskDownloader/internal/models"
+
+// statuses of files
+const (
+	fileQueued     = "queued"
+	fileInProgress = "in_progress"
+	filePaused     = "paused"
+	fileDone       = "done"
+	fileFailed     = "failed"
+	fileCancelled  = "cancelled"
+)
+
+// statuses of tasks
+const (
+	Queued    = "queued"
+	Running   = "running"
+	Paused    = "paused"
+	Completed = "completed"
+	Failed    = "failed"
+	Cancelled = "cancelled"
+)
+
+// Aggregate derives the status of a task from the statuses of its files.
+// Work still going on wins over paused files, paused files over failed ones
+// (they can be resumed) and failed files over cancelled ones. A task is completed once every file is done.
+func Aggregate(files []models.File) string {
+	count := make(map[string]int, len(files))
+	for _, file := range files {
+		count[file.Status]++
+	}
+
+	switch {
+	case len(files) == 0:
+		return Queued
+	case count[fileInProgress] > 0:
+		return Running
+	case count[fileQueued] == len(files):
+		return Queued
+	case count[fileQueued] > 0:
+		return Running
+	case count[filePaused] > 0:
+		return Paused
+	case count[fileFailed] > 0:
+		return Failed
+	case count[fileCancelled] > 0:
+		return Cancelled
+	case count[fileDone] == len(files):
+		return Completed
+	default:
+		return Failed
+	}
+}
@@ -0,0 +1,40 @@
+package taskstatus
+
+import (
+	"testing"
+
+	"github.com/LashkaPashka/TaskDownloader/internal/models"
+)
+
+func files(statuses ...string) []models.File {
+	files := make([]models.File, 0, len(statuses))
+	for i, status := range statuses {
+		files = append(files, models.File{Index: i + 1, Status: status})
+	}
+
+	return files
+}
+
+func TestAggregate(t *testing.T) {
+	tests := []struct {
+		name  string
+		files []models.File
+		want  string
+	}{
+		{"no files", nil, Queued},
+		{"all queued", files(fileQueued, fileQueued), Queued},
+		{"one in progress", files(fileDone, fileInProgress, fileFailed), Running},
+		{"queued after done", files(fileDone, fileQueued), Running},
+		{"paused", files(fileDone, filePaused, fileFailed), Paused},
+		{"failed", files(fileDone, fileFailed), Failed},
+		{"cancelled", files(fileDone, fileCancelled), Cancelled},
+		{"all done", files(fileDone, fileDone), Completed},
+		{"one done is not completed", files(fileDone, fileInProgress), Running},
+	}
+
+	for _, tt := range tests {
+		if got := Aggregate(tt.files); got != tt.want {
+			t.Errorf("Error: %s: got %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,266 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/LashkaPashka/TaskDownloader/internal/lib/random"
+	"github.com/LashkaPashka/TaskDownloader/internal/lib/retry"
+)
+
+// DefaultSenders is how many callback urls are sent to at the same time when none is given.
+const DefaultSenders = 8
+
+// Dispatcher sends the deliveries of the log in the background and retries the failed ones with backoff.
+// The deliveries of a callback url are sent one by one in their order, different urls are sent
+// at the same time by up to senders goroutines, so a slow endpoint holds up its own webhooks only.
+// A nil Dispatcher sends nothing and knows no secrets.
+type Dispatcher struct {
+	log     *Log
+	client  *http.Client
+	policy  retry.Policy
+	logger  *slog.Logger
+	now     func() time.Time
+	wake    chan struct{}
+	senders int
+	// secrets of the clients, read only
+	secrets map[string]string
+
+	mu sync.Mutex
+	// busy holds the urls that have a sender running
+	busy map[string]bool
+}
+
+func NewDispatcher(log *Log, secrets map[string]string, policy retry.Policy, timeout time.Duration, senders int, logger *slog.Logger) *Dispatcher {
+	if senders <= 0 {
+		senders = DefaultSenders
+	}
+
+	return &Dispatcher{
+		log:     log,
+		client:  &http.Client{Timeout: timeout},
+		policy:  policy,
+		logger:  logger,
+		now:     time.Now,
+		wake:    make(chan struct{}, 1),
+		senders: senders,
+		secrets: secrets,
+		busy:    make(map[string]bool),
+	}
+}
+
+// HasSecret reports whether webhooks of the client can be signed.
+func (d *Dispatcher) HasSecret(clientID string) bool {
+	_, ok := d.secret(clientID)
+	return ok
+}
+
+func (d *Dispatcher) secret(clientID string) (string, bool) {
+	if d == nil {
+		return "", false
+	}
+
+	secret, ok := d.secrets[clientID]
+	return secret, ok && secret != ""
+}
+
+// Enqueue writes the webhook to the log and wakes the dispatcher, it is sent even if the service restarts first.
+func (d *Dispatcher) Enqueue(clientID, taskID, url, event string, body []byte) error {
+	if d == nil {
+		return nil
+	}
+
+	now := d.now()
+	if err := d.log.Add(Delivery{
+		ID:            random.RandomString("wh_", 16),
+		ClientID:      clientID,
+		TaskID:        taskID,
+		URL:           url,
+		Event:         event,
+		Body:          body,
+		Status:        StatusPending,
+		NextAttemptAt: now,
+		CreatedAt:     now,
+	}); err != nil {
+		return err
+	}
+
+	d.notify()
+
+	return nil
+}
+
+func (d *Dispatcher) notify() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run sends the due deliveries until ctx is done and waits for the senders to stop,
+// a delivery interrupted by ctx stays pending.
+func (d *Dispatcher) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for {
+		due, next := d.log.Due(d.now())
+		d.start(ctx, &wg, due)
+
+		var timer *time.Timer
+		var wait <-chan time.Time
+		if !next.IsZero() {
+			timer = time.NewTimer(next.Sub(d.now()))
+			wait = timer.C
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-d.wake:
+		case <-wait:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// start runs a sender for every url of the due deliveries that has none, as long as there is a free one.
+// The deliveries left are started by a later call, a sender wakes Run when it is done.
+func (d *Dispatcher) start(ctx context.Context, wg *sync.WaitGroup, due []Delivery) {
+	var urls []string
+	byURL := make(map[string][]Delivery)
+	for _, delivery := range due {
+		if _, ok := byURL[delivery.URL]; !ok {
+			urls = append(urls, delivery.URL)
+		}
+		byURL[delivery.URL] = append(byURL[delivery.URL], delivery)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, url := range urls {
+		if len(d.busy) >= d.senders {
+			return
+		}
+		if d.busy[url] {
+			continue
+		}
+		d.busy[url] = true
+
+		wg.Add(1)
+		go func(url string, deliveries []Delivery) {
+			defer wg.Done()
+
+			for _, delivery := range deliveries {
+				if ctx.Err() != nil {
+					break
+				}
+				d.attempt(ctx, delivery)
+			}
+
+			d.mu.Lock()
+			delete(d.busy, url)
+			d.mu.Unlock()
+			d.notify()
+		}(url, byURL[url])
+	}
+}
+
+func (d *Dispatcher) attempt(ctx context.Context, delivery Delivery) {
+	const op = "TaskDownloader.webhook.Dispatcher.attempt"
+
+	code, retryAfter, err := d.send(ctx, delivery)
+	if ctx.Err() != nil {
+		return
+	}
+
+	delivery.Attempts++
+	delivery.ResponseCode = code
+	now := d.now()
+
+	switch {
+	case err == nil:
+		delivery.Status = StatusDelivered
+		delivery.LastError = ""
+		delivery.FinishedAt = now
+	case d.policy.Exhausted(delivery.Attempts):
+		delivery.Status = StatusFailed
+		delivery.LastError = err.Error()
+		delivery.FinishedAt = now
+
+		d.logger.Error("Webhook was not delivered",
+			slog.String("op", op),
+			slog.String("id", delivery.ID),
+			slog.String("task_id", delivery.TaskID),
+			slog.String("url", delivery.URL),
+			slog.Int("attempts", delivery.Attempts),
+			slog.String("err", err.Error()),
+		)
+	default:
+		delivery.LastError = err.Error()
+		delivery.NextAttemptAt = now.Add(max(d.policy.Backoff(delivery.Attempts), retryAfter))
+
+		d.logger.Warn("Webhook delivery failed, retry later",
+			slog.String("op", op),
+			slog.String("id", delivery.ID),
+			slog.String("url", delivery.URL),
+			slog.Int("attempt", delivery.Attempts),
+			slog.Time("next_attempt_at", delivery.NextAttemptAt),
+			slog.String("err", err.Error()),
+		)
+	}
+
+	if err := d.log.Update(delivery); err != nil {
+		d.logger.Error("Failed to save webhook delivery",
+			slog.String("op", op),
+			slog.String("id", delivery.ID),
+			slog.String("err", err.Error()),
+		)
+	}
+}
+
+// send posts the delivery signed with the current secret of its client, any status but 2xx is an error.
+func (d *Dispatcher) send(ctx context.Context, delivery Delivery) (code int, retryAfter time.Duration, err error) {
+	secret, ok := d.secret(delivery.ClientID)
+	if !ok {
+		return 0, 0, fmt.Errorf("no webhook secret for client %s", delivery.ClientID)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(delivery.Body))
+	if err != nil {
+		return 0, 0, err
+	}
+
+	timestamp := d.now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderID, delivery.ID)
+	req.Header.Set(HeaderEvent, delivery.Event)
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(secret, timestamp, delivery.Body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, retry.ParseRetryAfter(resp.Header.Get("Retry-After"), d.now()), fmt.Errorf("webhook answered %s", resp.Status)
+	}
+
+	return resp.StatusCode, 0, nil
+}
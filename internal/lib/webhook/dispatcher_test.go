@@ -0,0 +1,215 @@
+package webhook
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/LashkaPashka/TaskDownloader/internal/lib/retry"
+)
+
+var logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+func waitDeliveries(t *testing.T, log *Log, status string) []Delivery {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		deliveries := log.Deliveries()
+
+		done := len(deliveries) > 0
+		for _, d := range deliveries {
+			done = done && d.Status == status
+		}
+		if done {
+			return deliveries
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("Error: deliveries did not become %s: %+v", status, deliveries)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestDeliverSigned(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		if !Verify("secret", r.Header.Get(HeaderSignature), r.Header.Get(HeaderTimestamp), body, time.Minute, time.Now()) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.Header.Get(HeaderEvent) != "task.completed" || r.Header.Get(HeaderID) == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		// the first attempt fails, the retry succeeds
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	log, err := OpenLog(filepath.Join(t.TempDir(), "webhooks.json"))
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	policy := retry.Policy{MaxAttempts: 3, BaseBackoff: 10 * time.Millisecond}
+	d := NewDispatcher(log, map[string]string{"client": "secret"}, policy, time.Second, 0, logger)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go d.Run(ctx)
+
+	if err := d.Enqueue("client", "task", srv.URL, "task.completed", []byte(`{"task_id":"task"}`)); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	delivery := waitDeliveries(t, log, StatusDelivered)[0]
+	if delivery.Attempts != 2 || delivery.ResponseCode != http.StatusNoContent || delivery.FinishedAt.IsZero() {
+		t.Fatalf("Error: unexpected delivery %+v", delivery)
+	}
+}
+
+func TestGiveUpAfterMaxAttempts(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	log, err := OpenLog(filepath.Join(t.TempDir(), "webhooks.json"))
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	policy := retry.Policy{MaxAttempts: 2, BaseBackoff: 10 * time.Millisecond}
+	d := NewDispatcher(log, map[string]string{"client": "secret"}, policy, time.Second, 0, logger)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go d.Run(ctx)
+
+	d.Enqueue("client", "task", srv.URL, "file.failed", []byte(`{}`))
+
+	delivery := waitDeliveries(t, log, StatusFailed)[0]
+	if delivery.Attempts != 2 || delivery.ResponseCode != http.StatusInternalServerError || delivery.LastError == "" {
+		t.Fatalf("Error: unexpected delivery %+v", delivery)
+	}
+}
+
+func TestSlowEndpointDoesNotHoldUpOthers(t *testing.T) {
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer slow.Close()
+	defer close(release)
+
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer fast.Close()
+
+	log, err := OpenLog(filepath.Join(t.TempDir(), "webhooks.json"))
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	policy := retry.Policy{MaxAttempts: 3, BaseBackoff: 10 * time.Millisecond}
+	d := NewDispatcher(log, map[string]string{"client": "secret", "other": "secret"}, policy, 10*time.Second, 2, logger)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go d.Run(ctx)
+	defer cancel()
+
+	d.Enqueue("client", "task_1", slow.URL, "file.done", []byte(`{}`))
+	d.Enqueue("client", "task_1", slow.URL, "task.completed", []byte(`{}`))
+	d.Enqueue("other", "task_2", fast.URL, "file.done", []byte(`{}`))
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		delivered := 0
+		for _, delivery := range log.Deliveries() {
+			if delivery.URL == fast.URL && delivery.Status == StatusDelivered {
+				delivered++
+			}
+			if delivery.URL == slow.URL && delivery.Status != StatusPending {
+				t.Fatalf("Error: slow delivery finished %+v", delivery)
+			}
+		}
+		if delivered == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Error: webhook of another url is held up by the slow one")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestPendingSurvivesRestart(t *testing.T) {
+	var received atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received.Add(1)
+	}))
+	defer srv.Close()
+
+	path := filepath.Join(t.TempDir(), "webhooks.json")
+	policy := retry.Policy{MaxAttempts: 3, BaseBackoff: 10 * time.Millisecond}
+
+	log, err := OpenLog(path)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	// enqueued while the dispatcher is not running
+	if err := NewDispatcher(log, nil, policy, time.Second, 0, logger).Enqueue("client", "task", srv.URL, "file.done", []byte(`{}`)); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	reopened, err := OpenLog(path)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go NewDispatcher(reopened, map[string]string{"client": "secret"}, policy, time.Second, 0, logger).Run(ctx)
+
+	waitDeliveries(t, reopened, StatusDelivered)
+	if received.Load() != 1 {
+		t.Fatalf("Error: webhook was received %d times", received.Load())
+	}
+}
+
+func TestPrune(t *testing.T) {
+	log, err := OpenLog(filepath.Join(t.TempDir(), "webhooks.json"))
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	log.keep = 3
+
+	log.Add(Delivery{ID: "pending", Status: StatusPending})
+	for _, id := range []string{"a", "b", "c", "d", "e"} {
+		log.Add(Delivery{ID: id, Status: StatusPending})
+		log.Update(Delivery{ID: id, Status: StatusDelivered})
+	}
+
+	deliveries := log.Deliveries()
+	if len(deliveries) != 4 || deliveries[0].ID != "pending" || deliveries[1].ID != "c" {
+		t.Fatalf("Error: unexpected deliveries %+v", deliveries)
+	}
+}
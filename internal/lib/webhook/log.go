@@ -0,0 +1,162 @@
+package webhook
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/LashkaPashka/TaskDownloader/internal/lib/atomicfile"
+)
+
+// Statuses of a delivery.
+const (
+	StatusPending   = "pending"
+	StatusDelivered = "delivered"
+	StatusFailed    = "failed"
+)
+
+// keepFinished is how many delivered or failed deliveries stay in the log for inspection.
+const keepFinished = 1000
+
+// Delivery is a webhook with the state of sending it. Body is sent and signed as is.
+type Delivery struct {
+	ID            string          `json:"id"`
+	ClientID      string          `json:"client_id"`
+	TaskID        string          `json:"task_id"`
+	URL           string          `json:"url"`
+	Event         string          `json:"event"`
+	Body          json.RawMessage `json:"body"`
+	Status        string          `json:"status"`
+	Attempts      int             `json:"attempts"`
+	NextAttemptAt time.Time       `json:"next_attempt_at"`
+	ResponseCode  int             `json:"response_code,omitempty"`
+	LastError     string          `json:"last_error,omitempty"`
+	CreatedAt     time.Time       `json:"created_at"`
+	FinishedAt    time.Time       `json:"finished_at"`
+}
+
+// Log keeps the deliveries in a json file, every change is written before it returns.
+type Log struct {
+	path string
+	keep int
+
+	mu         sync.Mutex
+	deliveries []Delivery
+}
+
+// OpenLog loads the deliveries of the file, it is created on the first write.
+func OpenLog(path string) (*Log, error) {
+	l := &Log{path: path, keep: keepFinished}
+
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return l, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, &l.deliveries); err != nil {
+			return nil, fmt.Errorf("webhook log %s: %w", path, err)
+		}
+	}
+
+	return l, nil
+}
+
+func (l *Log) Add(d Delivery) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.deliveries = append(l.deliveries, d)
+	if err := l.save(); err != nil {
+		l.deliveries = l.deliveries[:len(l.deliveries)-1]
+		return err
+	}
+
+	return nil
+}
+
+// Update replaces the delivery with the same id.
+func (l *Log) Update(d Delivery) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	i := slices.IndexFunc(l.deliveries, func(old Delivery) bool { return old.ID == d.ID })
+	if i < 0 {
+		return fmt.Errorf("webhook delivery %s not found", d.ID)
+	}
+	l.deliveries[i] = d
+	l.prune()
+
+	return l.save()
+}
+
+// Due returns the pending deliveries to send at now in the order they were added,
+// and when the next one is due, zero when none is pending.
+func (l *Log) Due(now time.Time) (due []Delivery, next time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, d := range l.deliveries {
+		if d.Status != StatusPending {
+			continue
+		}
+
+		if !d.NextAttemptAt.After(now) {
+			due = append(due, d)
+		} else if next.IsZero() || d.NextAttemptAt.Before(next) {
+			next = d.NextAttemptAt
+		}
+	}
+
+	return due, next
+}
+
+// Deliveries returns a copy of the log, oldest first.
+func (l *Log) Deliveries() []Delivery {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return slices.Clone(l.deliveries)
+}
+
+// prune drops the oldest finished deliveries over keep, it must be called with mu held.
+func (l *Log) prune() {
+	finished := 0
+	for _, d := range l.deliveries {
+		if d.Status != StatusPending {
+			finished++
+		}
+	}
+
+	l.deliveries = slices.DeleteFunc(l.deliveries, func(d Delivery) bool {
+		if finished <= l.keep || d.Status == StatusPending {
+			return false
+		}
+		finished--
+		return true
+	})
+}
+
+// save replaces the file of the log atomically, a crash never leaves a partial log.
+// It must be called with mu held.
+func (l *Log) save() error {
+	data, err := json.Marshal(l.deliveries)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(l.path), os.ModePerm); err != nil {
+		return err
+	}
+
+	return atomicfile.Write(l.path, data)
+}
@@ -0,0 +1,31 @@
+package webhook
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestSignAndVerify(t *testing.T) {
+	body := []byte(`{"event":"task.completed"}`)
+	now := time.Unix(1700000000, 0)
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+
+	signature := Sign("secret", now.Unix(), body)
+
+	if !Verify("secret", signature, timestamp, body, 5*time.Minute, now) {
+		t.Fatalf("Error: valid signature was rejected")
+	}
+	if Verify("other", signature, timestamp, body, 5*time.Minute, now) {
+		t.Fatalf("Error: signature of another secret was accepted")
+	}
+	if Verify("secret", signature, timestamp, []byte(`{"event":"task.failed"}`), 5*time.Minute, now) {
+		t.Fatalf("Error: signature of another body was accepted")
+	}
+	if Verify("secret", signature, strconv.FormatInt(now.Unix()+1, 10), body, 5*time.Minute, now) {
+		t.Fatalf("Error: signature with another timestamp was accepted")
+	}
+	if Verify("secret", signature, timestamp, body, 5*time.Minute, now.Add(10*time.Minute)) {
+		t.Fatalf("Error: outdated signature was accepted")
+	}
+}
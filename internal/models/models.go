@@ -9,6 +9,9 @@ type Task struct {
 	ID				string		`json:"id"`
 	ClientID		string		`json:"client_id"`
 	Status			string		`json:"status"`
+	MaxBytesPerSec	int64		`json:"max_bytes_per_sec,omitempty"`
+	// CallbackURL gets a signed notification when a file or the task finishes
+	CallbackURL		string		`json:"callback_url,omitempty"`
 }
 
 type File struct {
@@ -20,9 +23,53 @@ type File struct {
 	Status				string		`json:"status"`
 	StartedAt			time.Time	`json:"started_at"`
 	FinishedAt			time.Time	`json:"finished_at"`
+	Segments			[]Segment	`json:"segments,omitempty"`
+	ETag				string		`json:"etag,omitempty"`
+	LastModified		string		`json:"last_modified,omitempty"`
+	ChecksumAlgo		string		`json:"checksum_algo,omitempty"`
+	ExpectedChecksum	string		`json:"expected_checksum,omitempty"`
+	Checksum			string		`json:"checksum,omitempty"`
+	FailReason			string		`json:"fail_reason,omitempty"`
+	Attempts			int			`json:"attempts,omitempty"`
+	LastError			string		`json:"last_error,omitempty"`
+	// NextAttemptAt is when a queued file that failed is tried again
+	NextAttemptAt		time.Time	`json:"next_attempt_at"`
+}
+
+// Segment is a byte range of a file downloaded over its own connection, End is inclusive.
+type Segment struct {
+	Index				int			`json:"index"`
+	Start				int64		`json:"start"`
+	End					int64		`json:"end"`
+	DownloadedBytes		int64		`json:"downloadedBytes"`
 }
 
 type EventData struct {
 	ClientID		string		`json:"client_id"`
 	TaskID			string		`json:"task_id"`
-}
\ No newline at end of file
+	// Indexes of the files to download, all of them when empty
+	Indexes			[]int		`json:"indexes,omitempty"`
+	// Purge removes the .part files of a cancelled task
+	Purge			bool		`json:"purge,omitempty"`
+}
+// TaskFilter selects tasks for a listing, zero fields do not filter.
+type TaskFilter struct {
+	ClientID		string
+	Status			string
+	// CreatedFrom is inclusive, CreatedTo exclusive
+	CreatedFrom		time.Time
+	CreatedTo		time.Time
+	// URL matches tasks having a file whose url contains it, case-insensitively
+	URL				string
+	// tasks are sorted by creation time, newest first unless Ascending is set
+	Ascending		bool
+	// Cursor is the NextCursor of the previous page
+	Cursor			string
+	Limit			int
+}
+
+type TaskPage struct {
+	Tasks			[]Task
+	// NextCursor is empty on the last page
+	NextCursor		string
+}
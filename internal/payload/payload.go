@@ -1,8 +1,36 @@
 package payload
 
+import (
+	"encoding/json"
+	"time"
+)
+
 type SaveTaskRequest struct {
-	Urls			[]string	`json:"urls" vaildate:"required"`
-	ClientID		string		`json:"client_id" vaildate:"required"`
+	Urls			[]FileRequest	`json:"urls" validate:"required,dive"`
+	ClientID		string			`json:"client_id" vaildate:"required"`
+	MaxBytesPerSec	int64			`json:"max_bytes_per_sec,omitempty" validate:"gte=0"`
+	CallbackURL		string			`json:"callback_url,omitempty" validate:"omitempty,http_url"`
+}
+
+// FileRequest is sent either as a plain url or as an object with an expected digest of the file.
+// A digest is hex of the length of its algorithm, in any case.
+type FileRequest struct {
+	Url				string		`json:"url" validate:"required,url"`
+	SHA256			string		`json:"sha256,omitempty" validate:"omitempty,hexdigest=64"`
+	SHA1			string		`json:"sha1,omitempty" validate:"omitempty,hexdigest=40"`
+	MD5				string		`json:"md5,omitempty" validate:"omitempty,hexdigest=32"`
+}
+
+func (f *FileRequest) UnmarshalJSON(b []byte) error {
+	var url string
+	if err := json.Unmarshal(b, &url); err == nil {
+		*f = FileRequest{Url: url}
+		return nil
+	}
+
+	type fileRequest FileRequest
+
+	return json.Unmarshal(b, (*fileRequest)(f))
 }
 
 type GetStatusOfTaskResponse struct {
@@ -10,10 +38,157 @@ type GetStatusOfTaskResponse struct {
 	Status			string					`json:"status"`
 	TaskID			string					`json:"task_id"`				
 	ClientID		string					`json:"client_id"`
+	CreatedAt		time.Time				`json:"created_at"`
+	Progress		TaskProgressResponse	`json:"progress"`
+}
+
+// TaskProgressResponse sums up the files of a task, files of unknown size do not count in the bytes.
+type TaskProgressResponse struct {
+	TotalFiles			int			`json:"total_files"`
+	DoneFiles			int			`json:"done_files"`
+	FailedFiles			int			`json:"failed_files"`
+	TotalBytes			int64		`json:"total_bytes"`
+	DownloadedBytes		int64		`json:"downloaded_bytes"`
+	Percent				float64		`json:"percent"`
+	BytesPerSec			int64		`json:"bytes_per_sec"`
+	EtaSeconds			*int64		`json:"eta_seconds,omitempty"`
+}
+
+// TaskEvent is the data of a streamed event, File is set for the events of a file.
+type TaskEvent struct {
+	TaskID			string					`json:"task_id"`
+	ClientID		string					`json:"client_id"`
+	// Status of the task, set for the events of the task
+	Status			string					`json:"status,omitempty"`
+	File			*StatusOfFileResponse	`json:"file,omitempty"`
+}
+
+// WebhookNotification is posted to the callback_url of a task, File is set for the events of a file
+// and Task, with all its files, for the events of the task.
+type WebhookNotification struct {
+	Event			string					`json:"event"`
+	TaskID			string					`json:"task_id"`
+	ClientID		string					`json:"client_id"`
+	OccurredAt		time.Time				`json:"occurred_at"`
+	File			*StatusOfFileResponse	`json:"file,omitempty"`
+	Task			*GetStatusOfTaskResponse	`json:"task,omitempty"`
+}
+
+// SocketRequest is a message of a client over the websocket, Type is one of
+// subscribe, unsubscribe, pause, resume, cancel and retry.
+type SocketRequest struct {
+	Type			string		`json:"type"`
+	// RequestID is sent back in the reply to the message
+	RequestID		string		`json:"request_id,omitempty"`
+	// TaskIDs to subscribe to or unsubscribe from
+	TaskIDs			[]string	`json:"task_ids,omitempty"`
+	// LastEventID replays the events of the tasks after it on subscribe
+	LastEventID		uint64		`json:"last_event_id,omitempty"`
+	// TaskID of a command, Index pauses or resumes a single file of it
+	TaskID			string		`json:"task_id,omitempty"`
+	Index			int			`json:"index,omitempty"`
+	Purge			bool		`json:"purge,omitempty"`
+	Indexes			[]int		`json:"indexes,omitempty"`
+	KeepPartial		bool		`json:"keep_partial,omitempty"`
+}
+
+// SocketResponse is a message of the server over the websocket, Type is one of
+// event, ack, error and unsubscribed.
+type SocketResponse struct {
+	Type			string		`json:"type"`
+	RequestID		string		`json:"request_id,omitempty"`
+	TaskID			string		`json:"task_id,omitempty"`
+	// ID and Event of an event, ID of the last event sent for an unsubscribed task
+	ID				uint64		`json:"id,omitempty"`
+	Event			string		`json:"event,omitempty"`
+	Data			any			`json:"data,omitempty"`
+	// Code is the HTTP status the request would get from the REST API
+	Code			int			`json:"code,omitempty"`
+	Error			string		`json:"error,omitempty"`
+}
+
+type ListTasksResponse struct {
+	Tasks			[]GetStatusOfTaskResponse	`json:"tasks"`
+	NextCursor		string						`json:"next_cursor,omitempty"`
 }
 
 type StatusOfFileResponse struct {
+	Index				int					`json:"index"`
+	Url					string				`json:"url"`
 	DownloadedBytes		int64				`json:"downloadedBytes"`
+	// Size is 0 while the size of the file is not known
+	Size				int64				`json:"size"`
+	Percent				float64				`json:"percent"`
+	BytesPerSec			int64				`json:"bytes_per_sec"`
+	EtaSeconds			*int64				`json:"eta_seconds,omitempty"`
 	Filename			string				`json:"filename"`
 	Status 				string				`json:"status"`
-}
\ No newline at end of file
+	StartedAt			*time.Time			`json:"started_at,omitempty"`
+	FinishedAt			*time.Time			`json:"finished_at,omitempty"`
+	Attempts			int					`json:"attempts,omitempty"`
+	LastError			string				`json:"last_error,omitempty"`
+	FailReason			string				`json:"fail_reason,omitempty"`
+	// NextAttemptAt is set while a failed file waits for its next attempt
+	NextAttemptAt		*time.Time			`json:"next_attempt_at,omitempty"`
+}
+
+type AppendFilesRequest struct {
+	Urls			[]FileRequest	`json:"urls" validate:"required,min=1,dive"`
+}
+
+type AppendFilesResponse struct {
+	TaskID			string	`json:"task_id"`
+	Indexes			[]int	`json:"indexes"`
+}
+
+type RetryTaskRequest struct {
+	Indexes			[]int	`json:"indexes,omitempty" validate:"dive,gte=1"`
+	KeepPartial		bool	`json:"keep_partial"`
+}
+
+type RetryTaskResponse struct {
+	TaskID			string	`json:"task_id"`
+	Indexes			[]int	`json:"indexes"`
+}
+
+type BandwidthRequest struct {
+	GlobalBytesPerSec	*int64				`json:"global_bytes_per_sec,omitempty" validate:"omitempty,gte=0"`
+	Clients				map[string]int64	`json:"clients,omitempty" validate:"dive,gte=0"`
+	Tasks				map[string]int64	`json:"tasks,omitempty" validate:"dive,gte=0"`
+}
+
+type BandwidthResponse struct {
+	GlobalBytesPerSec	int64				`json:"global_bytes_per_sec"`
+	Clients				map[string]int64	`json:"clients"`
+	Tasks				map[string]int64	`json:"tasks"`
+}
+// ArchiveManifest is written as manifest.json into the archive of a task.
+type ArchiveManifest struct {
+	TaskID			string					`json:"task_id"`
+	ClientID		string					`json:"client_id"`
+	CreatedAt		time.Time				`json:"created_at"`
+	Files			[]ArchiveManifestFile	`json:"files"`
+}
+
+type ArchiveManifestFile struct {
+	Index			int			`json:"index"`
+	Url				string		`json:"url"`
+	// Name is the path of the file in the archive
+	Name			string		`json:"name"`
+	Size			int64		`json:"size"`
+	ChecksumAlgo	string		`json:"checksum_algo,omitempty"`
+	Checksum		string		`json:"checksum,omitempty"`
+}
+
+// DeadLetterResponse is an event the downloader failed to handle, Payload is its data as it was received.
+type DeadLetterResponse struct {
+	ID				string			`json:"id"`
+	Topic			string			`json:"topic"`
+	Payload			json.RawMessage	`json:"payload"`
+	Error			string			`json:"error"`
+	CreatedAt		time.Time		`json:"created_at"`
+}
+
+type DeadLettersResponse struct {
+	DeadLetters		[]DeadLetterResponse	`json:"dead_letters"`
+}
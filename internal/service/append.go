@@ -0,0 +1,83 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+
+	converttotask "github.com/LashkaPashka/TaskDownloader/internal/lib/convertToTask"
+	eventbus "github.com/LashkaPashka/TaskDownloader/internal/lib/eventBus"
+	"github.com/LashkaPashka/TaskDownloader/internal/models"
+	"github.com/LashkaPashka/TaskDownloader/internal/payload"
+)
+
+var ErrTaskCancelled = errors.New("task cancelled")
+
+// AppendFiles adds the urls to the task and queues them. A completed task is reopened,
+// a running one downloads them next to its other files. It returns the indexes of the new files.
+func (g *GoFetchService) AppendFiles(taskID string, body payload.AppendFilesRequest) ([]int, error) {
+	const op = "TaskDownloader.service.AppendFiles"
+
+	// the names of the new files are checked against the files of the task
+	g.appendMu.Lock()
+	defer g.appendMu.Unlock()
+
+	task, err := g.storage.GetTask(taskID)
+	if err != nil {
+		return nil, err
+	}
+	if task.ID == "" {
+		return nil, fmt.Errorf("%w: %s", ErrTaskNotFound, taskID)
+	}
+	if task.Status == statusCancelled {
+		return nil, fmt.Errorf("%w: %s", ErrTaskCancelled, taskID)
+	}
+
+	last := 0
+	taken := make([]string, 0, len(task.File))
+	for _, file := range task.File {
+		last = max(last, file.Index)
+		taken = append(taken, file.Filename)
+	}
+
+	// the storage numbers the files after the last one of the task, as ConvertFiles does
+	appended, err := g.storage.AppendFiles(taskID, converttotask.ConvertFiles(body.Urls, last+1, taken...))
+	if err != nil {
+		g.logger.Error("Invalid method of storage AppendFiles",
+			slog.String("op", op),
+			slog.String("task_id", taskID),
+			slog.String("err", err.Error()),
+		)
+		return nil, err
+	}
+
+	indexes := make([]int, 0, len(appended))
+	for _, file := range appended {
+		indexes = append(indexes, file.Index)
+	}
+
+	err = g.enqueue(eventbus.Event{
+		Type: eventbus.EventAppendFiles,
+		Data: models.EventData{
+			ClientID: task.ClientID,
+			TaskID: task.ID,
+			Indexes: indexes,
+		},
+	})
+	if err != nil {
+		g.logger.Error("Failed to queue appended files",
+			slog.String("op", op),
+			slog.String("task_id", taskID),
+			slog.String("err", err.Error()),
+		)
+		return nil, err
+	}
+
+	g.logger.Info("Files appended",
+		slog.String("op", op),
+		slog.String("task_id", taskID),
+		slog.Any("files", indexes),
+	)
+
+	return indexes, nil
+}
@@ -0,0 +1,98 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/LashkaPashka/TaskDownloader/internal/config"
+	eventbus "github.com/LashkaPashka/TaskDownloader/internal/lib/eventBus"
+	"github.com/LashkaPashka/TaskDownloader/internal/lib/taskstatus"
+	"github.com/LashkaPashka/TaskDownloader/internal/models"
+	"github.com/LashkaPashka/TaskDownloader/internal/payload"
+)
+
+func TestAppendFilesReopensTask(t *testing.T) {
+	content := testContent(512)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(content)
+	}))
+	defer srv.Close()
+
+	g, task := newTestService(t, config.Downloader{Workers: 2, MaxFilesPerTask: 2, Segments: 1}, srv.URL+"/a.bin")
+
+	go g.CompleteTask()
+	g.eventBus.Publish(eventbus.Event{
+		Type: eventbus.EventCreateTask,
+		Data: models.EventData{ClientID: task.ClientID, TaskID: task.ID},
+	})
+
+	if completed := waitFiles(t, g, task.ID, statusDone); completed.Status != taskstatus.Completed {
+		t.Fatalf("Error: task status %s, want %s", completed.Status, taskstatus.Completed)
+	}
+
+	indexes, err := g.AppendFiles(task.ID, payload.AppendFilesRequest{
+		Urls: []payload.FileRequest{{Url: srv.URL + "/b.bin"}, {Url: srv.URL + "/c.bin"}},
+	})
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if len(indexes) != 2 || indexes[0] != 2 || indexes[1] != 3 {
+		t.Fatalf("Error: appended files %v, want [2 3]", indexes)
+	}
+
+	done := waitFiles(t, g, task.ID, statusDone)
+	if len(done.File) != 3 || done.Status != taskstatus.Completed {
+		t.Fatalf("Error: unexpected task %+v", done)
+	}
+
+	if _, err := g.AppendFiles("task_missing", payload.AppendFilesRequest{}); !errors.Is(err, ErrTaskNotFound) {
+		t.Fatalf("Error: got %v, want %v", err, ErrTaskNotFound)
+	}
+}
+
+func TestAppendFilesKeepsNamesUnique(t *testing.T) {
+	contents := map[string][]byte{"/a.bin": testContent(64 * 1024), "/x/a.bin": bytes.Repeat([]byte{7}, 48*1024)}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(contents[r.URL.Path])
+	}))
+	defer srv.Close()
+
+	g, task := newTestService(t, config.Downloader{Workers: 4, MaxFilesPerTask: 4, Segments: 1}, srv.URL+"/a.bin")
+
+	go g.CompleteTask()
+
+	// the same url and another url of the same basename, both run at the same time
+	if _, err := g.AppendFiles(task.ID, payload.AppendFilesRequest{
+		Urls: []payload.FileRequest{{Url: srv.URL + "/a.bin"}, {Url: srv.URL + "/x/a.bin"}},
+	}); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	g.eventBus.Publish(eventbus.Event{
+		Type: eventbus.EventCreateTask,
+		Data: models.EventData{ClientID: task.ClientID, TaskID: task.ID},
+	})
+
+	done := waitFiles(t, g, task.ID, statusDone)
+
+	want := map[string]string{"a.bin": "/a.bin", "2_a.bin": "/a.bin", "3_a.bin": "/x/a.bin"}
+	for _, file := range done.File {
+		path, ok := want[file.Filename]
+		if !ok {
+			t.Fatalf("Error: unexpected filename %s", file.Filename)
+		}
+
+		got, err := os.ReadFile(filepath.Join(g.localStoragePath, task.ID, file.Filename))
+		if err != nil || !bytes.Equal(got, contents[path]) {
+			t.Fatalf("Error: content of %s differs: %v", file.Filename, err)
+		}
+		delete(want, file.Filename)
+	}
+	if len(want) != 0 {
+		t.Fatalf("Error: missing files %v", want)
+	}
+}
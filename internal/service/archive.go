@@ -0,0 +1,136 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/LashkaPashka/TaskDownloader/internal/lib/archive"
+	"github.com/LashkaPashka/TaskDownloader/internal/models"
+	"github.com/LashkaPashka/TaskDownloader/internal/payload"
+)
+
+const manifestName = "manifest.json"
+
+// ArchiveTask returns the task with its done files, the ones WriteArchive puts into the archive.
+func (g *GoFetchService) ArchiveTask(taskID string) (models.Task, error) {
+	task, _, err := g.findFiles(taskID, nil)
+	if err != nil {
+		return models.Task{}, err
+	}
+
+	var done []models.File
+	for _, file := range task.File {
+		if file.Status == statusDone {
+			done = append(done, file)
+		}
+	}
+	if len(done) == 0 {
+		return models.Task{}, fmt.Errorf("%w: no file of %s is downloaded", ErrFileNotReady, taskID)
+	}
+	task.File = done
+
+	return task, nil
+}
+
+// WriteArchive streams the files of the task into an archive of the format, straight from the disk.
+// Files missing on the disk are skipped. With manifest a manifest.json describing the files is added last.
+func (g *GoFetchService) WriteArchive(ctx context.Context, w io.Writer, task models.Task, format string, manifest bool) error {
+	const op = "TaskDownloader.service.WriteArchive"
+
+	aw, err := archive.New(format, w)
+	if err != nil {
+		return err
+	}
+
+	m := payload.ArchiveManifest{
+		TaskID: task.ID,
+		ClientID: task.ClientID,
+		CreatedAt: task.CreatedAt,
+		Files: make([]payload.ArchiveManifestFile, 0, len(task.File)),
+	}
+	names := make(map[string]bool, len(task.File)+1)
+	names[manifestName] = manifest
+
+	for _, file := range task.File {
+		// the client went away, do not read the rest of the files
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		name := archiveName(file, names)
+
+		size, err := g.addToArchive(aw, task.ID, file, name)
+		if err != nil {
+			if os.IsNotExist(err) {
+				g.logger.Error("Downloaded file is missing, skip it in the archive",
+					slog.String("op", op),
+					slog.String("task_id", task.ID),
+					slog.String("file", file.Filename),
+				)
+				continue
+			}
+			return err
+		}
+
+		m.Files = append(m.Files, payload.ArchiveManifestFile{
+			Index: file.Index,
+			Url: file.Url,
+			Name: name,
+			Size: size,
+			ChecksumAlgo: file.ChecksumAlgo,
+			Checksum: file.Checksum,
+		})
+	}
+
+	if manifest {
+		raw, err := json.MarshalIndent(&m, "", "\t")
+		if err != nil {
+			return err
+		}
+
+		entry := archive.Entry{Name: manifestName, Size: int64(len(raw)), ModTime: time.Now()}
+		if err := aw.Add(entry, bytes.NewReader(raw)); err != nil {
+			return err
+		}
+	}
+
+	return aw.Close()
+}
+
+func (g *GoFetchService) addToArchive(aw archive.Writer, taskID string, file models.File, name string) (int64, error) {
+	f, err := os.Open(filepath.Join(g.localStoragePath, taskID, file.Filename))
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	if err := aw.Add(archive.Entry{Name: name, Size: info.Size(), ModTime: info.ModTime()}, f); err != nil {
+		return 0, err
+	}
+
+	return info.Size(), nil
+}
+
+// archiveName keeps the filename unless it is taken, by the manifest or by a file of the same name,
+// then the index of the file is prepended.
+func archiveName(file models.File, taken map[string]bool) string {
+	name := file.Filename
+	if taken[name] {
+		name = fmt.Sprintf("%d_%s", file.Index, file.Filename)
+	}
+	taken[name] = true
+
+	return name
+}
@@ -0,0 +1,81 @@
+package service
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/LashkaPashka/TaskDownloader/internal/config"
+	"github.com/LashkaPashka/TaskDownloader/internal/lib/archive"
+	"github.com/LashkaPashka/TaskDownloader/internal/payload"
+)
+
+func TestWriteArchive(t *testing.T) {
+	// the second file is named like the manifest, the third one is not downloaded
+	g, task := newTestService(t, config.Downloader{Workers: 1, MaxFilesPerTask: 1},
+		"http://example.com/data.bin", "http://example.com/manifest.json", "http://example.com/c.bin")
+
+	if _, err := g.ArchiveTask(task.ID); !errors.Is(err, ErrFileNotReady) {
+		t.Fatalf("Error: got %v, want %v", err, ErrFileNotReady)
+	}
+
+	dir := filepath.Join(g.localStoragePath, task.ID)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	contents := map[int][]byte{1: testContent(100), 2: testContent(200)}
+	for index, content := range contents {
+		file := task.File[index-1]
+		if err := os.WriteFile(filepath.Join(dir, file.Filename), content, 0644); err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		file.Status = statusDone
+		if _, err := g.storage.SaveFile(task.ID, &file); err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+	}
+
+	archived, err := g.ArchiveTask(task.ID)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := g.WriteArchive(context.Background(), &buf, archived, archive.FormatZip, true); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	got := make(map[string][]byte)
+	for _, f := range zr.File {
+		r, err := f.Open()
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		got[f.Name], _ = io.ReadAll(r)
+		r.Close()
+	}
+
+	if len(got) != 3 || !bytes.Equal(got["data.bin"], contents[1]) || !bytes.Equal(got["2_manifest.json"], contents[2]) {
+		t.Fatalf("Error: unexpected entries %v", len(got))
+	}
+
+	var manifest payload.ArchiveManifest
+	if err := json.Unmarshal(got[manifestName], &manifest); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if manifest.TaskID != task.ID || len(manifest.Files) != 2 || manifest.Files[1].Name != "2_manifest.json" || manifest.Files[1].Size != 200 {
+		t.Fatalf("Error: unexpected manifest %+v", manifest)
+	}
+}
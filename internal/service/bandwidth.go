@@ -0,0 +1,69 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/LashkaPashka/TaskDownloader/internal/payload"
+)
+
+var ErrTaskNotFound = errors.New("task not found")
+
+// trackBandwidth registers the task with the bandwidth manager, the limit of its client applies to it too.
+// A task registered already keeps its limit.
+func (g *GoFetchService) trackBandwidth(taskID string) {
+	const op = "TaskDownloader.service.trackBandwidth"
+
+	task, err := g.storage.GetTask(taskID)
+	if err != nil {
+		g.logger.Error("Error get task",
+			slog.String("op", op),
+			slog.String("task_id", taskID),
+			slog.String("err", err.Error()),
+		)
+		return
+	}
+
+	g.bandwidth.AddTask(task.ID, task.ClientID, task.MaxBytesPerSec)
+}
+
+func (g *GoFetchService) Bandwidth() payload.BandwidthResponse {
+	limits := g.bandwidth.Limits()
+
+	return payload.BandwidthResponse{
+		GlobalBytesPerSec: limits.Global,
+		Clients: limits.Clients,
+		Tasks: limits.Tasks,
+	}
+}
+
+// SetBandwidth changes the limits at runtime, 0 removes a limit. Downloads in progress pick them up on the next read.
+func (g *GoFetchService) SetBandwidth(body payload.BandwidthRequest) error {
+	// check every task before changing anything
+	clients := make(map[string]string, len(body.Tasks))
+	for taskID := range body.Tasks {
+		task, err := g.storage.GetTask(taskID)
+		if err != nil {
+			return err
+		}
+		if task.ID == "" {
+			return fmt.Errorf("%w: %s", ErrTaskNotFound, taskID)
+		}
+		clients[taskID] = task.ClientID
+	}
+
+	if body.GlobalBytesPerSec != nil {
+		g.bandwidth.SetGlobal(*body.GlobalBytesPerSec)
+	}
+
+	for clientID, limit := range body.Clients {
+		g.bandwidth.SetClient(clientID, limit)
+	}
+
+	for taskID, limit := range body.Tasks {
+		g.bandwidth.SetTask(taskID, clients[taskID], limit)
+	}
+
+	return nil
+}
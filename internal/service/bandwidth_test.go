@@ -0,0 +1,98 @@
+package service
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/LashkaPashka/TaskDownloader/internal/config"
+	eventbus "github.com/LashkaPashka/TaskDownloader/internal/lib/eventBus"
+	"github.com/LashkaPashka/TaskDownloader/internal/models"
+	"github.com/LashkaPashka/TaskDownloader/internal/payload"
+)
+
+func TestSetBandwidth(t *testing.T) {
+	g, task := newTestService(t, config.Downloader{Workers: 1, MaxFilesPerTask: 1}, "http://example.com/a.bin")
+
+	global := int64(1 << 20)
+	err := g.SetBandwidth(payload.BandwidthRequest{
+		GlobalBytesPerSec: &global,
+		Clients: map[string]int64{task.ClientID: 1 << 19},
+		Tasks: map[string]int64{task.ID: 1 << 18},
+	})
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	limits := g.Bandwidth()
+	if limits.GlobalBytesPerSec != global || limits.Clients[task.ClientID] != 1<<19 || limits.Tasks[task.ID] != 1<<18 {
+		t.Fatalf("Error: limits %+v", limits)
+	}
+
+	// the files of the task are scheduled again, the limit set at runtime is kept
+	g.trackBandwidth(task.ID)
+	if limits := g.Bandwidth(); limits.Tasks[task.ID] != 1<<18 {
+		t.Fatalf("Error: runtime limit was reset %+v", limits)
+	}
+
+	// a limit of 0 removes it, fields that are not sent stay as they are
+	if err := g.SetBandwidth(payload.BandwidthRequest{Tasks: map[string]int64{task.ID: 0}}); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	limits = g.Bandwidth()
+	if _, ok := limits.Tasks[task.ID]; ok || limits.GlobalBytesPerSec != global {
+		t.Fatalf("Error: limits %+v", limits)
+	}
+}
+
+func TestSetBandwidthUnknownTask(t *testing.T) {
+	g, _ := newTestService(t, config.Downloader{Workers: 1, MaxFilesPerTask: 1})
+
+	global := int64(1 << 20)
+	err := g.SetBandwidth(payload.BandwidthRequest{
+		GlobalBytesPerSec: &global,
+		Tasks: map[string]int64{"task_missing": 1024},
+	})
+	if !errors.Is(err, ErrTaskNotFound) {
+		t.Fatalf("Error: got %v, want %v", err, ErrTaskNotFound)
+	}
+
+	// nothing is changed when the request is rejected
+	if limits := g.Bandwidth(); limits.GlobalBytesPerSec != 0 {
+		t.Fatalf("Error: limits %+v", limits)
+	}
+}
+
+func TestFinishedTaskDropsLimit(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(testContent(1024))
+	}))
+	defer srv.Close()
+
+	g, task := newTestService(t, config.Downloader{Workers: 1, MaxFilesPerTask: 1, Segments: 1}, srv.URL+"/a.bin")
+
+	if err := g.SetBandwidth(payload.BandwidthRequest{Tasks: map[string]int64{task.ID: 1 << 20}}); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	go g.CompleteTask()
+	g.eventBus.Publish(eventbus.Event{
+		Type: eventbus.EventCreateTask,
+		Data: models.EventData{ClientID: task.ClientID, TaskID: task.ID},
+	})
+	waitFiles(t, g, task.ID, statusDone)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, ok := g.Bandwidth().Tasks[task.ID]; !ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Error: limit of the completed task is kept %+v", g.Bandwidth())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,227 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	eventbus "github.com/LashkaPashka/TaskDownloader/internal/lib/eventBus"
+	"github.com/LashkaPashka/TaskDownloader/internal/models"
+)
+
+var ErrTaskFinished = errors.New("task already finished")
+
+// taskRun holds the context of the downloads of a task started by this process.
+type taskRun struct {
+	ctx context.Context
+	cancel context.CancelFunc
+	// pending counts the files submitted to the scheduler and not finished yet, it is guarded by runsMu
+	pending int
+	// done is closed once pending drops to zero
+	done chan struct{}
+	// queued and files hold the files waiting for a worker and the files being downloaded by their index,
+	// paused the files that must not start. They are guarded by runsMu.
+	queued map[int]bool
+	files map[int]*fileRun
+	paused map[int]bool
+}
+
+// fileRun is a download in flight, cancel stops it and done is closed once it has returned.
+type fileRun struct {
+	cancel context.CancelFunc
+	done chan struct{}
+}
+
+// startJob returns the run of the task for one more file, or nil when the task is being cancelled
+// or the file is already waiting for a worker or being downloaded.
+func (g *GoFetchService) startJob(taskID string, index int) *taskRun {
+	g.runsMu.Lock()
+	defer g.runsMu.Unlock()
+
+	run, ok := g.runs[taskID]
+	if !ok {
+		ctx, cancel := context.WithCancel(context.Background())
+		run = &taskRun{
+			ctx: ctx,
+			cancel: cancel,
+			done: make(chan struct{}),
+			queued: make(map[int]bool),
+			files: make(map[int]*fileRun),
+			paused: make(map[int]bool),
+		}
+		g.runs[taskID] = run
+	}
+
+	if run.ctx.Err() != nil || run.queued[index] || run.files[index] != nil {
+		return nil
+	}
+	run.queued[index] = true
+	run.pending++
+
+	return run
+}
+
+// startFile is called once a worker takes the file. It returns the context of the download
+// and the func to call when it returns, or a nil context when the file must not start.
+func (g *GoFetchService) startFile(run *taskRun, index int) (context.Context, func()) {
+	g.runsMu.Lock()
+	defer g.runsMu.Unlock()
+
+	delete(run.queued, index)
+	if run.ctx.Err() != nil || run.paused[index] {
+		return nil, nil
+	}
+
+	ctx, cancel := context.WithCancel(run.ctx)
+	fr := &fileRun{cancel: cancel, done: make(chan struct{})}
+	run.files[index] = fr
+
+	return ctx, func() {
+		g.runsMu.Lock()
+		delete(run.files, index)
+		g.runsMu.Unlock()
+
+		cancel()
+		close(fr.done)
+	}
+}
+
+// finishJobs marks n files of the run as finished. A cancelled run stays registered
+// until CancelTask has saved the statuses, so no new file of the task is started meanwhile.
+func (g *GoFetchService) finishJobs(taskID string, run *taskRun, n int) {
+	g.runsMu.Lock()
+	defer g.runsMu.Unlock()
+
+	run.pending -= n
+	if run.pending > 0 {
+		return
+	}
+
+	close(run.done)
+	if run.ctx.Err() == nil {
+		run.cancel()
+		delete(g.runs, taskID)
+	}
+}
+
+// CancelTask stops the downloads of the task, drops its queued files and marks
+// every file that is not done as cancelled. With purge the .part files are removed.
+// Without the downloader in this process the cancel is sent to it as an event.
+func (g *GoFetchService) CancelTask(taskID string, purge bool) error {
+	const op = "TaskDownloader.service.CancelTask"
+
+	task, err := g.storage.GetTask(taskID)
+	if err != nil {
+		return err
+	}
+	if task.ID == "" {
+		return fmt.Errorf("%w: %s", ErrTaskNotFound, taskID)
+	}
+	if task.Status == statusCompleted {
+		return fmt.Errorf("%w: %s", ErrTaskFinished, taskID)
+	}
+
+	// the .part files and the downloads are on the downloader, it also saves the statuses
+	// so that its progress does not overwrite them
+	if g.downloader.Disabled {
+		err := g.enqueue(eventbus.Event{
+			Type: eventbus.EventCancelTask,
+			Data: models.EventData{ClientID: task.ClientID, TaskID: task.ID, Purge: purge},
+		})
+		if err != nil {
+			g.logger.Error("Failed to send cancel to the downloader",
+				slog.String("op", op),
+				slog.String("task_id", taskID),
+				slog.String("err", err.Error()),
+			)
+		}
+		return err
+	}
+
+	g.runsMu.Lock()
+	run, ok := g.runs[taskID]
+	if ok {
+		run.cancel()
+	}
+	g.runsMu.Unlock()
+
+	if ok {
+		if dropped := g.scheduler.Cancel(taskID); dropped > 0 {
+			g.finishJobs(taskID, run, dropped)
+		}
+		// the downloads in flight save their progress on the way out, wait for them
+		// so they do not overwrite the cancelled status
+		<-run.done
+
+		defer func() {
+			g.runsMu.Lock()
+			if g.runs[taskID] == run {
+				delete(g.runs, taskID)
+			}
+			g.runsMu.Unlock()
+		}()
+
+		task, err = g.storage.GetTask(taskID)
+		if err != nil {
+			return err
+		}
+	}
+
+	for i := range task.File {
+		file := &task.File[i]
+
+		if purge {
+			tmpPath := filepath.Join(g.localStoragePath, taskID, file.Filename) + ".part"
+			if err := purgePart(file, tmpPath); err != nil {
+				g.logger.Error("Failed to remove part file",
+					slog.String("op", op),
+					slog.String("task_id", taskID),
+					slog.String("file", tmpPath),
+					slog.String("err", err.Error()),
+				)
+			}
+		}
+
+		if file.Status == statusDone || file.Status == statusCancelled {
+			continue
+		}
+
+		file.Status = statusCancelled
+		if _, err := g.storage.SaveFile(taskID, file); err != nil {
+			g.logger.Error("Failed to save file status",
+				slog.String("op", op),
+				slog.String("task_id", taskID),
+				slog.String("err", err.Error()),
+			)
+			return err
+		}
+	}
+
+	g.logger.Info("Task cancelled",
+		slog.String("op", op),
+		slog.String("task_id", taskID),
+		slog.Bool("purge", purge),
+	)
+
+	return nil
+}
+
+// purgePart removes the .part file of a file that is not done and forgets its progress.
+func purgePart(file *models.File, tmpPath string) error {
+	if file.Status == statusDone {
+		return nil
+	}
+
+	if err := resetProgress(file, tmpPath); err != nil {
+		return err
+	}
+
+	if err := os.Remove(tmpPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,96 @@
+package service
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/LashkaPashka/TaskDownloader/internal/config"
+)
+
+func TestCancelTask(t *testing.T) {
+	// the origin sends a part of the file and hangs until the client goes away
+	started := make(chan struct{}, 2)
+	aborted := make(chan struct{}, 2)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "2048")
+		w.Write(testContent(1024))
+		w.(http.Flusher).Flush()
+		started <- struct{}{}
+
+		<-r.Context().Done()
+		aborted <- struct{}{}
+	}))
+	defer srv.Close()
+
+	g, task := newTestService(t, config.Downloader{Workers: 1, MaxFilesPerTask: 1, Segments: 1},
+		srv.URL+"/a.bin", srv.URL+"/b.bin")
+
+	var mux sync.Mutex
+	for i := range task.File {
+		g.scheduleFile(&mux, task.ID, &task.File[i])
+	}
+
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Error: download did not start")
+	}
+	waitFiles(t, g, task.ID, statusInProgress, "queued")
+
+	if err := g.CancelTask(task.ID, true); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	select {
+	case <-aborted:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Error: request in flight was not aborted")
+	}
+
+	saved, err := g.storage.GetTask(task.ID)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if saved.Status != statusCancelled {
+		t.Fatalf("Error: task status %s, want %s", saved.Status, statusCancelled)
+	}
+	for _, file := range saved.File {
+		if file.Status != statusCancelled || file.DownloadedBytes != 0 {
+			t.Fatalf("Error: file %+v, want cancelled without progress", file)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(g.localStoragePath, task.ID, task.File[0].Filename+".part")); !os.IsNotExist(err) {
+		t.Fatalf("Error: part file was not removed: %v", err)
+	}
+
+	// the queued file was dropped, the origin never sees it
+	select {
+	case <-started:
+		t.Fatal("Error: queued file was started after cancel")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestCancelTaskErrors(t *testing.T) {
+	g, task := newTestService(t, config.Downloader{Workers: 1, MaxFilesPerTask: 1}, "http://example.com/a.bin")
+
+	if err := g.CancelTask("task_missing", false); !errors.Is(err, ErrTaskNotFound) {
+		t.Fatalf("Error: got %v, want %v", err, ErrTaskNotFound)
+	}
+
+	task.File[0].Status = statusDone
+	if _, err := g.storage.SaveFile(task.ID, &task.File[0]); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	if err := g.CancelTask(task.ID, false); !errors.Is(err, ErrTaskFinished) {
+		t.Fatalf("Error: got %v, want %v", err, ErrTaskFinished)
+	}
+}
@@ -0,0 +1,71 @@
+package service
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+)
+
+const (
+	algoSHA256 = "sha256"
+	algoSHA1   = "sha1"
+	algoMD5    = "md5"
+)
+
+const reasonChecksumMismatch = "checksum_mismatch"
+
+var errChecksumMismatch = errors.New("checksum mismatch")
+
+func newHash(algo string) (hash.Hash, error) {
+	switch algo {
+	case algoSHA256, "":
+		return sha256.New(), nil
+	case algoSHA1:
+		return sha1.New(), nil
+	case algoMD5:
+		return md5.New(), nil
+	}
+
+	return nil, fmt.Errorf("unknown checksum algorithm %q", algo)
+}
+
+// hashPart feeds the first n bytes of an existing .part file into h, so hashing can continue on resume.
+func hashPart(h hash.Hash, path string, n int64) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err := io.CopyN(h, f, n); err != nil {
+		return fmt.Errorf("rehash %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// hashFile computes the digest of a whole file, used when segments were written out of order.
+func hashFile(algo string, path string) (string, error) {
+	h, err := newHash(algo)
+	if err != nil {
+		return "", err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,86 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/LashkaPashka/TaskDownloader/internal/config"
+)
+
+func sha256Hex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func TestChecksumMatches(t *testing.T) {
+	content := testContent(32 * 1024)
+	srv := serveWithETag(content, `"v1"`)
+	defer srv.Close()
+
+	g, task := newTestService(t, config.Downloader{Segments: 1}, srv.URL+"/data.bin")
+	file := task.File[0]
+	file.ExpectedChecksum = sha256Hex(content)
+
+	// resume from the middle, the existing part has to be rehashed
+	dir := filepath.Join(g.localStoragePath, task.ID)
+	os.MkdirAll(dir, os.ModePerm)
+	os.WriteFile(filepath.Join(dir, file.Filename+".part"), content[:5000], 0644)
+	file.DownloadedBytes = 5000
+	file.ETag = `"v1"`
+
+	if err := g.DownloadWithResume(context.Background(), &sync.Mutex{}, task.ID, &file); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	if file.Checksum != file.ExpectedChecksum {
+		t.Fatalf("Error: checksum %s, want %s", file.Checksum, file.ExpectedChecksum)
+	}
+}
+
+func TestChecksumOfSegments(t *testing.T) {
+	content := testContent(64 * 1024)
+	srv := serveWithETag(content, `"v1"`)
+	defer srv.Close()
+
+	g, task := newTestService(t, config.Downloader{Segments: 4, MinSegmentSize: 1024}, srv.URL+"/data.bin")
+	file := task.File[0]
+
+	if err := g.DownloadWithResume(context.Background(), &sync.Mutex{}, task.ID, &file); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	if file.Checksum != sha256Hex(content) {
+		t.Fatalf("Error: checksum %s, want %s", file.Checksum, sha256Hex(content))
+	}
+}
+
+func TestChecksumMismatch(t *testing.T) {
+	content := testContent(16 * 1024)
+	srv := serveWithETag(content, `"v1"`)
+	defer srv.Close()
+
+	g, task := newTestService(t, config.Downloader{Segments: 1}, srv.URL+"/data.bin")
+	file := task.File[0]
+	file.ExpectedChecksum = sha256Hex([]byte("something else"))
+
+	err := g.DownloadWithResume(context.Background(), &sync.Mutex{}, task.ID, &file)
+	if !errors.Is(err, errChecksumMismatch) {
+		t.Fatalf("Error: expected checksum mismatch, got %v", err)
+	}
+
+	stored, _ := g.storage.GetFileById(task.ID, file.Index)
+	if stored.Status != statusFailed || stored.FailReason != reasonChecksumMismatch {
+		t.Fatalf("Error: unexpected stored file %+v", stored)
+	}
+
+	dir := filepath.Join(g.localStoragePath, task.ID)
+	if _, err := os.Stat(filepath.Join(dir, file.Filename)); !os.IsNotExist(err) {
+		t.Fatalf("Error: corrupted file was moved into place")
+	}
+}
@@ -0,0 +1,103 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/LashkaPashka/TaskDownloader/internal/config"
+	converttotask "github.com/LashkaPashka/TaskDownloader/internal/lib/convertToTask"
+	eventbus "github.com/LashkaPashka/TaskDownloader/internal/lib/eventBus"
+	"github.com/LashkaPashka/TaskDownloader/internal/models"
+	"github.com/LashkaPashka/TaskDownloader/internal/payload"
+)
+
+// waitFiles polls the storage until every file of the task reaches one of the statuses.
+func waitFiles(t *testing.T, g *GoFetchService, taskID string, statuses ...string) models.Task {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		task, err := g.storage.GetTask(taskID)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+
+		reached := len(task.File) > 0
+		for _, file := range task.File {
+			ok := false
+			for _, status := range statuses {
+				ok = ok || file.Status == status
+			}
+			reached = reached && ok
+		}
+		if reached {
+			return task
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("Error: files of task %s did not reach %v: %+v", taskID, statuses, task.File)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestTasksProgressConcurrently(t *testing.T) {
+	content := testContent(1024)
+
+	// the first task blocks its files until the second task is done
+	release := make(chan struct{})
+	var active, peak atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := active.Add(1)
+		defer active.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+
+		if r.URL.Path != "/b.bin" {
+			<-release
+		}
+		w.Write(content)
+	}))
+	defer srv.Close()
+	unblock := sync.OnceFunc(func() { close(release) })
+	defer unblock()
+
+	g, first := newTestService(t, config.Downloader{Workers: 2, MaxFilesPerTask: 1, Segments: 1},
+		srv.URL+"/a1.bin", srv.URL+"/a2.bin", srv.URL+"/a3.bin")
+
+	second := converttotask.Convert(&payload.SaveTaskRequest{
+		Urls:     []payload.FileRequest{{Url: srv.URL + "/b.bin"}},
+		ClientID: "client",
+	})
+	if _, err := g.storage.SaveTask(second); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	go g.CompleteTask()
+
+	for _, task := range []models.Task{first, second} {
+		g.eventBus.Publish(eventbus.Event{
+			Type: eventbus.EventCreateTask,
+			Data: models.EventData{ClientID: task.ClientID, TaskID: task.ID},
+		})
+	}
+
+	// the second task finishes while the first one still holds its only slot
+	waitFiles(t, g, second.ID, statusDone)
+
+	unblock()
+
+	waitFiles(t, g, first.ID, statusDone)
+
+	if peak.Load() > 2 {
+		t.Fatalf("Error: %d downloads ran at once, limit is 2", peak.Load())
+	}
+}
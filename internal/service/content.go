@@ -0,0 +1,43 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/LashkaPashka/TaskDownloader/internal/models"
+)
+
+var ErrFileNotReady = errors.New("file is not downloaded yet")
+
+// OpenFile opens the downloaded file of the task, it can be read once the file is done.
+// The caller closes it.
+func (g *GoFetchService) OpenFile(taskID string, index int) (*os.File, models.File, error) {
+	task, _, err := g.findFiles(taskID, []int{index})
+	if err != nil {
+		return nil, models.File{}, err
+	}
+
+	var file models.File
+	for _, f := range task.File {
+		if f.Index == index {
+			file = f
+		}
+	}
+
+	if file.Status != statusDone {
+		return nil, file, fmt.Errorf("%w: %s/%d is %s", ErrFileNotReady, taskID, index, file.Status)
+	}
+
+	f, err := os.Open(filepath.Join(g.localStoragePath, taskID, file.Filename))
+	if err != nil {
+		if os.IsNotExist(err) {
+			// removed from the disk behind our back
+			return nil, file, fmt.Errorf("%w: %s/%d", ErrFileNotFound, taskID, index)
+		}
+		return nil, file, err
+	}
+
+	return f, file, nil
+}
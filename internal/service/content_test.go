@@ -0,0 +1,52 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/LashkaPashka/TaskDownloader/internal/config"
+	eventbus "github.com/LashkaPashka/TaskDownloader/internal/lib/eventBus"
+	"github.com/LashkaPashka/TaskDownloader/internal/models"
+)
+
+func TestOpenFile(t *testing.T) {
+	content := testContent(4096)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(content)
+	}))
+	defer srv.Close()
+
+	g, task := newTestService(t, config.Downloader{Workers: 1, MaxFilesPerTask: 1, Segments: 1}, srv.URL+"/a.bin")
+
+	if _, _, err := g.OpenFile(task.ID, 1); !errors.Is(err, ErrFileNotReady) {
+		t.Fatalf("Error: got %v, want %v", err, ErrFileNotReady)
+	}
+	if _, _, err := g.OpenFile(task.ID, 2); !errors.Is(err, ErrFileNotFound) {
+		t.Fatalf("Error: got %v, want %v", err, ErrFileNotFound)
+	}
+
+	go g.CompleteTask()
+	g.eventBus.Publish(eventbus.Event{
+		Type: eventbus.EventCreateTask,
+		Data: models.EventData{ClientID: task.ClientID, TaskID: task.ID},
+	})
+	waitFiles(t, g, task.ID, statusDone)
+
+	f, file, err := g.OpenFile(task.ID, 1)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	defer f.Close()
+
+	got, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if !bytes.Equal(got, content) || file.Filename != "a.bin" || file.Checksum == "" {
+		t.Fatalf("Error: unexpected file %+v with %d bytes", file, len(got))
+	}
+}
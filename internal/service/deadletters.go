@@ -0,0 +1,157 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+
+	"github.com/LashkaPashka/TaskDownloader/internal/lib/deadletter"
+	eventbus "github.com/LashkaPashka/TaskDownloader/internal/lib/eventBus"
+	"github.com/LashkaPashka/TaskDownloader/internal/payload"
+)
+
+var (
+	ErrMalformedEvent = errors.New("malformed event")
+	ErrDeadLetterNotFound = errors.New("dead letter not found")
+)
+
+// deadLetter keeps the event the downloader failed to handle, it can be replayed once the cause is fixed.
+func (g *GoFetchService) deadLetter(topic eventbus.Topic, data []byte, reason error) {
+	const op = "TaskDownloader.service.deadLetter"
+
+	if g.deadLetters == nil {
+		g.logger.Error("Failed to handle event",
+			slog.String("op", op),
+			slog.String("type", string(topic)),
+			slog.String("reason", reason.Error()),
+		)
+		return
+	}
+
+	letter, err := g.deadLetters.Add(string(topic), data, reason.Error())
+	if err != nil {
+		g.logger.Error("Failed to add event to dead-letter queue",
+			slog.String("op", op),
+			slog.String("type", string(topic)),
+			slog.String("reason", reason.Error()),
+			slog.String("err", err.Error()),
+		)
+		return
+	}
+
+	g.logger.Error("Event moved to dead-letter queue",
+		slog.String("op", op),
+		slog.String("id", letter.ID),
+		slog.String("type", string(topic)),
+		slog.String("reason", reason.Error()),
+	)
+}
+
+// payloadOf is the data of the event as json, the data left undecoded by the bus is kept as it is.
+func payloadOf(data any) []byte {
+	if raw, ok := data.(json.RawMessage); ok {
+		return raw
+	}
+
+	body, err := json.Marshal(data)
+	if err != nil {
+		body, _ = json.Marshal(fmt.Sprintf("%v", data))
+	}
+
+	return body
+}
+
+func (g *GoFetchService) DeadLetters() payload.DeadLettersResponse {
+	response := payload.DeadLettersResponse{DeadLetters: []payload.DeadLetterResponse{}}
+	if g.deadLetters == nil {
+		return response
+	}
+
+	letters := g.deadLetters.Letters()
+	// newest first
+	slices.Reverse(letters)
+
+	for _, letter := range letters {
+		response.DeadLetters = append(response.DeadLetters, deadLetterResponse(letter))
+	}
+
+	return response
+}
+
+func (g *GoFetchService) DeadLetter(id string) (payload.DeadLetterResponse, error) {
+	if g.deadLetters == nil {
+		return payload.DeadLetterResponse{}, fmt.Errorf("%w: %s", ErrDeadLetterNotFound, id)
+	}
+
+	letter, ok := g.deadLetters.Get(id)
+	if !ok {
+		return payload.DeadLetterResponse{}, fmt.Errorf("%w: %s", ErrDeadLetterNotFound, id)
+	}
+
+	return deadLetterResponse(letter), nil
+}
+
+// ReplayDeadLetter queues the event again and removes it from the dead-letter queue.
+// If the downloader fails again, the event comes back under a new id.
+func (g *GoFetchService) ReplayDeadLetter(id string) error {
+	const op = "TaskDownloader.service.ReplayDeadLetter"
+
+	if g.deadLetters == nil {
+		return fmt.Errorf("%w: %s", ErrDeadLetterNotFound, id)
+	}
+
+	letter, ok := g.deadLetters.Get(id)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrDeadLetterNotFound, id)
+	}
+
+	event, err := eventbus.Decode(eventbus.Topic(letter.Topic), letter.Payload)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrMalformedEvent, err)
+	}
+
+	// removed first, a concurrent request does not replay it twice
+	if removed, err := g.deadLetters.Remove(id); err != nil {
+		return err
+	} else if !removed {
+		// replayed by a concurrent request
+		return fmt.Errorf("%w: %s", ErrDeadLetterNotFound, id)
+	}
+
+	if err := g.enqueue(event); err != nil {
+		// the event is not lost, it is kept under a new id
+		letter, addErr := g.deadLetters.Add(letter.Topic, letter.Payload, letter.Error)
+		if addErr != nil {
+			return errors.Join(err, addErr)
+		}
+
+		g.logger.Error("Dead letter not replayed",
+			slog.String("op", op),
+			slog.String("id", id),
+			slog.String("new_id", letter.ID),
+			slog.String("type", letter.Topic),
+			slog.String("err", err.Error()),
+		)
+		return err
+	}
+
+	g.logger.Info("Dead letter replayed",
+		slog.String("op", op),
+		slog.String("id", id),
+		slog.String("type", letter.Topic),
+	)
+
+	return nil
+}
+
+func deadLetterResponse(letter deadletter.Letter) payload.DeadLetterResponse {
+	return payload.DeadLetterResponse{
+		ID: letter.ID,
+		Topic: letter.Topic,
+		Payload: letter.Payload,
+		Error: letter.Error,
+		CreatedAt: letter.CreatedAt,
+	}
+}
@@ -0,0 +1,128 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/LashkaPashka/TaskDownloader/internal/config"
+	"github.com/LashkaPashka/TaskDownloader/internal/lib/deadletter"
+	eventbus "github.com/LashkaPashka/TaskDownloader/internal/lib/eventBus"
+	"github.com/LashkaPashka/TaskDownloader/internal/models"
+	"github.com/LashkaPashka/TaskDownloader/internal/payload"
+)
+
+func waitDeadLetters(t *testing.T, g *GoFetchService, count int) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(g.DeadLetters().DeadLetters) < count {
+		if time.Now().After(deadline) {
+			t.Fatalf("Error: expected %d dead letters, got %+v", count, g.DeadLetters())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestDeadLetters(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(testContent(1024))
+	}))
+	defer srv.Close()
+
+	g, task := newTestService(t, config.Downloader{Workers: 2, MaxFilesPerTask: 2, Segments: 1}, srv.URL+"/a.bin")
+
+	deadLetters, err := deadletter.Open(filepath.Join(t.TempDir(), "dead_letters.json"))
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	g.deadLetters = deadLetters
+
+	go g.CompleteTask()
+
+	// data of a wrong type and data the bus could not decode
+	g.eventBus.Publish(eventbus.Event{Type: eventbus.EventCreateTask, Data: task.ID})
+	g.eventBus.Publish(eventbus.Event{Type: eventbus.EventRetryTask, Data: json.RawMessage(`{"task_id":`)})
+
+	waitDeadLetters(t, g, 2)
+
+	letters := g.DeadLetters().DeadLetters
+	if letters[0].Topic != string(eventbus.EventRetryTask) || string(letters[0].Payload) != `"{\"task_id\":"` {
+		t.Fatalf("Error: unexpected dead letter %+v", letters[0])
+	}
+	if letters[1].Topic != string(eventbus.EventCreateTask) || string(letters[1].Payload) != `"`+task.ID+`"` || letters[1].Error == "" {
+		t.Fatalf("Error: unexpected dead letter %+v", letters[1])
+	}
+
+	if err := g.ReplayDeadLetter(letters[1].ID); !errors.Is(err, ErrMalformedEvent) {
+		t.Fatalf("Error: got %v, want %v", err, ErrMalformedEvent)
+	}
+	if err := g.ReplayDeadLetter("dl_unknown"); !errors.Is(err, ErrDeadLetterNotFound) {
+		t.Fatalf("Error: got %v, want %v", err, ErrDeadLetterNotFound)
+	}
+
+	// the cause is fixed, the event is replayed and the consumer still runs
+	body, _ := json.Marshal(models.EventData{ClientID: task.ClientID, TaskID: task.ID})
+	letter, err := deadLetters.Add(string(eventbus.EventCreateTask), body, "storage is down")
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	if err := g.ReplayDeadLetter(letter.ID); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if _, err := g.DeadLetter(letter.ID); !errors.Is(err, ErrDeadLetterNotFound) {
+		t.Fatalf("Error: replayed letter is still queued: %v", err)
+	}
+
+	waitFiles(t, g, task.ID, statusDone)
+
+	if count := len(g.DeadLetters().DeadLetters); count != 2 {
+		t.Fatalf("Error: expected 2 dead letters, got %d", count)
+	}
+}
+
+// downBus fails to publish like a NATS server that cannot be reached.
+type downBus struct {
+	eventbus.EventBus
+}
+
+func (downBus) Publish(event eventbus.Event) error {
+	return errors.New("nats: no servers available for connection")
+}
+
+func TestReplayKeepsLetterWhenEventIsLost(t *testing.T) {
+	g, task := newTestService(t, config.Downloader{Disabled: true}, "https://example.com/a.bin")
+	g.eventBus = downBus{g.eventBus}
+
+	deadLetters, err := deadletter.Open(filepath.Join(t.TempDir(), "dead_letters.json"))
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	g.deadLetters = deadLetters
+
+	body, _ := json.Marshal(models.EventData{ClientID: task.ClientID, TaskID: task.ID})
+	letter, err := deadLetters.Add(string(eventbus.EventCreateTask), body, "storage is down")
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	if err := g.ReplayDeadLetter(letter.ID); !errors.Is(err, ErrEventNotSent) {
+		t.Fatalf("Error: got %v, want %v", err, ErrEventNotSent)
+	}
+
+	letters := g.DeadLetters().DeadLetters
+	if len(letters) != 1 || string(letters[0].Payload) != string(body) || letters[0].Error != letter.Error {
+		t.Fatalf("Error: letter is lost: %+v", letters)
+	}
+
+	// the caller learns the files are queued without an event
+	_, err = g.AppendFiles(task.ID, payload.AppendFilesRequest{Urls: []payload.FileRequest{{Url: "https://example.com/b.bin"}}})
+	if !errors.Is(err, ErrEventNotSent) {
+		t.Fatalf("Error: got %v, want %v", err, ErrEventNotSent)
+	}
+}
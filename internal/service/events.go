@@ -0,0 +1,243 @@
+package service
+
+import (
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/LashkaPashka/TaskDownloader/internal/lib/hub"
+	"github.com/LashkaPashka/TaskDownloader/internal/lib/speed"
+	"github.com/LashkaPashka/TaskDownloader/internal/lib/taskstatus"
+	"github.com/LashkaPashka/TaskDownloader/internal/models"
+	"github.com/LashkaPashka/TaskDownloader/internal/payload"
+)
+
+// Types of the events streamed to clients.
+const (
+	EventTaskStatus = "task.status"
+	EventFileStatus = "file.status"
+	EventFileProgress = "file.progress"
+)
+
+const (
+	// progressInterval is the least time between two progress events of a file
+	progressInterval = 500 * time.Millisecond
+	// eventHistory is how many events are kept for subscribers that reconnect
+	eventHistory = 1024
+	eventBuffer = 256
+)
+
+// eventStorage publishes the changes saved through it: every status change of a task or a file
+// and the progress of a file at most once per progressInterval. Finished files and tasks get their webhooks,
+// their state and the bandwidth limiter of the task are dropped then.
+type eventStorage struct {
+	Storage
+	g *GoFetchService
+
+	mu sync.Mutex
+	tasks map[string]taskState
+	files map[speed.Key]fileState
+}
+
+type taskState struct {
+	clientID string
+	status string
+}
+
+type fileState struct {
+	status string
+	published time.Time
+}
+
+func newEventStorage(storage Storage, g *GoFetchService) *eventStorage {
+	return &eventStorage{
+		Storage: storage,
+		g: g,
+		tasks: make(map[string]taskState),
+		files: make(map[speed.Key]fileState),
+	}
+}
+
+func (s *eventStorage) SaveTask(task models.Task) (bool, error) {
+	success, err := s.Storage.SaveTask(task)
+	if err != nil {
+		return success, err
+	}
+
+	s.g.publish(EventTaskStatus, payload.TaskEvent{TaskID: task.ID, ClientID: task.ClientID, Status: task.Status})
+
+	return success, nil
+}
+
+func (s *eventStorage) SaveFile(taskID string, file *models.File) (bool, error) {
+	key := speed.Key{TaskID: taskID, Index: file.Index}
+
+	s.mu.Lock()
+	last, seen := s.files[key]
+	s.mu.Unlock()
+
+	// the state of a finished file is dropped, the saved status tells whether this save changes it
+	if !seen {
+		if stored, err := s.Storage.GetFileById(taskID, file.Index); err == nil {
+			last, seen = fileState{status: stored.Status}, true
+		}
+	}
+
+	success, err := s.Storage.SaveFile(taskID, file)
+	if err != nil {
+		return success, err
+	}
+
+	now := time.Now()
+	changed := !seen || last.status != file.Status
+	if !changed && now.Sub(last.published) < progressInterval {
+		return success, nil
+	}
+
+	s.mu.Lock()
+	if fileFinished(file.Status) {
+		delete(s.files, key)
+	} else {
+		s.files[key] = fileState{status: file.Status, published: now}
+	}
+	s.mu.Unlock()
+
+	if changed {
+		s.taskChanged(taskID, file.Index)
+		return success, nil
+	}
+
+	status := s.g.fileStatus(taskID, *file)
+	s.g.publish(EventFileProgress, payload.TaskEvent{TaskID: taskID, ClientID: s.clientID(taskID), File: &status})
+
+	return success, nil
+}
+
+func (s *eventStorage) AppendFiles(taskID string, files []models.File) ([]models.File, error) {
+	appended, err := s.Storage.AppendFiles(taskID, files)
+	if err != nil {
+		return nil, err
+	}
+
+	indexes := make([]int, 0, len(appended))
+	for _, file := range appended {
+		indexes = append(indexes, file.Index)
+	}
+	s.taskChanged(taskID, indexes...)
+
+	return appended, nil
+}
+
+// taskChanged publishes the saved state of the files and the status of the task when it changed.
+// The timestamps of the files are set by the storage, they are read back from it.
+func (s *eventStorage) taskChanged(taskID string, indexes ...int) {
+	const op = "TaskDownloader.service.eventStorage.taskChanged"
+
+	task, err := s.Storage.GetTask(taskID)
+	if err != nil || task.ID == "" {
+		if err == nil {
+			err = fmt.Errorf("%w: %s", ErrTaskNotFound, taskID)
+		}
+		s.g.logger.Error("Failed to get task for its events",
+			slog.String("op", op),
+			slog.String("task_id", taskID),
+			slog.String("err", err.Error()),
+		)
+		return
+	}
+
+	for _, index := range indexes {
+		for _, file := range task.File {
+			if file.Index != index {
+				continue
+			}
+
+			status := s.g.fileStatus(taskID, file)
+			s.g.publish(EventFileStatus, payload.TaskEvent{TaskID: taskID, ClientID: task.ClientID, File: &status})
+			s.g.notifyFile(task, status)
+		}
+	}
+
+	s.mu.Lock()
+	last := s.tasks[taskID]
+	if taskFinished(task.Status) {
+		delete(s.tasks, taskID)
+	} else {
+		s.tasks[taskID] = taskState{clientID: task.ClientID, status: task.Status}
+	}
+	s.mu.Unlock()
+
+	if last.status != task.Status {
+		s.g.publish(EventTaskStatus, payload.TaskEvent{TaskID: taskID, ClientID: task.ClientID, Status: task.Status})
+		s.g.notifyTask(task)
+	}
+
+	// the limiter is registered again if the task is reopened
+	if taskFinished(task.Status) {
+		s.g.bandwidth.RemoveTask(taskID)
+	}
+}
+
+func fileFinished(status string) bool {
+	return status == statusDone || status == statusFailed || status == statusCancelled
+}
+
+func taskFinished(status string) bool {
+	return status == taskstatus.Completed || status == taskstatus.Failed || status == taskstatus.Cancelled
+}
+
+// clientID of the task, it is looked up in the storage once.
+func (s *eventStorage) clientID(taskID string) string {
+	s.mu.Lock()
+	state, ok := s.tasks[taskID]
+	s.mu.Unlock()
+	if ok {
+		return state.clientID
+	}
+
+	task, err := s.Storage.GetTask(taskID)
+	if err != nil || task.ID == "" {
+		return ""
+	}
+
+	s.mu.Lock()
+	if _, ok := s.tasks[taskID]; !ok {
+		s.tasks[taskID] = taskState{clientID: task.ClientID, status: task.Status}
+	}
+	s.mu.Unlock()
+
+	return task.ClientID
+}
+
+func (g *GoFetchService) publish(eventType string, data payload.TaskEvent) {
+	g.events.Publish(hub.Event{
+		Type: eventType,
+		TaskID: data.TaskID,
+		ClientID: data.ClientID,
+		Data: data,
+	})
+}
+
+// SubscribeTask returns the events of the task published after the event afterID and a subscription to the next ones.
+func (g *GoFetchService) SubscribeTask(taskID string, afterID uint64) ([]hub.Event, *hub.Subscription, error) {
+	task, err := g.storage.GetTask(taskID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if task.ID == "" {
+		return nil, nil, fmt.Errorf("%w: %s", ErrTaskNotFound, taskID)
+	}
+
+	return g.events.Subscribe(hub.Filter{TaskID: taskID}, afterID)
+}
+
+// SubscribeClient is SubscribeTask for all the tasks of the client, including the ones created later.
+func (g *GoFetchService) SubscribeClient(clientID string, afterID uint64) ([]hub.Event, *hub.Subscription, error) {
+	return g.events.Subscribe(hub.Filter{ClientID: clientID}, afterID)
+}
+
+// CloseEvents ends all subscriptions, streams to clients would keep the server from shutting down otherwise.
+func (g *GoFetchService) CloseEvents() {
+	g.events.Close()
+}
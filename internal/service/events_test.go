@@ -0,0 +1,111 @@
+package service
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/LashkaPashka/TaskDownloader/internal/config"
+	eventbus "github.com/LashkaPashka/TaskDownloader/internal/lib/eventBus"
+	"github.com/LashkaPashka/TaskDownloader/internal/lib/hub"
+	"github.com/LashkaPashka/TaskDownloader/internal/models"
+	"github.com/LashkaPashka/TaskDownloader/internal/payload"
+)
+
+// collectEvents reads the subscription until the task has the status.
+func collectEvents(t *testing.T, sub *hub.Subscription, status string) []hub.Event {
+	t.Helper()
+
+	var events []hub.Event
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case event, ok := <-sub.C:
+			if !ok {
+				t.Fatalf("Error: subscription closed after %d events", len(events))
+			}
+			events = append(events, event)
+
+			if data := event.Data.(payload.TaskEvent); event.Type == EventTaskStatus && data.Status == status {
+				return events
+			}
+		case <-timeout:
+			t.Fatalf("Error: task did not become %s, got %d events", status, len(events))
+		}
+	}
+}
+
+func TestTaskEvents(t *testing.T) {
+	content := testContent(4096)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(content)
+	}))
+	defer srv.Close()
+
+	g, task := newTestService(t, config.Downloader{Workers: 1, MaxFilesPerTask: 1, Segments: 1}, srv.URL+"/a.bin")
+
+	if _, _, err := g.SubscribeTask("unknown", 0); !errors.Is(err, ErrTaskNotFound) {
+		t.Fatalf("Error: got %v, want %v", err, ErrTaskNotFound)
+	}
+
+	_, sub, err := g.SubscribeTask(task.ID, 0)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	defer sub.Close()
+
+	_, other, _ := g.SubscribeClient("other-client", 0)
+	defer other.Close()
+
+	go g.CompleteTask()
+	g.eventBus.Publish(eventbus.Event{
+		Type: eventbus.EventCreateTask,
+		Data: models.EventData{ClientID: task.ClientID, TaskID: task.ID},
+	})
+
+	events := collectEvents(t, sub, "completed")
+
+	var statuses []string
+	for i, event := range events {
+		if i > 0 && event.ID <= events[i-1].ID {
+			t.Fatalf("Error: events are out of order %+v", events)
+		}
+
+		data := event.Data.(payload.TaskEvent)
+		if data.TaskID != task.ID || data.ClientID != task.ClientID {
+			t.Fatalf("Error: unexpected event %+v", event)
+		}
+		if event.Type == EventFileStatus {
+			statuses = append(statuses, data.File.Status)
+		}
+	}
+
+	if len(statuses) != 2 || statuses[0] != statusInProgress || statuses[1] != statusDone {
+		t.Fatalf("Error: unexpected file statuses %v", statuses)
+	}
+	if done := events[len(events)-2].Data.(payload.TaskEvent).File; done.Percent != 100 || done.FinishedAt == nil {
+		t.Fatalf("Error: unexpected done file %+v", done)
+	}
+	if len(other.C) != 0 {
+		t.Fatalf("Error: events were sent to another client")
+	}
+
+	// a client that reconnects gets the events after the last one it saw
+	replay, again, _ := g.SubscribeClient(task.ClientID, events[0].ID)
+	defer again.Close()
+
+	if len(replay) != len(events)-1 || replay[0].ID != events[1].ID {
+		t.Fatalf("Error: replayed %d events, want %d", len(replay), len(events)-1)
+	}
+
+	// nothing is kept of the finished task
+	tracked := g.storage.(*eventStorage)
+	tracked.mu.Lock()
+	tasks, files := len(tracked.tasks), len(tracked.files)
+	tracked.mu.Unlock()
+	if tasks != 0 || files != 0 {
+		t.Fatalf("Error: %d tasks and %d files are still tracked", tasks, files)
+	}
+}
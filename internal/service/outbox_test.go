@@ -0,0 +1,76 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/LashkaPashka/TaskDownloader/internal/config"
+	eventbus "github.com/LashkaPashka/TaskDownloader/internal/lib/eventBus"
+	"github.com/LashkaPashka/TaskDownloader/internal/lib/eventlog"
+	"github.com/LashkaPashka/TaskDownloader/internal/models"
+	"github.com/LashkaPashka/TaskDownloader/internal/payload"
+)
+
+func waitAcked(t *testing.T, outbox *eventlog.Log, offset uint64) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for outbox.Offset(downloaderGroup) < offset {
+		if time.Now().After(deadline) {
+			t.Fatalf("Error: offset %d was not acknowledged, got %d", offset, outbox.Offset(downloaderGroup))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestOutbox(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(testContent(1024))
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	downloader := config.Downloader{Workers: 2, MaxFilesPerTask: 2, Segments: 1}
+
+	// a crash after the task was saved, before its event was dispatched
+	g, task := newTestService(t, downloader, srv.URL+"/a.bin")
+
+	outbox, err := eventlog.Open(dir)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if _, err := outbox.Append(string(eventbus.EventCreateTask), models.EventData{ClientID: task.ClientID, TaskID: task.ID}); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	outbox.Close()
+
+	outbox, err = eventlog.Open(dir)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	defer outbox.Close()
+	g.outbox = outbox
+
+	go g.CompleteTask()
+	g.redeliver()
+
+	waitFiles(t, g, task.ID, statusDone)
+	waitAcked(t, outbox, 1)
+
+	if _, err := g.SaveTask(payload.SaveTaskRequest{ClientID: "client", Urls: []payload.FileRequest{{Url: srv.URL + "/b.bin"}}}); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	waitAcked(t, outbox, 2)
+	if pending := outbox.Pending(downloaderGroup); len(pending) != 0 {
+		t.Fatalf("Error: unexpected pending records %+v", pending)
+	}
+
+	page, err := g.storage.ListTasks(models.TaskFilter{URL: "/b.bin"})
+	if err != nil || len(page.Tasks) != 1 {
+		t.Fatalf("Error: saved task not found: %v", err)
+	}
+	waitFiles(t, g, page.Tasks[0].ID, statusDone)
+}
@@ -0,0 +1,239 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+
+	eventbus "github.com/LashkaPashka/TaskDownloader/internal/lib/eventBus"
+	"github.com/LashkaPashka/TaskDownloader/internal/models"
+)
+
+var (
+	ErrFileNotFound = errors.New("file not found")
+	ErrFileFinished = errors.New("file already finished")
+)
+
+// PauseTask stops the downloads of the task and keeps its queued files from starting.
+// The progress is kept, the files continue from where they stopped on resume.
+// Without the downloader in this process the pause is sent to it as an event.
+func (g *GoFetchService) PauseTask(taskID string) error {
+	return g.pause(taskID)
+}
+
+func (g *GoFetchService) PauseFile(taskID string, index int) error {
+	return g.pause(taskID, index)
+}
+
+// ResumeTask queues the paused files of the task again.
+func (g *GoFetchService) ResumeTask(taskID string) error {
+	return g.resume(taskID)
+}
+
+func (g *GoFetchService) ResumeFile(taskID string, index int) error {
+	return g.resume(taskID, index)
+}
+
+// findFiles returns the task and the indexes of its files, all of them when indexes is empty.
+func (g *GoFetchService) findFiles(taskID string, indexes []int) (models.Task, []int, error) {
+	task, err := g.storage.GetTask(taskID)
+	if err != nil {
+		return models.Task{}, nil, err
+	}
+	if task.ID == "" {
+		return models.Task{}, nil, fmt.Errorf("%w: %s", ErrTaskNotFound, taskID)
+	}
+
+	if len(indexes) == 0 {
+		for _, file := range task.File {
+			indexes = append(indexes, file.Index)
+		}
+		return task, indexes, nil
+	}
+
+	for _, index := range indexes {
+		if !slices.ContainsFunc(task.File, func(file models.File) bool { return file.Index == index }) {
+			return models.Task{}, nil, fmt.Errorf("%w: %s/%d", ErrFileNotFound, taskID, index)
+		}
+	}
+
+	return task, indexes, nil
+}
+
+func pausable(file models.File) bool {
+	return file.Status == statusQueued || file.Status == statusInProgress
+}
+
+func (g *GoFetchService) pause(taskID string, indexes ...int) error {
+	const op = "TaskDownloader.service.pause"
+
+	// files asked for by index must be pausable, a whole task just skips its finished files
+	explicit := len(indexes) > 0
+
+	task, indexes, err := g.findFiles(taskID, indexes)
+	if err != nil {
+		return err
+	}
+
+	var targets []int
+	for _, file := range task.File {
+		if !slices.Contains(indexes, file.Index) || file.Status == statusPaused {
+			continue
+		}
+		if !pausable(file) {
+			if explicit {
+				return fmt.Errorf("%w: %s/%d", ErrFileFinished, taskID, file.Index)
+			}
+			continue
+		}
+		targets = append(targets, file.Index)
+	}
+
+	// the downloader saves the status once it has stopped the files, a status saved here
+	// would be overwritten by the progress it saves meanwhile
+	if g.downloader.Disabled {
+		if len(targets) == 0 {
+			return nil
+		}
+
+		data := models.EventData{ClientID: task.ClientID, TaskID: task.ID}
+		if explicit {
+			data.Indexes = targets
+		}
+
+		if err := g.enqueue(eventbus.Event{Type: eventbus.EventPauseFiles, Data: data}); err != nil {
+			g.logger.Error("Failed to send pause to the downloader",
+				slog.String("op", op),
+				slog.String("task_id", taskID),
+				slog.String("err", err.Error()),
+			)
+			return err
+		}
+		return nil
+	}
+
+	// keep the files from starting, then stop those in flight
+	var running []*fileRun
+	g.runsMu.Lock()
+	if run, ok := g.runs[taskID]; ok {
+		for _, index := range targets {
+			run.paused[index] = true
+			if fr := run.files[index]; fr != nil {
+				running = append(running, fr)
+			}
+		}
+	}
+	g.runsMu.Unlock()
+
+	for _, fr := range running {
+		fr.cancel()
+		<-fr.done
+	}
+
+	// the stopped downloads have saved their progress, reload it
+	task, err = g.storage.GetTask(taskID)
+	if err != nil {
+		return err
+	}
+
+	for i := range task.File {
+		file := &task.File[i]
+		if !slices.Contains(targets, file.Index) || !pausable(*file) {
+			continue
+		}
+
+		file.Status = statusPaused
+		if _, err := g.storage.SaveFile(taskID, file); err != nil {
+			g.logger.Error("Failed to save file status",
+				slog.String("op", op),
+				slog.String("task_id", taskID),
+				slog.String("err", err.Error()),
+			)
+			return err
+		}
+	}
+
+	g.logger.Info("Files paused",
+		slog.String("op", op),
+		slog.String("task_id", taskID),
+		slog.Any("files", targets),
+	)
+
+	return nil
+}
+
+func (g *GoFetchService) resume(taskID string, indexes ...int) error {
+	const op = "TaskDownloader.service.resume"
+
+	task, indexes, err := g.findFiles(taskID, indexes)
+	if err != nil {
+		return err
+	}
+
+	var files []*models.File
+	for i := range task.File {
+		if slices.Contains(indexes, task.File[i].Index) && task.File[i].Status == statusPaused {
+			files = append(files, &task.File[i])
+		}
+	}
+
+	resumed := make([]int, 0, len(files))
+	for _, file := range files {
+		file.Status = statusQueued
+		if _, err := g.storage.SaveFile(taskID, file); err != nil {
+			g.logger.Error("Failed to save file status",
+				slog.String("op", op),
+				slog.String("task_id", taskID),
+				slog.String("err", err.Error()),
+			)
+			return err
+		}
+		resumed = append(resumed, file.Index)
+	}
+
+	if len(resumed) == 0 {
+		return nil
+	}
+
+	// the downloader may run in another process, it learns about the files from the event
+	err = g.enqueue(eventbus.Event{
+		Type: eventbus.EventResumeFiles,
+		Data: models.EventData{
+			ClientID: task.ClientID,
+			TaskID: task.ID,
+			Indexes: resumed,
+		},
+	})
+	if err != nil {
+		g.logger.Error("Failed to queue resumed files",
+			slog.String("op", op),
+			slog.String("task_id", taskID),
+			slog.String("err", err.Error()),
+		)
+		return err
+	}
+
+	g.logger.Info("Files resumed",
+		slog.String("op", op),
+		slog.String("task_id", taskID),
+		slog.Any("files", resumed),
+	)
+
+	return nil
+}
+
+// unpause lets the file start again once its saved status is no longer paused.
+// A file paused while waiting for a worker is still in the queue, it is not queued twice.
+func (g *GoFetchService) unpause(taskID string, file models.File) {
+	if file.Status == statusPaused {
+		return
+	}
+
+	g.runsMu.Lock()
+	defer g.runsMu.Unlock()
+
+	if run, ok := g.runs[taskID]; ok {
+		delete(run.paused, file.Index)
+	}
+}
@@ -0,0 +1,228 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/LashkaPashka/TaskDownloader/internal/config"
+	eventbus "github.com/LashkaPashka/TaskDownloader/internal/lib/eventBus"
+	"github.com/LashkaPashka/TaskDownloader/internal/lib/taskstatus"
+	"github.com/LashkaPashka/TaskDownloader/internal/models"
+)
+
+func TestPauseAndResumeFile(t *testing.T) {
+	content := testContent(2048)
+
+	// the first request sends half of the file and hangs, the resumed one asks for the rest
+	started := make(chan struct{}, 1)
+	var ranges []string
+	var rangesMu sync.Mutex
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rangesMu.Lock()
+		ranges = append(ranges, r.Header.Get("Range"))
+		rangesMu.Unlock()
+
+		if r.Header.Get("Range") != "" {
+			http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(content))
+			return
+		}
+
+		w.Header().Set("Content-Length", "2048")
+		w.Write(content[:1024])
+		w.(http.Flusher).Flush()
+		started <- struct{}{}
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+
+	g, task := newTestService(t, config.Downloader{Workers: 1, MaxFilesPerTask: 1, Segments: 1}, srv.URL+"/a.bin")
+
+	// resumed files are handed to the downloader as an event
+	go g.CompleteTask()
+
+	g.scheduleFile(&sync.Mutex{}, task.ID, &task.File[0])
+
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Error: download did not start")
+	}
+	// wait until the received half is saved
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		file, _ := g.storage.GetFileById(task.ID, 1)
+		if file.DownloadedBytes == 1024 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Error: progress was not saved: %+v", file)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err := g.PauseFile(task.ID, 1); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	paused, err := g.storage.GetTask(task.ID)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if paused.Status != taskstatus.Paused || paused.File[0].Status != statusPaused || paused.File[0].DownloadedBytes != 1024 {
+		t.Fatalf("Error: unexpected task after pause %+v", paused)
+	}
+
+	if err := g.ResumeFile(task.ID, 1); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	done := waitFiles(t, g, task.ID, statusDone)
+	if done.Status != taskstatus.Completed {
+		t.Fatalf("Error: task status %s, want %s", done.Status, taskstatus.Completed)
+	}
+
+	got, err := os.ReadFile(filepath.Join(g.localStoragePath, task.ID, task.File[0].Filename))
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Fatalf("Error: downloaded %d bytes do not match the origin", len(got))
+	}
+
+	rangesMu.Lock()
+	defer rangesMu.Unlock()
+	if len(ranges) != 2 || ranges[1] != "bytes=1024-" {
+		t.Fatalf("Error: requests with ranges %q, want the second to continue from 1024", ranges)
+	}
+}
+
+func TestPauseQueuedTask(t *testing.T) {
+	g, task := newTestService(t, config.Downloader{Workers: 1, MaxFilesPerTask: 1}, "http://example.com/a.bin", "http://example.com/b.bin")
+
+	if err := g.PauseTask(task.ID); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	paused := waitFiles(t, g, task.ID, statusPaused)
+	if paused.Status != taskstatus.Paused {
+		t.Fatalf("Error: task status %s, want %s", paused.Status, taskstatus.Paused)
+	}
+
+	// paused files are left alone at startup
+	fileMp, err := g.storage.ResetToQueued()
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if len(fileMp[task.ID]) != 0 {
+		t.Fatalf("Error: paused files were queued again: %+v", fileMp[task.ID])
+	}
+
+	if err := g.PauseFile(task.ID, 3); !errors.Is(err, ErrFileNotFound) {
+		t.Fatalf("Error: got %v, want %v", err, ErrFileNotFound)
+	}
+}
+
+func TestResumeOnAPIOnlyNode(t *testing.T) {
+	g, task := newTestService(t, config.Downloader{Disabled: true}, "http://example.com/a.bin", "http://example.com/b.bin")
+
+	events := g.eventBus.Subscribe(eventbus.EventResumeFiles)
+	defer g.eventBus.Unsubscribe(events)
+
+	task.File[1].Status = statusPaused
+	if _, err := g.storage.SaveFile(task.ID, &task.File[1]); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	if err := g.ResumeTask(task.ID); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	select {
+	case event := <-events.C:
+		data, ok := event.Data.(models.EventData)
+		if !ok || data.TaskID != task.ID || len(data.Indexes) != 1 || data.Indexes[0] != 2 {
+			t.Fatalf("Error: unexpected event %+v", event)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Error: resume was not sent to the downloader")
+	}
+
+	// the file waits for the downloader, nothing is started here
+	g.runsMu.Lock()
+	runs := len(g.runs)
+	g.runsMu.Unlock()
+	if runs != 0 {
+		t.Fatalf("Error: the API-only node started %d downloads", runs)
+	}
+
+	if file, _ := g.storage.GetFileById(task.ID, 2); file.Status != statusQueued {
+		t.Fatalf("Error: resumed file %+v, want queued", file)
+	}
+}
+
+func TestPauseAndCancelOnAPIOnlyNode(t *testing.T) {
+	api, task := newTestService(t, config.Downloader{Disabled: true}, "http://example.com/a.bin", "http://example.com/b.bin")
+
+	events := api.eventBus.Subscribe(eventbus.EventPauseFiles, eventbus.EventCancelTask)
+	defer api.eventBus.Unsubscribe(events)
+
+	if err := api.PauseFile(task.ID, 2); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if err := api.CancelTask(task.ID, true); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	// the statuses are left to the downloader
+	if saved := waitFiles(t, api, task.ID, statusQueued); saved.Status == statusCancelled {
+		t.Fatalf("Error: the API-only node saved the task %+v", saved)
+	}
+
+	// the same service plays the downloader that shares the storage
+	g := api
+	g.downloader.Disabled = false
+
+	for _, want := range []eventbus.Topic{eventbus.EventPauseFiles, eventbus.EventCancelTask} {
+		select {
+		case event := <-events.C:
+			data := event.Data.(models.EventData)
+			if event.Type != want || data.TaskID != task.ID {
+				t.Fatalf("Error: unexpected event %+v", event)
+			}
+			if event.Type == eventbus.EventPauseFiles && (len(data.Indexes) != 1 || data.Indexes[0] != 2) {
+				t.Fatalf("Error: unexpected pause %+v", data)
+			}
+			if event.Type == eventbus.EventCancelTask && !data.Purge {
+				t.Fatalf("Error: purge is lost %+v", data)
+			}
+
+			if err := g.handleJob(event); err != nil {
+				t.Fatalf("Error: %v", err)
+			}
+			if event.Type == eventbus.EventPauseFiles {
+				if file, _ := g.storage.GetFileById(task.ID, 2); file.Status != statusPaused {
+					t.Fatalf("Error: file %+v, want paused", file)
+				}
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Error: %s was not sent to the downloader", want)
+		}
+	}
+
+	waitFiles(t, g, task.ID, statusCancelled)
+
+	// a pause of a task that has finished meanwhile is not a failure of the downloader
+	if err := g.handleJob(eventbus.Event{
+		Type: eventbus.EventPauseFiles,
+		Data: models.EventData{TaskID: task.ID, Indexes: []int{1}},
+	}); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+}
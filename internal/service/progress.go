@@ -0,0 +1,124 @@
+package service
+
+import (
+	"math"
+	"time"
+
+	"github.com/LashkaPashka/TaskDownloader/internal/lib/speed"
+	"github.com/LashkaPashka/TaskDownloader/internal/models"
+	"github.com/LashkaPashka/TaskDownloader/internal/payload"
+)
+
+// speedWindow is how far back the reads of a file count for its current speed.
+const speedWindow = 5 * time.Second
+
+// TaskStatus returns the task with the progress of each of its files and a summary of the whole task.
+// Speed and eta are measured over the last seconds of the downloads running in this process.
+func (g *GoFetchService) TaskStatus(task models.Task) payload.GetStatusOfTaskResponse {
+	resp := payload.GetStatusOfTaskResponse{
+		Files: make([]payload.StatusOfFileResponse, 0, len(task.File)),
+		Status: task.Status,
+		TaskID: task.ID,
+		ClientID: task.ClientID,
+		CreatedAt: task.CreatedAt,
+	}
+
+	progress := &resp.Progress
+	progress.TotalFiles = len(task.File)
+
+	var remaining int64
+	for _, file := range task.File {
+		status := g.fileStatus(task.ID, file)
+		resp.Files = append(resp.Files, status)
+
+		switch file.Status {
+		case statusDone:
+			progress.DoneFiles++
+		case statusFailed:
+			progress.FailedFiles++
+		}
+
+		if file.Size > 0 {
+			progress.TotalBytes += file.Size
+			progress.DownloadedBytes += min(file.DownloadedBytes, file.Size)
+			if unfinished(file.Status) {
+				remaining += max(file.Size-file.DownloadedBytes, 0)
+			}
+		}
+		progress.BytesPerSec += status.BytesPerSec
+	}
+
+	if progress.TotalBytes > 0 {
+		progress.Percent = percent(progress.DownloadedBytes, progress.TotalBytes)
+	} else if progress.TotalFiles > 0 && progress.DoneFiles == progress.TotalFiles {
+		progress.Percent = 100
+	}
+	progress.EtaSeconds = eta(remaining, progress.BytesPerSec)
+
+	return resp
+}
+
+func (g *GoFetchService) fileStatus(taskID string, file models.File) payload.StatusOfFileResponse {
+	status := payload.StatusOfFileResponse{
+		Index: file.Index,
+		Url: file.Url,
+		DownloadedBytes: file.DownloadedBytes,
+		Size: file.Size,
+		Filename: file.Filename,
+		Status: file.Status,
+		StartedAt: timeOrNil(file.StartedAt),
+		FinishedAt: timeOrNil(file.FinishedAt),
+		Attempts: file.Attempts,
+		LastError: file.LastError,
+		FailReason: file.FailReason,
+	}
+
+	if file.Status == statusQueued {
+		status.NextAttemptAt = timeOrNil(file.NextAttemptAt)
+	}
+
+	switch {
+	case file.Status == statusDone:
+		status.Percent = 100
+	case file.Size > 0:
+		status.Percent = percent(file.DownloadedBytes, file.Size)
+	}
+
+	if file.Status == statusInProgress {
+		status.BytesPerSec = g.speed.Rate(speed.Key{TaskID: taskID, Index: file.Index})
+		if file.Size > 0 {
+			status.EtaSeconds = eta(file.Size-file.DownloadedBytes, status.BytesPerSec)
+		}
+	}
+
+	return status
+}
+
+// unfinished reports whether a file with the status is still going to be downloaded.
+func unfinished(status string) bool {
+	return status == statusQueued || status == statusInProgress || status == statusPaused
+}
+
+// percent is rounded to one decimal and never exceeds 100.
+func percent(downloaded, size int64) float64 {
+	return math.Min(math.Round(float64(downloaded)*1000/float64(size))/10, 100)
+}
+
+// eta is nil while nothing is being read, the remaining bytes could take any time then.
+func eta(remaining, bytesPerSec int64) *int64 {
+	if bytesPerSec <= 0 || remaining < 0 {
+		return nil
+	}
+
+	seconds := (remaining + bytesPerSec - 1) / bytesPerSec
+
+	return &seconds
+}
+
+func timeOrNil(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+
+	return &t
+}
@@ -0,0 +1,86 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/LashkaPashka/TaskDownloader/internal/lib/speed"
+	"github.com/LashkaPashka/TaskDownloader/internal/models"
+)
+
+func TestTaskStatus(t *testing.T) {
+	g := &GoFetchService{speed: speed.New(speedWindow)}
+	g.speed.Add(speed.Key{TaskID: "task", Index: 2}, 1000)
+
+	finished := time.Now()
+	task := models.Task{
+		ID: "task",
+		ClientID: "client",
+		Status: "running",
+		File: []models.File{
+			{Index: 1, Url: "http://a", Status: statusDone, Size: 1000, DownloadedBytes: 1000, FinishedAt: finished},
+			{Index: 2, Url: "http://b", Status: statusInProgress, Size: 4000, DownloadedBytes: 1000},
+			{Index: 3, Url: "http://c", Status: statusQueued},
+			{Index: 4, Url: "http://d", Status: statusFailed, Size: 1000, DownloadedBytes: 500, LastError: "boom"},
+		},
+	}
+
+	resp := g.TaskStatus(task)
+
+	if len(resp.Files) != 4 || resp.TaskID != "task" || resp.ClientID != "client" {
+		t.Fatalf("Error: unexpected response %+v", resp)
+	}
+
+	done := resp.Files[0]
+	if done.Percent != 100 || done.FinishedAt == nil || !done.FinishedAt.Equal(finished) || done.StartedAt != nil {
+		t.Fatalf("Error: unexpected done file %+v", done)
+	}
+	if done.BytesPerSec != 0 || done.EtaSeconds != nil {
+		t.Fatalf("Error: finished file has speed %d and eta %v", done.BytesPerSec, done.EtaSeconds)
+	}
+
+	running := resp.Files[1]
+	if running.Percent != 25 || running.Size != 4000 || running.Url != "http://b" || running.Index != 2 {
+		t.Fatalf("Error: unexpected running file %+v", running)
+	}
+	if running.BytesPerSec <= 0 || running.EtaSeconds == nil {
+		t.Fatalf("Error: running file has no speed or eta: %+v", running)
+	}
+	if want := (3000 + running.BytesPerSec - 1) / running.BytesPerSec; *running.EtaSeconds != want {
+		t.Fatalf("Error: got eta %d, want %d", *running.EtaSeconds, want)
+	}
+
+	if queued := resp.Files[2]; queued.Percent != 0 || queued.EtaSeconds != nil {
+		t.Fatalf("Error: unexpected queued file %+v", queued)
+	}
+	if failed := resp.Files[3]; failed.Percent != 50 || failed.LastError != "boom" {
+		t.Fatalf("Error: unexpected failed file %+v", failed)
+	}
+
+	progress := resp.Progress
+	if progress.TotalFiles != 4 || progress.DoneFiles != 1 || progress.FailedFiles != 1 {
+		t.Fatalf("Error: unexpected file counts %+v", progress)
+	}
+	if progress.TotalBytes != 6000 || progress.DownloadedBytes != 2500 || progress.Percent != 41.7 {
+		t.Fatalf("Error: unexpected bytes %+v", progress)
+	}
+	// the failed file is not going to be downloaded, only the running one is left
+	if progress.BytesPerSec != running.BytesPerSec || progress.EtaSeconds == nil || *progress.EtaSeconds != *running.EtaSeconds {
+		t.Fatalf("Error: unexpected speed %+v", progress)
+	}
+}
+
+func TestTaskStatusWithoutSizes(t *testing.T) {
+	g := &GoFetchService{}
+
+	resp := g.TaskStatus(models.Task{
+		ID: "task",
+		File: []models.File{
+			{Index: 1, Status: statusDone},
+		},
+	})
+
+	if resp.Progress.Percent != 100 || resp.Progress.EtaSeconds != nil || resp.Files[0].Percent != 100 {
+		t.Fatalf("Error: unexpected progress %+v", resp.Progress)
+	}
+}
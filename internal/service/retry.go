@@ -0,0 +1,181 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/LashkaPashka/TaskDownloader/internal/lib/retry"
+	"github.com/LashkaPashka/TaskDownloader/internal/models"
+)
+
+const (
+	reasonPermanentError   = "permanent_error"
+	reasonRetriesExhausted = "retries_exhausted"
+)
+
+var errInvalidURL = errors.New("invalid url")
+
+// StatusError is returned when the origin answers with an unexpected HTTP status.
+type StatusError struct {
+	Code       int
+	Status     string
+	RetryAfter time.Duration
+}
+
+func newStatusError(resp *http.Response) *StatusError {
+	return &StatusError{
+		Code:       resp.StatusCode,
+		Status:     resp.Status,
+		RetryAfter: retry.ParseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+	}
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected status %s", e.Status)
+}
+
+// validateURL rejects urls that can never be downloaded.
+func validateURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("%w: %s", errInvalidURL, err.Error())
+	}
+
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%w: %s", errInvalidURL, rawURL)
+	}
+
+	return nil
+}
+
+// classify tells whether err is worth another attempt and the minimal delay the origin asked for.
+func classify(err error) (retryable bool, retryAfter time.Duration) {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		switch {
+		case statusErr.Code == http.StatusTooManyRequests,
+			statusErr.Code == http.StatusRequestTimeout,
+			statusErr.Code >= 500:
+			return true, statusErr.RetryAfter
+		}
+		return false, 0
+	}
+
+	if errors.Is(err, errInvalidURL) || errors.Is(err, errChecksumMismatch) {
+		return false, 0
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return !dnsErr.IsNotFound, 0
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true, 0
+	}
+
+	if errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNABORTED) ||
+		errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, context.DeadlineExceeded) {
+		return true, 0
+	}
+
+	// the remaining transport errors (broken connections, TLS handshakes) are usually transient
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return true, 0
+	}
+
+	return false, 0
+}
+
+func (g *GoFetchService) retryPolicy() retry.Policy {
+	return retry.Policy{
+		MaxAttempts: g.downloader.Retry.MaxAttempts,
+		BaseBackoff: g.downloader.Retry.BaseBackoff,
+		MaxBackoff:  g.downloader.Retry.MaxBackoff,
+		Jitter:      g.downloader.Retry.Jitter,
+	}
+}
+
+// attemptDownload makes one attempt of the download. When the error is worth another attempt,
+// the file is saved as queued with the time of the next attempt and the delay before it is returned.
+// Attempts and the last error are saved on the file.
+func (g *GoFetchService) attemptDownload(ctx context.Context, mux *sync.Mutex, taskID string, file *models.File) (time.Duration, error) {
+	const op = "TaskDownloader.service.attemptDownload"
+
+	policy := g.retryPolicy()
+
+	file.Attempts++
+	file.NextAttemptAt = time.Time{}
+
+	err := validateURL(file.Url)
+	if err == nil {
+		err = g.DownloadWithResume(ctx, mux, taskID, file)
+	}
+	if err == nil {
+		return 0, nil
+	}
+
+	// a cancelled download is neither an attempt nor a failure
+	if ctx.Err() != nil {
+		file.Attempts--
+		return 0, ctx.Err()
+	}
+
+	file.LastError = err.Error()
+
+	retryable, retryAfter := classify(err)
+	if !retryable || policy.Exhausted(file.Attempts) {
+		if file.FailReason == "" {
+			file.FailReason = reasonPermanentError
+			if retryable {
+				file.FailReason = reasonRetriesExhausted
+			}
+		}
+
+		return 0, err
+	}
+
+	// the origin does not get to park the file for longer than the policy allows
+	if policy.MaxBackoff > 0 {
+		retryAfter = min(retryAfter, policy.MaxBackoff)
+	}
+	wait := max(policy.Backoff(file.Attempts), retryAfter)
+
+	// the file does not look in progress while it waits
+	file.Status = statusQueued
+	file.NextAttemptAt = time.Now().Add(wait)
+
+	g.logger.Warn("Download failed, retry later",
+		slog.String("op", op),
+		slog.String("task_id", taskID),
+		slog.String("url", file.Url),
+		slog.Int("attempt", file.Attempts),
+		slog.Duration("wait", wait),
+		slog.String("err", err.Error()),
+	)
+
+	if _, err := g.storage.SaveFile(taskID, file); err != nil {
+		g.logger.Error("Failed to save file status",
+			slog.String("op", op),
+			slog.String("err", err.Error()),
+			slog.String("task_id", taskID),
+		)
+	}
+
+	return wait, err
+}
@@ -0,0 +1,190 @@
+package service
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/LashkaPashka/TaskDownloader/internal/config"
+)
+
+var fastRetry = config.Retry{MaxAttempts: 3, BaseBackoff: time.Millisecond, MaxBackoff: 10 * time.Millisecond}
+
+func TestClassify(t *testing.T) {
+	cases := []struct {
+		err       error
+		retryable bool
+	}{
+		{&StatusError{Code: http.StatusServiceUnavailable}, true},
+		{&StatusError{Code: http.StatusTooManyRequests, RetryAfter: time.Second}, true},
+		{&StatusError{Code: http.StatusNotFound}, false},
+		{&StatusError{Code: http.StatusForbidden}, false},
+		{validateURL("ftp://example.com/a.zip"), false},
+		{validateURL("://broken"), false},
+		{errChecksumMismatch, false},
+	}
+
+	for _, c := range cases {
+		if retryable, _ := classify(c.err); retryable != c.retryable {
+			t.Fatalf("Error: %v classified retryable=%v, want %v", c.err, retryable, c.retryable)
+		}
+	}
+
+	if _, after := classify(&StatusError{Code: http.StatusTooManyRequests, RetryAfter: time.Second}); after != time.Second {
+		t.Fatalf("Error: Retry-After is lost, got %v", after)
+	}
+}
+
+func TestRetryTransientErrors(t *testing.T) {
+	content := testContent(8 * 1024)
+
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write(content)
+	}))
+	defer srv.Close()
+
+	g, task := newTestService(t, config.Downloader{Segments: 1, Retry: fastRetry}, srv.URL+"/data.bin")
+	g.scheduleFile(&sync.Mutex{}, task.ID, &task.File[0])
+
+	file := waitFiles(t, g, task.ID, statusDone, statusFailed).File[0]
+	if file.Attempts != 3 || file.Status != statusDone {
+		t.Fatalf("Error: unexpected file %+v", file)
+	}
+}
+
+func TestNoRetryOnPermanentError(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		http.NotFound(w, r)
+	}))
+	defer srv.Close()
+
+	g, task := newTestService(t, config.Downloader{Segments: 1, Retry: fastRetry}, srv.URL+"/data.bin")
+	g.scheduleFile(&sync.Mutex{}, task.ID, &task.File[0])
+
+	file := waitFiles(t, g, task.ID, statusDone, statusFailed).File[0]
+	if calls.Load() != 1 || file.Attempts != 1 || file.FailReason != reasonPermanentError || file.LastError == "" {
+		t.Fatalf("Error: unexpected file %+v after %d calls", file, calls.Load())
+	}
+}
+
+func TestRetriesExhausted(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer srv.Close()
+
+	g, task := newTestService(t, config.Downloader{Segments: 1, Retry: fastRetry}, srv.URL+"/data.bin")
+	g.scheduleFile(&sync.Mutex{}, task.ID, &task.File[0])
+
+	file := waitFiles(t, g, task.ID, statusDone, statusFailed).File[0]
+	if file.Attempts != fastRetry.MaxAttempts || file.FailReason != reasonRetriesExhausted ||
+		!bytes.Contains([]byte(file.LastError), []byte("502")) {
+		t.Fatalf("Error: unexpected file %+v", file)
+	}
+}
+
+func TestRetryDoesNotHoldWorker(t *testing.T) {
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+
+	content := testContent(1024)
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(content)
+	}))
+	defer healthy.Close()
+
+	slowRetry := config.Retry{MaxAttempts: 3, BaseBackoff: time.Minute, MaxBackoff: time.Minute}
+	g, task := newTestService(t, config.Downloader{Workers: 1, Segments: 1, Retry: slowRetry},
+		failing.URL+"/a.bin", healthy.URL+"/b.bin")
+
+	var mux sync.Mutex
+	for i := range task.File {
+		g.scheduleFile(&mux, task.ID, &task.File[i])
+	}
+
+	// the only worker is free while the failed file waits for its backoff
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		stored, err := g.storage.GetFileById(task.ID, task.File[1].Index)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if stored.Status == statusDone {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Error: file behind a retry did not finish: %+v", stored)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// the waiting retry does not keep the cancel waiting for its backoff
+	cancelled := make(chan error, 1)
+	go func() { cancelled <- g.CancelTask(task.ID, false) }()
+
+	select {
+	case err := <-cancelled:
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Error: cancel waited for the backoff")
+	}
+}
+
+func TestRetryAfterIsCapped(t *testing.T) {
+	content := testContent(1024)
+
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.Header().Set("Retry-After", "86400")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write(content)
+	}))
+	defer srv.Close()
+
+	capped := config.Retry{MaxAttempts: 3, BaseBackoff: 10 * time.Millisecond, MaxBackoff: 500 * time.Millisecond}
+	g, task := newTestService(t, config.Downloader{Segments: 1, Retry: capped}, srv.URL+"/data.bin")
+
+	g.scheduleFile(&sync.Mutex{}, task.ID, &task.File[0])
+
+	// the file waits for its retry as queued, no longer than the policy allows
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		waiting, err := g.storage.GetFileById(task.ID, task.File[0].Index)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if waiting.Status == statusQueued && waiting.Attempts == 1 {
+			if wait := time.Until(waiting.NextAttemptAt); wait <= 0 || wait > capped.MaxBackoff {
+				t.Fatalf("Error: retry is parked until %v", waiting.NextAttemptAt)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Error: file did not wait for its retry: %+v", waiting)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	file := waitFiles(t, g, task.ID, statusDone, statusFailed).File[0]
+	if file.Status != statusDone || file.Attempts != 2 || !file.NextAttemptAt.IsZero() {
+		t.Fatalf("Error: unexpected file %+v", file)
+	}
+}
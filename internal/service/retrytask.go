@@ -0,0 +1,110 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"slices"
+	"time"
+
+	eventbus "github.com/LashkaPashka/TaskDownloader/internal/lib/eventBus"
+	"github.com/LashkaPashka/TaskDownloader/internal/models"
+	"github.com/LashkaPashka/TaskDownloader/internal/payload"
+)
+
+var ErrFileNotFailed = errors.New("file is not failed")
+
+// RetryTask queues the failed files of the task again, only those of body.Indexes when it is set.
+// The errors of the files are cleared, their downloaded bytes are kept for resume with body.KeepPartial.
+// It returns the indexes of the queued files.
+func (g *GoFetchService) RetryTask(taskID string, body payload.RetryTaskRequest) ([]int, error) {
+	const op = "TaskDownloader.service.RetryTask"
+
+	// files asked for by index must be failed, a whole task just skips the others
+	explicit := len(body.Indexes) > 0
+
+	task, indexes, err := g.findFiles(taskID, body.Indexes)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []*models.File
+	for i := range task.File {
+		file := &task.File[i]
+		if !slices.Contains(indexes, file.Index) {
+			continue
+		}
+		if file.Status != statusFailed {
+			if explicit {
+				return nil, fmt.Errorf("%w: %s/%d", ErrFileNotFailed, taskID, file.Index)
+			}
+			continue
+		}
+		files = append(files, file)
+	}
+
+	retried := make([]int, 0, len(files))
+	for _, file := range files {
+		// the bytes of a file that failed its checksum are wrong, never resume them
+		if !body.KeepPartial || file.FailReason == reasonChecksumMismatch {
+			tmpPath := filepath.Join(g.localStoragePath, taskID, file.Filename) + ".part"
+			if err := purgePart(file, tmpPath); err != nil {
+				g.logger.Error("Failed to remove part file",
+					slog.String("op", op),
+					slog.String("task_id", taskID),
+					slog.String("file", tmpPath),
+					slog.String("err", err.Error()),
+				)
+				return nil, err
+			}
+		}
+
+		file.Status = statusQueued
+		file.Attempts = 0
+		file.LastError = ""
+		file.FailReason = ""
+		file.Checksum = ""
+		file.NextAttemptAt = time.Time{}
+
+		if _, err := g.storage.SaveFile(taskID, file); err != nil {
+			g.logger.Error("Failed to save file status",
+				slog.String("op", op),
+				slog.String("task_id", taskID),
+				slog.String("err", err.Error()),
+			)
+			return nil, err
+		}
+		retried = append(retried, file.Index)
+	}
+
+	if len(retried) == 0 {
+		return retried, nil
+	}
+
+	err = g.enqueue(eventbus.Event{
+		Type: eventbus.EventRetryTask,
+		Data: models.EventData{
+			ClientID: task.ClientID,
+			TaskID: task.ID,
+			Indexes: retried,
+		},
+	})
+	if err != nil {
+		g.logger.Error("Failed to queue files again",
+			slog.String("op", op),
+			slog.String("task_id", taskID),
+			slog.String("err", err.Error()),
+		)
+		return nil, err
+	}
+
+	g.logger.Info("Files queued again",
+		slog.String("op", op),
+		slog.String("task_id", taskID),
+		slog.Any("files", retried),
+		slog.Bool("keep_partial", body.KeepPartial),
+	)
+
+	return retried, nil
+}
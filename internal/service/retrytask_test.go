@@ -0,0 +1,69 @@
+package service
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/LashkaPashka/TaskDownloader/internal/config"
+	eventbus "github.com/LashkaPashka/TaskDownloader/internal/lib/eventBus"
+	"github.com/LashkaPashka/TaskDownloader/internal/lib/taskstatus"
+	"github.com/LashkaPashka/TaskDownloader/internal/models"
+	"github.com/LashkaPashka/TaskDownloader/internal/payload"
+)
+
+func TestRetryTask(t *testing.T) {
+	content := testContent(1024)
+
+	// the origin is missing the file until it is fixed
+	var fixed atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/b.bin" && !fixed.Load() {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write(content)
+	}))
+	defer srv.Close()
+
+	g, task := newTestService(t, config.Downloader{Workers: 2, MaxFilesPerTask: 2, Segments: 1},
+		srv.URL+"/a.bin", srv.URL+"/b.bin")
+
+	go g.CompleteTask()
+	g.eventBus.Publish(eventbus.Event{
+		Type: eventbus.EventCreateTask,
+		Data: models.EventData{ClientID: task.ClientID, TaskID: task.ID},
+	})
+
+	failed := waitFiles(t, g, task.ID, statusDone, statusFailed)
+	if failed.Status != taskstatus.Failed || failed.File[1].FailReason != reasonPermanentError {
+		t.Fatalf("Error: unexpected task %+v", failed)
+	}
+
+	// a file that is not failed can not be retried
+	if _, err := g.RetryTask(task.ID, payload.RetryTaskRequest{Indexes: []int{1}}); !errors.Is(err, ErrFileNotFailed) {
+		t.Fatalf("Error: got %v, want %v", err, ErrFileNotFailed)
+	}
+
+	fixed.Store(true)
+
+	indexes, err := g.RetryTask(task.ID, payload.RetryTaskRequest{})
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if len(indexes) != 1 || indexes[0] != 2 {
+		t.Fatalf("Error: retried files %v, want [2]", indexes)
+	}
+
+	done := waitFiles(t, g, task.ID, statusDone)
+	if done.Status != taskstatus.Completed {
+		t.Fatalf("Error: task status %s, want %s", done.Status, taskstatus.Completed)
+	}
+
+	file := done.File[1]
+	if file.Attempts != 1 || file.LastError != "" || file.FailReason != "" {
+		t.Fatalf("Error: errors of the file were not reset: %+v", file)
+	}
+}
@@ -0,0 +1,264 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/LashkaPashka/TaskDownloader/internal/lib/hostlimit"
+	"github.com/LashkaPashka/TaskDownloader/internal/lib/speed"
+	"github.com/LashkaPashka/TaskDownloader/internal/models"
+)
+
+// planSegments splits the file into byte ranges when the origin supports range requests
+// and the file is large enough. The file is left untouched otherwise and downloaded as a single stream.
+func (g *GoFetchService) planSegments(ctx context.Context, file *models.File) {
+	const op = "TaskDownloader.service.planSegments"
+
+	if g.downloader.Segments < 2 {
+		return
+	}
+
+	size, header, ok := g.probeRanges(ctx, file.Url)
+	if !ok {
+		return
+	}
+
+	segments := splitSegments(size, g.downloader.Segments, g.downloader.MinSegmentSize)
+	if len(segments) < 2 {
+		return
+	}
+
+	g.logger.Debug("Download file in segments",
+		slog.String("op", op),
+		slog.String("url", file.Url),
+		slog.Int64("size", size),
+		slog.Int("segments", len(segments)),
+	)
+
+	file.Size = size
+	file.Segments = segments
+	recordValidators(file, header)
+}
+
+// probeRanges asks the origin for the size of the file and whether it accepts byte ranges.
+func (g *GoFetchService) probeRanges(ctx context.Context, url string) (size int64, header http.Header, ok bool) {
+	const op = "TaskDownloader.service.probeRanges"
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, url, nil)
+	if err != nil {
+		return 0, nil, false
+	}
+
+	release, err := g.hosts.Acquire(ctx, hostlimit.Host(url))
+	if err != nil {
+		return 0, nil, false
+	}
+	defer release()
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		g.logger.Debug("Failed to probe ranges, fall back to a single stream",
+			slog.String("op", op),
+			slog.String("url", url),
+			slog.String("err", err.Error()),
+		)
+		return 0, nil, false
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK || resp.ContentLength <= 0 {
+		return 0, nil, false
+	}
+
+	if !strings.EqualFold(resp.Header.Get("Accept-Ranges"), "bytes") {
+		return 0, nil, false
+	}
+
+	return resp.ContentLength, resp.Header, true
+}
+
+func splitSegments(size int64, count int, minSize int64) []models.Segment {
+	if minSize > 0 && size/minSize < int64(count) {
+		count = int(size / minSize)
+	}
+	if count < 1 {
+		count = 1
+	}
+
+	chunk := size / int64(count)
+	segments := make([]models.Segment, 0, count)
+
+	for i := 0; i < count; i++ {
+		start := int64(i) * chunk
+		end := start + chunk - 1
+		if i == count-1 {
+			end = size - 1
+		}
+
+		segments = append(segments, models.Segment{
+			Index: i + 1,
+			Start: start,
+			End:   end,
+		})
+	}
+
+	return segments
+}
+
+// downloadSegments downloads the missing part of every segment concurrently into the same .part file.
+func (g *GoFetchService) downloadSegments(ctx context.Context, taskID string, file *models.File, tmpPath string) error {
+	const op = "TaskDownloader.service.downloadSegments"
+
+	out, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		g.logger.Error("Error open file",
+			slog.String("op", op),
+			slog.String("err", err.Error()),
+		)
+		return err
+	}
+	defer out.Close()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// mux guards the segments and the progress of the file, they are saved as a whole
+	var (
+		mux      sync.Mutex
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+
+	file.Status = statusInProgress
+
+	for i := range file.Segments {
+		if file.Segments[i].Start+file.Segments[i].DownloadedBytes > file.Segments[i].End {
+			continue
+		}
+
+		wg.Add(1)
+		go func(segment *models.Segment) {
+			defer wg.Done()
+
+			if err := g.downloadSegment(ctx, &mux, taskID, file, segment, out); err != nil {
+				errOnce.Do(func() {
+					firstErr = err
+					cancel()
+				})
+			}
+		}(&file.Segments[i])
+	}
+
+	wg.Wait()
+
+	if firstErr != nil {
+		g.logger.Error("Failed to download segments",
+			slog.String("op", op),
+			slog.String("task_id", taskID),
+			slog.String("url", file.Url),
+			slog.String("err", firstErr.Error()),
+		)
+		return firstErr
+	}
+
+	return nil
+}
+
+func (g *GoFetchService) downloadSegment(
+	ctx context.Context,
+	mux *sync.Mutex,
+	taskID string,
+	file *models.File,
+	segment *models.Segment,
+	out *os.File,
+) error {
+	mux.Lock()
+	offset := segment.Start + segment.DownloadedBytes
+	mux.Unlock()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, file.Url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, segment.End))
+	if validator := ifRangeValidator(file); validator != "" {
+		req.Header.Set("If-Range", validator)
+	}
+
+	release, err := g.hosts.Acquire(ctx, hostlimit.Host(file.Url))
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		if start, ok := contentRangeStart(resp.Header); !ok || start != offset {
+			return errRemoteChanged
+		}
+	case http.StatusOK, http.StatusRequestedRangeNotSatisfiable:
+		// the validator no longer matches or the file became shorter
+		return errRemoteChanged
+	default:
+		return fmt.Errorf("segment %d: %w", segment.Index, newStatusError(resp))
+	}
+
+	body := g.bandwidth.Reader(ctx, taskID, resp.Body)
+
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := body.Read(buf)
+		if n > 0 {
+			// never write past the segment even if the origin sends more than asked
+			if remaining := segment.End + 1 - offset; int64(n) > remaining {
+				n = int(remaining)
+			}
+
+			if _, err := out.WriteAt(buf[:n], offset); err != nil {
+				return err
+			}
+			offset += int64(n)
+			g.speed.Add(speed.Key{TaskID: taskID, Index: file.Index}, int64(n))
+
+			mux.Lock()
+			segment.DownloadedBytes += int64(n)
+			file.DownloadedBytes += int64(n)
+			if _, err := g.storage.SaveFile(taskID, file); err != nil {
+				g.logger.Error("Failed to save file status",
+					slog.String("err", err.Error()),
+					slog.String("task_id", taskID),
+				)
+			}
+			mux.Unlock()
+
+			if offset > segment.End {
+				break
+			}
+		}
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return err
+		}
+	}
+
+	if offset <= segment.End {
+		return fmt.Errorf("segment %d: %w", segment.Index, io.ErrUnexpectedEOF)
+	}
+
+	return nil
+}
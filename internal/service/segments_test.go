@@ -0,0 +1,184 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/LashkaPashka/TaskDownloader/internal/config"
+	converttotask "github.com/LashkaPashka/TaskDownloader/internal/lib/convertToTask"
+	eventbus "github.com/LashkaPashka/TaskDownloader/internal/lib/eventBus"
+	"github.com/LashkaPashka/TaskDownloader/internal/models"
+	"github.com/LashkaPashka/TaskDownloader/internal/payload"
+	storage "github.com/LashkaPashka/TaskDownloader/internal/storage/json"
+)
+
+// newTestService creates a service over a fresh JSON storage holding one task with the given urls.
+func newTestService(t *testing.T, downloader config.Downloader, urls ...string) (*GoFetchService, models.Task) {
+	dir := t.TempDir()
+
+	storagePath := filepath.Join(dir, "tasks.json")
+	if err := os.WriteFile(storagePath, []byte("[]"), 0644); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	logger := setupLogger("local")
+
+	st, err := storage.New(storagePath, logger)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	body := payload.SaveTaskRequest{ClientID: "client"}
+	for _, url := range urls {
+		body.Urls = append(body.Urls, payload.FileRequest{Url: url})
+	}
+
+	task := converttotask.Convert(&body)
+	if _, err := st.SaveTask(task); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	g, err := New(st, filepath.Join(dir, "files"), downloader, eventbus.NewEventBus(), nil, nil, nil, logger)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	return g, task
+}
+
+func testContent(size int) []byte {
+	content := make([]byte, size)
+	for i := range content {
+		content[i] = byte(i % 251)
+	}
+
+	return content
+}
+
+func TestSplitSegments(t *testing.T) {
+	segments := splitSegments(10, 3, 0)
+	if len(segments) != 3 || segments[0].Start != 0 || segments[2].End != 9 {
+		t.Fatalf("Error: unexpected segments %+v", segments)
+	}
+
+	for i := 1; i < len(segments); i++ {
+		if segments[i].Start != segments[i-1].End+1 {
+			t.Fatalf("Error: segments are not contiguous %+v", segments)
+		}
+	}
+
+	if segments := splitSegments(10, 4, 8); len(segments) != 1 {
+		t.Fatalf("Error: min segment size not respected %+v", segments)
+	}
+}
+
+func TestDownloadInSegments(t *testing.T) {
+	content := testContent(100 * 1024)
+
+	var ranged atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Range") != "" {
+			ranged.Add(1)
+		}
+		http.ServeContent(w, r, "data.bin", time.Time{}, bytes.NewReader(content))
+	}))
+	defer srv.Close()
+
+	g, task := newTestService(t, config.Downloader{Segments: 4, MinSegmentSize: 1024}, srv.URL+"/data.bin")
+	file := task.File[0]
+
+	if err := g.DownloadWithResume(context.Background(), &sync.Mutex{}, task.ID, &file); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	if ranged.Load() != 4 {
+		t.Fatalf("Error: got %d range requests, want 4", ranged.Load())
+	}
+
+	got, err := os.ReadFile(filepath.Join(g.localStoragePath, task.ID, file.Filename))
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	if !bytes.Equal(got, content) {
+		t.Fatalf("Error: downloaded content differs")
+	}
+
+	stored, _ := g.storage.GetFileById(task.ID, file.Index)
+	if stored.Status != statusDone || len(stored.Segments) != 4 || stored.DownloadedBytes != int64(len(content)) {
+		t.Fatalf("Error: unexpected stored file %+v", stored)
+	}
+}
+
+func TestResumeSegments(t *testing.T) {
+	content := testContent(64 * 1024)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "data.bin", time.Time{}, bytes.NewReader(content))
+	}))
+	defer srv.Close()
+
+	g, task := newTestService(t, config.Downloader{Segments: 2, MinSegmentSize: 1024}, srv.URL+"/data.bin")
+	file := task.File[0]
+
+	// the first half of every segment was downloaded before a restart
+	file.Size = int64(len(content))
+	file.Segments = splitSegments(file.Size, 2, 1024)
+
+	dir := filepath.Join(g.localStoragePath, task.ID)
+	os.MkdirAll(dir, os.ModePerm)
+
+	part := make([]byte, len(content))
+	for i := range file.Segments {
+		segment := &file.Segments[i]
+		half := (segment.End - segment.Start + 1) / 2
+		copy(part[segment.Start:segment.Start+half], content[segment.Start:segment.Start+half])
+		segment.DownloadedBytes = half
+		file.DownloadedBytes += half
+	}
+	if err := os.WriteFile(filepath.Join(dir, file.Filename+".part"), part, 0644); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	if err := g.DownloadWithResume(context.Background(), &sync.Mutex{}, task.ID, &file); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	got, _ := os.ReadFile(filepath.Join(dir, file.Filename))
+	if !bytes.Equal(got, content) {
+		t.Fatalf("Error: resumed content differs")
+	}
+}
+
+func TestDownloadWithoutRangeSupport(t *testing.T) {
+	content := testContent(16 * 1024)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(content)
+	}))
+	defer srv.Close()
+
+	g, task := newTestService(t, config.Downloader{Segments: 4, MinSegmentSize: 1024}, srv.URL+"/data.bin")
+	file := task.File[0]
+
+	if err := g.DownloadWithResume(context.Background(), &sync.Mutex{}, task.ID, &file); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	if len(file.Segments) != 0 {
+		t.Fatalf("Error: expected a single stream, got segments %+v", file.Segments)
+	}
+
+	got, _ := os.ReadFile(filepath.Join(g.localStoragePath, task.ID, file.Filename))
+	if !bytes.Equal(got, content) {
+		t.Fatalf("Error: downloaded content differs")
+	}
+}
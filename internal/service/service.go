@@ -1,25 +1,50 @@
 package service
 
 import (
+	"context"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
-	"log"
 	"log/slog"
 	"net/http"
 	"os"
 	"path/filepath"
+	"slices"
 	"sync"
+	"time"
 
+	"github.com/LashkaPashka/TaskDownloader/internal/config"
+	"github.com/LashkaPashka/TaskDownloader/internal/lib/bandwidth"
 	converttotask "github.com/LashkaPashka/TaskDownloader/internal/lib/convertToTask"
+	"github.com/LashkaPashka/TaskDownloader/internal/lib/deadletter"
 	eventbus "github.com/LashkaPashka/TaskDownloader/internal/lib/eventBus"
+	"github.com/LashkaPashka/TaskDownloader/internal/lib/eventlog"
+	"github.com/LashkaPashka/TaskDownloader/internal/lib/hostlimit"
+	"github.com/LashkaPashka/TaskDownloader/internal/lib/hub"
+	"github.com/LashkaPashka/TaskDownloader/internal/lib/scheduler"
+	"github.com/LashkaPashka/TaskDownloader/internal/lib/speed"
+	"github.com/LashkaPashka/TaskDownloader/internal/lib/webhook"
 	"github.com/LashkaPashka/TaskDownloader/internal/models"
 	"github.com/LashkaPashka/TaskDownloader/internal/payload"
 )
 
+// downloaderGroup is the subscription of the downloader, the downloaders of all processes share its events.
+// It also acknowledges the events of the outbox
+const downloaderGroup = "downloader"
+
+// ErrEventNotSent is returned when the change is saved and its event is lost,
+// the downloader then finds the queued files only on its next start.
+var ErrEventNotSent = errors.New("event not sent to the downloader")
+
 const (
 	statusDone = "done"
 	statusFailed = "failed"
 	statusInProgress = "in_progress"
+	statusCompleted = "completed"
+	statusCancelled = "cancelled"
+	statusPaused = "paused"
+	statusQueued = "queued"
 )
 
 type Storage interface {
@@ -28,145 +53,446 @@ type Storage interface {
 	SaveFile(taskID string, file *models.File) (success bool, err error)
 	GetFileById(taskID string, fileID int) (models.File, error)
 	ResetToQueued() (fileMp map[string][]models.File, err error)
+	AppendFiles(taskID string, files []models.File) ([]models.File, error)
+	ListTasks(filter models.TaskFilter) (models.TaskPage, error)
 }
 
 type GoFetchService struct {
 	logger *slog.Logger
-	eventBus *eventbus.EventBus
+	eventBus eventbus.EventBus
+	// jobs are the events of the downloader, it subscribes in New so that no event published before CompleteTask is lost
+	jobs *eventbus.Subscription
+	// outbox keeps the events of the downloader until it has handled them, nil keeps them in memory only
+	outbox *eventlog.Log
+	// deadLetters keeps the events the downloader failed to handle
+	deadLetters *deadletter.Queue
 	localStoragePath string
+	downloader config.Downloader
+	scheduler *scheduler.Scheduler
+	hosts *hostlimit.Limiter
+	bandwidth *bandwidth.Manager
+	speed *speed.Meter
+	events *hub.Hub
+	webhooks *webhook.Dispatcher
+	runsMu sync.Mutex
+	runs map[string]*taskRun
+	appendMu sync.Mutex
 	storage Storage
 }
 
 func New(
 	storage Storage,
 	localStoragePath string,
-	eventBus *eventbus.EventBus, 
+	downloader config.Downloader,
+	eventBus eventbus.EventBus, 
+	outbox *eventlog.Log,
+	deadLetters *deadletter.Queue,
+	webhooks *webhook.Dispatcher,
 	logger *slog.Logger,
 ) (*GoFetchService, error) {
-	return &GoFetchService{
+	overrides := make(map[string]hostlimit.Limit, len(downloader.Hosts.Overrides))
+	for host, limit := range downloader.Hosts.Overrides {
+		overrides[host] = hostlimit.Limit{MaxConnections: limit.MaxConnections, MinDelay: limit.MinDelay}
+	}
+
+	hosts := hostlimit.New(
+		hostlimit.Limit{MaxConnections: downloader.Hosts.MaxConnections, MinDelay: downloader.Hosts.MinDelay},
+		overrides,
+	)
+
+	// a file takes at least one connection, do not give workers to more files of a host than it accepts
+	perHost := func(host string) int {
+		return hosts.Limit(host).MaxConnections
+	}
+
+	g := &GoFetchService{
 		logger: logger,
 		eventBus: eventBus,
+		outbox: outbox,
+		deadLetters: deadLetters,
 		localStoragePath: localStoragePath,
-		storage: storage,
-	}, nil
+		downloader: downloader,
+		scheduler: scheduler.New(downloader.Workers, downloader.MaxFilesPerTask, perHost),
+		hosts: hosts,
+		bandwidth: bandwidth.New(downloader.Bandwidth.GlobalBytesPerSec, downloader.Bandwidth.Clients),
+		speed: speed.New(speedWindow),
+		events: hub.New(eventHistory, eventBuffer),
+		webhooks: webhooks,
+		runs: make(map[string]*taskRun),
+	}
+	g.storage = newEventStorage(storage, g)
+
+	if downloader.Disabled {
+		return g, nil
+	}
+
+	// a dropped event would leave its files queued until the next restart
+	jobs, err := eventBus.SubscribeWith(
+		eventbus.Options{Overflow: eventbus.OverflowBlock, Group: downloaderGroup, ManualAck: true},
+		eventbus.EventCreateTask, eventbus.EventRetryTask, eventbus.EventAppendFiles, eventbus.EventResumeFiles,
+		eventbus.EventPauseFiles, eventbus.EventCancelTask, eventbus.EventUnfinishedTask,
+	)
+	if err != nil {
+		return nil, err
+	}
+	g.jobs = jobs
+
+	return g, nil
 }
 
 func (g *GoFetchService) SaveTask(body payload.SaveTaskRequest) (success bool, err error) {
 	const op = "TaskDownloader.service.goFetch.SaveTask"
 
+	if body.CallbackURL != "" && !g.webhooks.HasSecret(body.ClientID) {
+		return false, fmt.Errorf("%w: %s", ErrNoWebhookSecret, body.ClientID)
+	}
+
 	// TODO: convert to modelTask
 	task := converttotask.Convert(&body)
 
+	// the event is written before the task, a crash in between leaves an event of a missing task and not a task nobody downloads
+	event, err := g.record(eventbus.Event{
+		Type: eventbus.EventCreateTask,
+		Data: models.EventData{
+			ClientID: task.ClientID,
+			TaskID: task.ID,
+		},
+	})
+	if err != nil {
+		return false, err
+	}
+
 	// TODO: call method saveTask in file json
 	if success, err := g.storage.SaveTask(task); err != nil {
 		g.logger.Error("Invalid method of storage SaveTask", 
 			slog.String("op", op),
 			slog.String("err", err.Error()),
 		)
+		// the downloader acknowledges the event of the missing task
+		g.dispatch(event)
 		return success, err
 	}
 
 	// TODO: create event in queue
-	go g.eventBus.Publish(eventbus.Event{
-		Type: eventbus.EventCreateTask,
-		Data: models.EventData{
-			ClientID: task.ClientID,
-			TaskID: task.ID,
-		},
-	})
+	if err := g.dispatch(event); err != nil && event.Offset == 0 {
+		return false, fmt.Errorf("%w: %v", ErrEventNotSent, err)
+	}
 
 	return true, nil
 }
 
 func (g *GoFetchService) CompleteTask() {
-	const op = "TaskDownloader.service.goFetch.CompleteTask"
+	for msg := range g.jobs.C {
+		if err := g.handleJob(msg); err != nil {
+			g.deadLetter(msg.Type, payloadOf(msg.Data), err)
+		}
+
+		g.ack(msg)
+	}
+}
+
+// handleJob schedules the files of the event. An event it fails to handle is returned as an error,
+// a panic included, the next events are handled anyway.
+func (g *GoFetchService) handleJob(msg eventbus.Event) (err error) {
+	const op = "TaskDownloader.service.goFetch.handleJob"
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+
+	if msg.Type == eventbus.EventCreateTask || msg.Type == eventbus.EventRetryTask ||
+		msg.Type == eventbus.EventAppendFiles || msg.Type == eventbus.EventResumeFiles {
+		eventData, ok := msg.Data.(models.EventData)
+		if !ok {
+			return fmt.Errorf("%w: %s has data of type %T", ErrMalformedEvent, msg.Type, msg.Data)
+		}
+		
+		task, err := g.storage.GetTask(eventData.TaskID)
+		if err != nil {
+			return fmt.Errorf("get task %s: %w", eventData.TaskID, err)
+		}
+		if task.ID == "" {
+			// the event was recorded, the task was not saved
+			g.logger.Info("Event of a missing task skipped",
+				slog.String("op", op),
+				slog.String("type", string(msg.Type)),
+				slog.String("task_id", eventData.TaskID),
+			)
+			return nil
+		}
+
+		g.bandwidth.AddTask(task.ID, task.ClientID, task.MaxBytesPerSec)
 
-	for msg := range g.eventBus.Subscribe() {
-		if msg.Type == eventbus.EventCreateTask {
-			eventData, ok := msg.Data.(models.EventData)
-			if !ok {
-				log.Fatalln("Wrong data")
+		var mux sync.Mutex
+
+		for i := range task.File {
+			if len(eventData.Indexes) > 0 && !slices.Contains(eventData.Indexes, task.File[i].Index) {
 				continue
 			}
-			
-			task, err := g.storage.GetTask(eventData.TaskID)
-			if err != nil {
-				g.logger.Error("Error get task", slog.String("op", op))
-				return
+			if msg.Type == eventbus.EventResumeFiles {
+				g.unpause(eventData.TaskID, task.File[i])
 			}
+			g.scheduleFile(&mux, eventData.TaskID, &task.File[i])
+		}
+
+	} else if msg.Type == eventbus.EventPauseFiles || msg.Type == eventbus.EventCancelTask {
+		eventData, ok := msg.Data.(models.EventData)
+		if !ok {
+			return fmt.Errorf("%w: %s has data of type %T", ErrMalformedEvent, msg.Type, msg.Data)
+		}
+
+		if msg.Type == eventbus.EventPauseFiles {
+			err = g.pause(eventData.TaskID, eventData.Indexes...)
+		} else {
+			err = g.CancelTask(eventData.TaskID, eventData.Purge)
+		}
+
+		// the task has changed since the request was accepted, there is nothing left to stop
+		if errors.Is(err, ErrTaskNotFound) || errors.Is(err, ErrFileNotFound) ||
+			errors.Is(err, ErrFileFinished) || errors.Is(err, ErrTaskFinished) {
+			g.logger.Info("Event of a finished task skipped",
+				slog.String("op", op),
+				slog.String("type", string(msg.Type)),
+				slog.String("task_id", eventData.TaskID),
+				slog.String("reason", err.Error()),
+			)
+			return nil
+		}
+
+		return err
+	} else if msg.Type == eventbus.EventUnfinishedTask {
+		data, ok := msg.Data.(map[string][]models.File)
+		if !ok {
+			return fmt.Errorf("%w: %s has data of type %T", ErrMalformedEvent, msg.Type, msg.Data)
+		}
+
+		for taskID, fileList := range data {
+			g.trackBandwidth(taskID)
 
-			var wg sync.WaitGroup
 			var mux sync.Mutex
 
-			wg.Add(len(task.File))
-			for i := range task.File {
-				file := &task.File[i]
-
-				go func (taskID string, file *models.File) {
-					defer wg.Done()
-
-					if err := g.DownloadWithResume(&mux, taskID, file); err != nil {
-						g.logger.Error("Ivalid download file", 
-							slog.String("err", err.Error()), 
-							slog.String("op", op),
-						)
-
-						file.Status = statusFailed
-
-						if _, err := g.storage.SaveFile(taskID, file); err != nil {
-								g.logger.Error("Failed to save file status",
-									slog.String("err", err.Error()),
-									slog.String("op", op),
-									slog.String("task_id", taskID),
-								)
-						}
-					}
-				}(eventData.TaskID, file)
+			for i := range fileList {
+				g.scheduleFile(&mux, taskID, &fileList[i])
 			}
-			
-			wg.Wait()
+		}
+	} else {
+		return fmt.Errorf("%w: unexpected type %s", ErrMalformedEvent, msg.Type)
+	}
 
-		} else if msg.Type == eventbus.EventUnfinishedTask {
-			data, ok := msg.Data.(map[string][]models.File)
-			if !ok {
-				log.Fatalln("Wrong data")
-				continue
+	return nil
+}
+
+// enqueue records the event of a change already saved in the storage and hands it to the downloader.
+// The event is dispatched even when the outbox fails, the queued files are also found by the scan on the next start.
+// It fails when the event is lost: the outbox has not recorded it and the bus has not taken it.
+func (g *GoFetchService) enqueue(event eventbus.Event) error {
+	event, _ = g.record(event)
+	if err := g.dispatch(event); err != nil && event.Offset == 0 {
+		return fmt.Errorf("%w: %v", ErrEventNotSent, err)
+	}
+
+	return nil
+}
+
+// record appends the event to the outbox, from there it is delivered again after a restart until the downloader acknowledges it.
+func (g *GoFetchService) record(event eventbus.Event) (eventbus.Event, error) {
+	const op = "TaskDownloader.service.goFetch.record"
+
+	if g.outbox == nil {
+		return event, nil
+	}
+
+	record, err := g.outbox.Append(string(event.Type), event.Data)
+	if err != nil {
+		g.logger.Error("Failed to append event to outbox",
+			slog.String("op", op),
+			slog.String("type", string(event.Type)),
+			slog.String("err", err.Error()),
+		)
+		return event, err
+	}
+	event.Offset = record.Offset
+
+	return event, nil
+}
+
+// dispatch hands the event to the downloader. The local bus fails only once it is closed on shutdown,
+// a recorded event is then delivered after the restart. NATS has no outbox, an event it fails to take is lost.
+func (g *GoFetchService) dispatch(event eventbus.Event) error {
+	const op = "TaskDownloader.service.goFetch.dispatch"
+
+	if err := g.eventBus.Publish(event); err != nil {
+		g.logger.Error("Failed to publish event",
+			slog.String("op", op),
+			slog.String("type", string(event.Type)),
+			slog.String("err", err.Error()),
+		)
+		return err
+	}
+
+	return nil
+}
+
+// ack tells the transport and the outbox the downloader has handled the event.
+func (g *GoFetchService) ack(event eventbus.Event) {
+	const op = "TaskDownloader.service.goFetch.ack"
+
+	event.Ack()
+
+	if g.outbox == nil || event.Offset == 0 {
+		return
+	}
+
+	if err := g.outbox.Ack(downloaderGroup, event.Offset); err != nil {
+		g.logger.Error("Failed to acknowledge event",
+			slog.String("op", op),
+			slog.Uint64("offset", event.Offset),
+			slog.String("err", err.Error()),
+		)
+	}
+}
+
+// redeliver publishes the events of the outbox the downloader has not acknowledged before the restart.
+func (g *GoFetchService) redeliver() {
+	const op = "TaskDownloader.service.goFetch.redeliver"
+
+	if g.outbox == nil {
+		return
+	}
+
+	for _, record := range g.outbox.Pending(downloaderGroup) {
+		event, err := eventbus.Decode(eventbus.Topic(record.Topic), record.Data)
+		if err != nil {
+			g.logger.Error("Failed to decode event from outbox",
+				slog.String("op", op),
+				slog.Uint64("offset", record.Offset),
+				slog.String("err", err.Error()),
+			)
+			// it would fail again after every restart
+			g.deadLetter(eventbus.Topic(record.Topic), record.Data, fmt.Errorf("%w: %v", ErrMalformedEvent, err))
+			g.ack(eventbus.Event{Offset: record.Offset})
+			continue
+		}
+		event.Offset = record.Offset
+
+		g.dispatch(event)
+	}
+}
+
+// scheduleFile queues the download of the file, it is started once the scheduler has a free worker.
+func (g *GoFetchService) scheduleFile(mux *sync.Mutex, taskID string, file *models.File) {
+	if file.Status == statusDone || file.Status == statusCancelled || file.Status == statusPaused {
+		return
+	}
+
+	run := g.startJob(taskID, file.Index)
+	if run == nil {
+		return
+	}
+
+	// a file that was waiting for its retry before the restart keeps waiting
+	if wait := time.Until(file.NextAttemptAt); wait > 0 {
+		go g.retryLater(run, mux, taskID, file, wait)
+		return
+	}
+
+	g.submitFile(run, mux, taskID, file)
+}
+
+// submitFile hands the file to the scheduler. A failed attempt worth retrying does not wait in the worker,
+// the file stays queued and is submitted again once its backoff is over.
+func (g *GoFetchService) submitFile(run *taskRun, mux *sync.Mutex, taskID string, file *models.File) {
+	g.scheduler.Submit(scheduler.Job{
+		TaskID: taskID,
+		Host: hostlimit.Host(file.Url),
+		Run: func() {
+			ctx, stop := g.startFile(run, file.Index)
+			if ctx == nil {
+				g.finishJobs(taskID, run, 1)
+				return
 			}
 
-			var wg sync.WaitGroup
-			var mux sync.Mutex
+			wait, retry := g.runFile(ctx, mux, taskID, file)
+			if retry {
+				// marked before the worker lets the file go, so it is never scheduled twice
+				g.runsMu.Lock()
+				run.queued[file.Index] = true
+				g.runsMu.Unlock()
+			}
 
-			for taskID, fileList := range data {
-				for i := range fileList {
-					wg.Add(1)
-					file := &fileList[i]
-					go func (taskID string, file *models.File) {
-						defer wg.Done()
-
-						if err := g.DownloadWithResume(&mux, taskID, file); err != nil {
-							g.logger.Error("Invalid download file",
-								slog.String("err", err.Error()),
-								slog.String("op", op),
-							)
-	
-							file.Status = statusFailed
-
-							if _, err := g.storage.SaveFile(taskID, file); err != nil {
-								g.logger.Error("Failed to save file status",
-									slog.String("err", err.Error()),
-									slog.String("op", op),
-									slog.String("task_id", taskID),
-								)
-							}
-						}
-					}(taskID, file)
-				}
-				wg.Wait()
+			g.speed.Remove(speed.Key{TaskID: taskID, Index: file.Index})
+			stop()
+
+			if !retry {
+				g.finishJobs(taskID, run, 1)
+				return
 			}
-		}
+
+			go g.retryLater(run, mux, taskID, file, wait)
+		},
+	})
+}
+
+// retryLater submits the file again after wait, a cancelled task releases it at once.
+// A file paused meanwhile is dropped by startFile when its job comes up.
+func (g *GoFetchService) retryLater(run *taskRun, mux *sync.Mutex, taskID string, file *models.File, wait time.Duration) {
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		g.submitFile(run, mux, taskID, file)
+	case <-run.ctx.Done():
+		g.runsMu.Lock()
+		delete(run.queued, file.Index)
+		g.runsMu.Unlock()
+
+		g.finishJobs(taskID, run, 1)
 	}
 }
 
+// runFile makes one attempt of the download, it reports the delay when the file should be tried again.
+func (g *GoFetchService) runFile(ctx context.Context, mux *sync.Mutex, taskID string, file *models.File) (time.Duration, bool) {
+	const op = "TaskDownloader.service.goFetch.runFile"
+
+	wait, err := g.attemptDownload(ctx, mux, taskID, file)
+	if err == nil {
+		return 0, false
+	}
+
+	if ctx.Err() != nil {
+		g.logger.Info("Download stopped",
+			slog.String("op", op),
+			slog.String("task_id", taskID),
+			slog.String("url", file.Url),
+		)
+		return 0, false
+	}
+
+	if wait > 0 {
+		return wait, true
+	}
+
+	g.logger.Error("Invalid download file",
+		slog.String("err", err.Error()),
+		slog.String("op", op),
+	)
+
+	file.Status = statusFailed
+
+	if _, err := g.storage.SaveFile(taskID, file); err != nil {
+		g.logger.Error("Failed to save file status",
+			slog.String("err", err.Error()),
+			slog.String("op", op),
+			slog.String("task_id", taskID),
+		)
+	}
+
+	return 0, false
+}
+
 func (g *GoFetchService) SearchQueuedAndComplete() (error) {
 	// TODO: serach task where status = in_progress and set up queued
 	files, err := g.storage.ResetToQueued()
@@ -174,7 +500,10 @@ func (g *GoFetchService) SearchQueuedAndComplete() (error) {
 		return err
 	}
 
-	go g.eventBus.Publish(eventbus.Event{
+	g.redeliver()
+
+	// the files are read from the storage on every start, the event is not recorded
+	g.dispatch(eventbus.Event{
 		Type: eventbus.EventUnfinishedTask,
 		Data: files,
 	})
@@ -182,7 +511,7 @@ func (g *GoFetchService) SearchQueuedAndComplete() (error) {
 	return nil
 }
 
-func (g *GoFetchService) DownloadWithResume(mux *sync.Mutex, taskID string, file *models.File) (error) {
+func (g *GoFetchService) DownloadWithResume(ctx context.Context, mux *sync.Mutex, taskID string, file *models.File) (error) {
 	const op = "TaskDownloader.service.DownloadWithResume"
 	
 	path := filepath.Join(g.localStoragePath, taskID, file.Filename)
@@ -197,6 +526,75 @@ func (g *GoFetchService) DownloadWithResume(mux *sync.Mutex, taskID string, file
 
 	tmpPath := path + ".part"
 
+	err := g.download(ctx, mux, taskID, file, tmpPath)
+	if errors.Is(err, errRemoteChanged) {
+		g.logger.Warn("Remote file changed since the download started, restart from zero",
+			slog.String("op", op),
+			slog.String("task_id", taskID),
+			slog.String("url", file.Url),
+		)
+
+		if err := resetProgress(file, tmpPath); err != nil {
+			return err
+		}
+
+		err = g.download(ctx, mux, taskID, file, tmpPath)
+	}
+	if err != nil {
+		return err
+	}
+
+	if file.ExpectedChecksum != "" && file.Checksum != file.ExpectedChecksum {
+		g.logger.Error("Checksum of downloaded file does not match",
+			slog.String("op", op),
+			slog.String("task_id", taskID),
+			slog.String("url", file.Url),
+			slog.String("algo", file.ChecksumAlgo),
+			slog.String("expected", file.ExpectedChecksum),
+			slog.String("actual", file.Checksum),
+		)
+
+		file.Status = statusFailed
+		file.FailReason = reasonChecksumMismatch
+		if _, err := g.storage.SaveFile(taskID, file); err != nil {
+			g.logger.Error("Failed to save file status",
+				slog.String("err", err.Error()),
+				slog.String("task_id", taskID),
+			)
+		}
+
+		return fmt.Errorf("%w: %s expected %s, got %s", errChecksumMismatch, file.ChecksumAlgo, file.ExpectedChecksum, file.Checksum)
+	}
+
+	return g.finishFile(taskID, file, tmpPath, path)
+}
+
+func (g *GoFetchService) download(ctx context.Context, mux *sync.Mutex, taskID string, file *models.File, tmpPath string) error {
+	if len(file.Segments) == 0 && file.DownloadedBytes == 0 {
+		g.planSegments(ctx, file)
+	}
+
+	if len(file.Segments) > 0 {
+		if err := g.downloadSegments(ctx, taskID, file, tmpPath); err != nil {
+			return err
+		}
+
+		// segments are written out of order, hash the assembled file
+		checksum, err := hashFile(file.ChecksumAlgo, tmpPath)
+		if err != nil {
+			return err
+		}
+		file.Checksum = checksum
+
+		return nil
+	}
+
+	return g.downloadStream(ctx, mux, taskID, file, tmpPath)
+}
+
+func (g *GoFetchService) downloadStream(ctx context.Context, mux *sync.Mutex, taskID string, file *models.File, tmpPath string) error {
+	const op = "TaskDownloader.service.downloadStream"
+
 	out, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY, 0644)
 	if err != nil {
 		g.logger.Error("Error open file",
@@ -208,19 +606,44 @@ func (g *GoFetchService) DownloadWithResume(mux *sync.Mutex, taskID string, file
 
 	defer out.Close()
 
-	if _, err := out.Seek(file.DownloadedBytes, io.SeekStart); err != nil {
-		g.logger.Error("Error search file", 
-			slog.String("op", op),
-			slog.String("err", err.Error()),
-		)
+	h, err := newHash(file.ChecksumAlgo)
+	if err != nil {
 		return err
 	}
 
-	req, _ := http.NewRequest("GET", file.Url, nil)
+	// the digest is not persisted, hash the bytes we already have before continuing
+	if file.DownloadedBytes > 0 {
+		if err := hashPart(h, tmpPath, file.DownloadedBytes); err != nil {
+			g.logger.Warn("Part file does not match the saved progress, restart from zero",
+				slog.String("op", op),
+				slog.String("task_id", taskID),
+				slog.String("err", err.Error()),
+			)
+
+			if err := resetProgress(file, tmpPath); err != nil {
+				return err
+			}
+			h.Reset()
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, file.Url, nil)
+	if err != nil {
+		return fmt.Errorf("%w: %s", errInvalidURL, err.Error())
+	}
 	if file.DownloadedBytes > 0 {
 		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", file.DownloadedBytes))
+		if validator := ifRangeValidator(file); validator != "" {
+			req.Header.Set("If-Range", validator)
+		}
 	}
 
+	release, err := g.hosts.Acquire(ctx, hostlimit.Host(file.Url))
+	if err != nil {
+		return err
+	}
+	defer release()
+
 	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 			g.logger.Error("Failed to make HTTP request",
@@ -233,18 +656,63 @@ func (g *GoFetchService) DownloadWithResume(mux *sync.Mutex, taskID string, file
 	}
 	defer resp.Body.Close()
 
+	switch {
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable:
+		// nothing is left to download when we already have the whole file
+		if file.Size > 0 && file.DownloadedBytes >= file.Size {
+			file.Checksum = hex.EncodeToString(h.Sum(nil))
+			return nil
+		}
+		return errRemoteChanged
+	case resp.StatusCode == http.StatusPartialContent:
+		if start, ok := contentRangeStart(resp.Header); !ok || start != file.DownloadedBytes {
+			return errRemoteChanged
+		}
+	case resp.StatusCode == http.StatusOK:
+		// the validator did not match or the origin ignored the range, the body is the whole file
+		if file.DownloadedBytes > 0 {
+			g.logger.Warn("Origin sent the whole file instead of the rest, restart from zero",
+				slog.String("op", op),
+				slog.String("task_id", taskID),
+				slog.String("url", file.Url),
+			)
+
+			if err := out.Truncate(0); err != nil {
+				return err
+			}
+			file.DownloadedBytes = 0
+			file.Size = 0
+			h.Reset()
+		}
+		recordValidators(file, resp.Header)
+	default:
+		return newStatusError(resp)
+	}
+
+	if _, err := out.Seek(file.DownloadedBytes, io.SeekStart); err != nil {
+		g.logger.Error("Error search file", 
+			slog.String("op", op),
+			slog.String("err", err.Error()),
+		)
+		return err
+	}
+
 	if file.Size == 0 && resp.ContentLength > 0 {
 		file.Size = file.DownloadedBytes + resp.ContentLength
 	}
 
+	body := g.bandwidth.Reader(ctx, taskID, resp.Body)
+
 	buf := make([]byte, 32*1024)
 	file.Status = statusInProgress
 	for {
-		n, err := resp.Body.Read(buf)
+		n, err := body.Read(buf)
 		if n > 0 {
 			if _, err := out.Write(buf[:n]); err != nil {
 				return err
 			}
+			h.Write(buf[:n])
+			g.speed.Add(speed.Key{TaskID: taskID, Index: file.Index}, int64(n))
 
 			file.DownloadedBytes += int64(n)
 			mux.Lock()
@@ -269,6 +737,17 @@ func (g *GoFetchService) DownloadWithResume(mux *sync.Mutex, taskID string, file
 		}
 	}
 
+	file.Checksum = hex.EncodeToString(h.Sum(nil))
+
+	return nil
+}
+
+// finishFile moves the file in place before it is marked done, so a done file can always be served.
+func (g *GoFetchService) finishFile(taskID string, file *models.File, tmpPath, path string) error {
+	if err := os.Rename(tmpPath, path); err != nil {
+		return err
+	}
+
 	file.Status = statusDone
 	if _, err := g.storage.SaveFile(taskID, file); err != nil {
 		g.logger.Error("Failed to save file status",
@@ -277,7 +756,7 @@ func (g *GoFetchService) DownloadWithResume(mux *sync.Mutex, taskID string, file
 		)
 	}
 
-	return os.Rename(tmpPath, path)
+	return nil
 }
 
 
@@ -294,6 +773,18 @@ func (g *GoFetchService) GetTaskByID(taskID string) (models.Task, error) {
 }
 
 
+func (g *GoFetchService) ListTasks(filter models.TaskFilter) (models.TaskPage, error) {
+	const op = "TaskDownloader.service.goFetch.ListTasks"
+
+	page, err := g.storage.ListTasks(filter)
+	if err != nil {
+		g.logger.Error("Invalid list tasks", slog.String("err", err.Error()), slog.String("op", op))
+		return models.TaskPage{}, err
+	}
+
+	return page, nil
+}
+
 func (g *GoFetchService) GetFileById(taskID string, fileID int) (models.File, error) {
 	const op = "TaskDownloader.service.goFetch.GetFileById"
 	
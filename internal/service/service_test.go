@@ -1,6 +1,7 @@
 package service
 
 import (
+	"context"
 	"log/slog"
 	"os"
 	"path/filepath"
@@ -11,9 +12,9 @@ import (
 	storage "github.com/LashkaPashka/TaskDownloader/internal/storage/json"
 )
 var body = payload.SaveTaskRequest{
-		Urls: []string{
-			"https://getsamplefiles.com/download/zip/sample-1.zip",
-			"https://getsamplefiles.com/download/zip/sample-4.zip",
+		Urls: []payload.FileRequest{
+			{Url: "https://getsamplefiles.com/download/zip/sample-1.zip"},
+			{Url: "https://getsamplefiles.com/download/zip/sample-4.zip"},
 		},
 		ClientID: "3f3f32f2",
 }
@@ -49,7 +50,7 @@ func TestDownloadWithResume(t *testing.T) {
 	}
 	file := tasks.File[0]
 
-	if err := ft.DownloadWithResume(nil, taskID, &file); err != nil {
+	if err := ft.DownloadWithResume(context.Background(), nil, taskID, &file); err != nil {
 		t.Fatalf("Error: %v", err)
 	}
 
@@ -68,7 +69,7 @@ func TestGourotine(t *testing.T) {
 	})
 
 
-	for msg := range ft.eventBus.Subscribe() {
+	for msg := range ft.eventBus.Subscribe().C {
 		if msg.Type == eventbus.EventCreateTask {
 			t.Log(msg.Data)
 		}
@@ -0,0 +1,65 @@
+package service
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/LashkaPashka/TaskDownloader/internal/models"
+)
+
+// errRemoteChanged means the bytes we already have do not belong to the current remote file.
+var errRemoteChanged = errors.New("remote file changed")
+
+// recordValidators remembers ETag and Last-Modified of the response the download started with.
+func recordValidators(file *models.File, header http.Header) {
+	file.ETag = header.Get("ETag")
+	file.LastModified = header.Get("Last-Modified")
+}
+
+// ifRangeValidator returns the value for If-Range. Weak ETags can not be used there,
+// Last-Modified is sent instead.
+func ifRangeValidator(file *models.File) string {
+	if file.ETag != "" && !strings.HasPrefix(file.ETag, "W/") {
+		return file.ETag
+	}
+
+	return file.LastModified
+}
+
+// contentRangeStart parses the first byte position of "Content-Range: bytes start-end/size".
+func contentRangeStart(header http.Header) (int64, bool) {
+	value, ok := strings.CutPrefix(header.Get("Content-Range"), "bytes ")
+	if !ok {
+		return 0, false
+	}
+
+	start, _, ok := strings.Cut(value, "-")
+	if !ok {
+		return 0, false
+	}
+
+	n, err := strconv.ParseInt(start, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+
+	return n, true
+}
+
+// resetProgress drops everything downloaded so far so the file is fetched again from zero.
+func resetProgress(file *models.File, tmpPath string) error {
+	file.DownloadedBytes = 0
+	file.Size = 0
+	file.Segments = nil
+	file.ETag = ""
+	file.LastModified = ""
+
+	if err := os.Truncate(tmpPath, 0); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
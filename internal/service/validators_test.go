@@ -0,0 +1,139 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/LashkaPashka/TaskDownloader/internal/config"
+)
+
+func serveWithETag(content []byte, etag string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", etag)
+		http.ServeContent(w, r, "data.bin", time.Time{}, bytes.NewReader(content))
+	}))
+}
+
+func TestResumeWithMatchingETag(t *testing.T) {
+	content := testContent(32 * 1024)
+	srv := serveWithETag(content, `"v1"`)
+	defer srv.Close()
+
+	g, task := newTestService(t, config.Downloader{Segments: 1}, srv.URL+"/data.bin")
+	file := task.File[0]
+
+	dir := filepath.Join(g.localStoragePath, task.ID)
+	os.MkdirAll(dir, os.ModePerm)
+	os.WriteFile(filepath.Join(dir, file.Filename+".part"), content[:1000], 0644)
+
+	file.DownloadedBytes = 1000
+	file.Size = int64(len(content))
+	file.ETag = `"v1"`
+
+	if err := g.DownloadWithResume(context.Background(), &sync.Mutex{}, task.ID, &file); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	got, _ := os.ReadFile(filepath.Join(dir, file.Filename))
+	if !bytes.Equal(got, content) {
+		t.Fatalf("Error: resumed content differs")
+	}
+}
+
+func TestResumeWithChangedETag(t *testing.T) {
+	content := testContent(32 * 1024)
+	srv := serveWithETag(content, `"v2"`)
+	defer srv.Close()
+
+	g, task := newTestService(t, config.Downloader{Segments: 1}, srv.URL+"/data.bin")
+	file := task.File[0]
+
+	dir := filepath.Join(g.localStoragePath, task.ID)
+	os.MkdirAll(dir, os.ModePerm)
+	// bytes of the previous version of the file
+	os.WriteFile(filepath.Join(dir, file.Filename+".part"), bytes.Repeat([]byte{0xff}, 40*1024), 0644)
+
+	file.DownloadedBytes = 40 * 1024
+	file.Size = 40 * 1024
+	file.ETag = `"v1"`
+
+	if err := g.DownloadWithResume(context.Background(), &sync.Mutex{}, task.ID, &file); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	got, _ := os.ReadFile(filepath.Join(dir, file.Filename))
+	if !bytes.Equal(got, content) {
+		t.Fatalf("Error: expected a fresh copy of the changed file, got %d bytes", len(got))
+	}
+
+	if file.ETag != `"v2"` || file.Size != int64(len(content)) {
+		t.Fatalf("Error: validators were not updated: %+v", file)
+	}
+}
+
+func TestResumeAlreadyComplete(t *testing.T) {
+	content := testContent(8 * 1024)
+	srv := serveWithETag(content, `"v1"`)
+	defer srv.Close()
+
+	g, task := newTestService(t, config.Downloader{Segments: 1}, srv.URL+"/data.bin")
+	file := task.File[0]
+
+	dir := filepath.Join(g.localStoragePath, task.ID)
+	os.MkdirAll(dir, os.ModePerm)
+	os.WriteFile(filepath.Join(dir, file.Filename+".part"), content, 0644)
+
+	file.DownloadedBytes = int64(len(content))
+	file.Size = int64(len(content))
+	file.ETag = `"v1"`
+
+	if err := g.DownloadWithResume(context.Background(), &sync.Mutex{}, task.ID, &file); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	if file.Status != statusDone {
+		t.Fatalf("Error: file status %s, want %s", file.Status, statusDone)
+	}
+
+	got, _ := os.ReadFile(filepath.Join(dir, file.Filename))
+	if !bytes.Equal(got, content) {
+		t.Fatalf("Error: content differs")
+	}
+}
+
+func TestSegmentsRestartWhenRemoteChanged(t *testing.T) {
+	content := testContent(64 * 1024)
+	srv := serveWithETag(content, `"v2"`)
+	defer srv.Close()
+
+	g, task := newTestService(t, config.Downloader{Segments: 2, MinSegmentSize: 1024}, srv.URL+"/data.bin")
+	file := task.File[0]
+
+	dir := filepath.Join(g.localStoragePath, task.ID)
+	os.MkdirAll(dir, os.ModePerm)
+	os.WriteFile(filepath.Join(dir, file.Filename+".part"), bytes.Repeat([]byte{0xff}, len(content)), 0644)
+
+	file.Size = int64(len(content))
+	file.ETag = `"v1"`
+	file.Segments = splitSegments(file.Size, 2, 1024)
+	for i := range file.Segments {
+		file.Segments[i].DownloadedBytes = 100
+		file.DownloadedBytes += 100
+	}
+
+	if err := g.DownloadWithResume(context.Background(), &sync.Mutex{}, task.ID, &file); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	got, _ := os.ReadFile(filepath.Join(dir, file.Filename))
+	if !bytes.Equal(got, content) {
+		t.Fatalf("Error: content differs after restart")
+	}
+}
@@ -0,0 +1,77 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/LashkaPashka/TaskDownloader/internal/models"
+	"github.com/LashkaPashka/TaskDownloader/internal/payload"
+)
+
+var ErrNoWebhookSecret = errors.New("client has no webhook secret")
+
+// Events of the webhooks.
+const (
+	WebhookFileDone = "file.done"
+	WebhookFileFailed = "file.failed"
+	WebhookTaskCompleted = "task.completed"
+	WebhookTaskFailed = "task.failed"
+)
+
+// notifyFile queues the webhook of a file that finished, other statuses are not sent.
+func (g *GoFetchService) notifyFile(task models.Task, file payload.StatusOfFileResponse) {
+	var event string
+	switch file.Status {
+	case statusDone:
+		event = WebhookFileDone
+	case statusFailed:
+		event = WebhookFileFailed
+	default:
+		return
+	}
+
+	g.notify(task, payload.WebhookNotification{Event: event, File: &file})
+}
+
+// notifyTask queues the webhook of a task that finished, other statuses are not sent.
+func (g *GoFetchService) notifyTask(task models.Task) {
+	var event string
+	switch task.Status {
+	case statusCompleted:
+		event = WebhookTaskCompleted
+	case statusFailed:
+		event = WebhookTaskFailed
+	default:
+		return
+	}
+
+	status := g.TaskStatus(task)
+	g.notify(task, payload.WebhookNotification{Event: event, Task: &status})
+}
+
+func (g *GoFetchService) notify(task models.Task, notification payload.WebhookNotification) {
+	const op = "TaskDownloader.service.notify"
+
+	if task.CallbackURL == "" {
+		return
+	}
+
+	notification.TaskID = task.ID
+	notification.ClientID = task.ClientID
+	notification.OccurredAt = time.Now().UTC()
+
+	body, err := json.Marshal(&notification)
+	if err == nil {
+		err = g.webhooks.Enqueue(task.ClientID, task.ID, task.CallbackURL, notification.Event, body)
+	}
+	if err != nil {
+		g.logger.Error("Failed to queue webhook",
+			slog.String("op", op),
+			slog.String("task_id", task.ID),
+			slog.String("event", notification.Event),
+			slog.String("err", err.Error()),
+		)
+	}
+}
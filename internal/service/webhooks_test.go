@@ -0,0 +1,120 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/LashkaPashka/TaskDownloader/internal/config"
+	converttotask "github.com/LashkaPashka/TaskDownloader/internal/lib/convertToTask"
+	eventbus "github.com/LashkaPashka/TaskDownloader/internal/lib/eventBus"
+	"github.com/LashkaPashka/TaskDownloader/internal/lib/retry"
+	"github.com/LashkaPashka/TaskDownloader/internal/lib/webhook"
+	"github.com/LashkaPashka/TaskDownloader/internal/models"
+	"github.com/LashkaPashka/TaskDownloader/internal/payload"
+)
+
+func TestWebhooks(t *testing.T) {
+	files := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing.bin" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write(testContent(4096))
+	}))
+	defer files.Close()
+
+	var (
+		mu sync.Mutex
+		received []payload.WebhookNotification
+	)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if !webhook.Verify("secret", r.Header.Get(webhook.HeaderSignature), r.Header.Get(webhook.HeaderTimestamp), body, time.Minute, time.Now()) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		var notification payload.WebhookNotification
+		if err := json.Unmarshal(body, &notification); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		mu.Lock()
+		received = append(received, notification)
+		mu.Unlock()
+	}))
+	defer receiver.Close()
+
+	g, _ := newTestService(t, config.Downloader{Workers: 2, MaxFilesPerTask: 2, Segments: 1, Retry: config.Retry{MaxAttempts: 1}})
+
+	log, err := webhook.OpenLog(filepath.Join(t.TempDir(), "webhooks.json"))
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	g.webhooks = webhook.NewDispatcher(log, map[string]string{"client": "secret"}, retry.Policy{MaxAttempts: 3, BaseBackoff: 10 * time.Millisecond}, time.Second, 0, g.logger)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go g.webhooks.Run(ctx)
+
+	if _, err := g.SaveTask(payload.SaveTaskRequest{ClientID: "unknown", CallbackURL: receiver.URL}); !errors.Is(err, ErrNoWebhookSecret) {
+		t.Fatalf("Error: got %v, want %v", err, ErrNoWebhookSecret)
+	}
+
+	task := converttotask.Convert(&payload.SaveTaskRequest{
+		ClientID: "client",
+		CallbackURL: receiver.URL,
+		Urls: []payload.FileRequest{{Url: files.URL + "/a.bin"}, {Url: files.URL + "/missing.bin"}},
+	})
+	if _, err := g.storage.SaveTask(task); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	go g.CompleteTask()
+	g.eventBus.Publish(eventbus.Event{
+		Type: eventbus.EventCreateTask,
+		Data: models.EventData{ClientID: task.ClientID, TaskID: task.ID},
+	})
+	waitFiles(t, g, task.ID, statusDone, statusFailed)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		mu.Lock()
+		n := len(received)
+		mu.Unlock()
+		if n >= 3 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Error: got %d webhooks, want 3", n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	events := make(map[string]payload.WebhookNotification)
+	for _, notification := range received {
+		if notification.TaskID != task.ID || notification.ClientID != "client" {
+			t.Fatalf("Error: unexpected webhook %+v", notification)
+		}
+		events[notification.Event] = notification
+	}
+
+	if done := events[WebhookFileDone]; done.File == nil || done.File.Index != 1 {
+		t.Fatalf("Error: unexpected %s webhook %+v", WebhookFileDone, done)
+	}
+	if failed := events[WebhookFileFailed]; failed.File == nil || failed.File.Index != 2 {
+		t.Fatalf("Error: unexpected %s webhook %+v", WebhookFileFailed, failed)
+	}
+	if finished := events[WebhookTaskFailed]; finished.Task == nil || len(finished.Task.Files) != 2 {
+		t.Fatalf("Error: unexpected %s webhook %+v", WebhookTaskFailed, finished)
+	}
+}
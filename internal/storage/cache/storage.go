@@ -0,0 +1,437 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/LashkaPashka/TaskDownloader/internal/lib/taskstatus"
+	"github.com/LashkaPashka/TaskDownloader/internal/models"
+)
+
+// Backend is the persistent storage behind the cache.
+type Backend interface {
+	SaveTask(task models.Task) (success bool, err error)
+	GetTask(taskID string) (models.Task, error)
+	SaveFile(taskID string, file *models.File) (success bool, err error)
+	GetFileById(taskID string, fileID int) (models.File, error)
+	ResetToQueued() (fileMp map[string][]models.File, err error)
+	AppendFiles(taskID string, files []models.File) ([]models.File, error)
+	ListTasks(filter models.TaskFilter) (models.TaskPage, error)
+}
+
+// Storage keeps tasks in memory and writes progress updates behind.
+// Status changes of files are written through at once, updates of the downloaded bytes
+// are coalesced and flushed to the underlying storage every flush interval and on Close.
+// Completed, failed and cancelled tasks are dropped once flushed, they are read from the underlying storage.
+// The cached tasks are never read again from the underlying storage: the cache is for a single process,
+// the changes made by another process or by hand are not seen.
+type Storage struct {
+	next          Backend
+	logger        *slog.Logger
+	flushInterval time.Duration
+
+	// flushMu orders writes to the underlying storage so that a stale progress flush
+	// never overwrites a newer status written through.
+	flushMu sync.Mutex
+
+	mu       sync.RWMutex
+	tasks    map[string]*models.Task
+	byClient map[string]map[string]struct{}
+	dirty    map[string]map[int]struct{}
+
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func New(next Backend, flushInterval time.Duration, logger *slog.Logger) *Storage {
+	s := &Storage{
+		next:          next,
+		logger:        logger,
+		flushInterval: flushInterval,
+		tasks:         make(map[string]*models.Task),
+		byClient:      make(map[string]map[string]struct{}),
+		dirty:         make(map[string]map[int]struct{}),
+		stop:          make(chan struct{}),
+		done:          make(chan struct{}),
+	}
+
+	go s.run()
+
+	return s
+}
+
+func (s *Storage) run() {
+	defer close(s.done)
+
+	ticker := time.NewTicker(s.flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.Flush()
+		case <-s.stop:
+			s.Flush()
+			return
+		}
+	}
+}
+
+// Close stops the background flusher and writes all pending updates.
+func (s *Storage) Close() error {
+	s.closeOnce.Do(func() {
+		close(s.stop)
+	})
+	<-s.done
+
+	return nil
+}
+
+// Flush writes dirty files to the underlying storage.
+func (s *Storage) Flush() {
+	const op = "TaskDownloader.storage.cache.Flush"
+
+	s.flushMu.Lock()
+	defer s.flushMu.Unlock()
+
+	type pending struct {
+		taskID string
+		file   models.File
+	}
+
+	s.mu.Lock()
+	var batch []pending
+	for taskID, indexes := range s.dirty {
+		task, ok := s.tasks[taskID]
+		if !ok {
+			continue
+		}
+		for fi := range task.File {
+			if _, ok := indexes[task.File[fi].Index]; ok {
+				batch = append(batch, pending{taskID: taskID, file: task.File[fi]})
+			}
+		}
+	}
+	s.dirty = make(map[string]map[int]struct{})
+	s.mu.Unlock()
+
+	for _, p := range batch {
+		if _, err := s.next.SaveFile(p.taskID, &p.file); err != nil {
+			s.logger.Error("Failed to flush file",
+				slog.String("op", op),
+				slog.String("task_id", p.taskID),
+				slog.Int("index", p.file.Index),
+				slog.String("err", err.Error()),
+			)
+
+			s.mu.Lock()
+			s.markDirty(p.taskID, p.file.Index)
+			s.mu.Unlock()
+		}
+	}
+
+	s.mu.Lock()
+	for _, p := range batch {
+		s.evict(p.taskID)
+	}
+	s.mu.Unlock()
+}
+
+func (s *Storage) SaveTask(task models.Task) (success bool, err error) {
+	if success, err := s.next.SaveTask(task); err != nil {
+		return success, err
+	}
+
+	s.mu.Lock()
+	s.put(task)
+	s.mu.Unlock()
+
+	return true, nil
+}
+
+func (s *Storage) GetTask(taskID string) (models.Task, error) {
+	s.mu.RLock()
+	task, ok := s.tasks[taskID]
+	if ok {
+		defer s.mu.RUnlock()
+		return copyTask(task), nil
+	}
+	s.mu.RUnlock()
+
+	return s.load(taskID)
+}
+
+func (s *Storage) SaveFile(taskID string, file *models.File) (success bool, err error) {
+	const op = "TaskDownloader.storage.cache.SaveFile"
+
+	if _, err := s.GetTask(taskID); err != nil {
+		return false, err
+	}
+
+	s.mu.Lock()
+	// a finished task is not cached, a change of it is written through
+	if _, ok := s.tasks[taskID]; ok {
+		cached, err := s.file(taskID, file.Index)
+		if err != nil {
+			s.mu.Unlock()
+			return false, err
+		}
+
+		if cached.Status == file.Status {
+			// timestamps are owned by the underlying storage
+			startedAt, finishedAt := cached.StartedAt, cached.FinishedAt
+			*cached = *file
+			cached.StartedAt, cached.FinishedAt = startedAt, finishedAt
+			cached.Segments = copySegments(file.Segments)
+			s.markDirty(taskID, file.Index)
+			s.mu.Unlock()
+
+			return true, nil
+		}
+	}
+	s.mu.Unlock()
+
+	// status changed, write through with the latest progress of the file
+	s.flushMu.Lock()
+	defer s.flushMu.Unlock()
+
+	if success, err := s.next.SaveFile(taskID, file); err != nil {
+		s.logger.Error("Failed to write file through",
+			slog.String("op", op),
+			slog.String("task_id", taskID),
+			slog.String("err", err.Error()),
+		)
+		return success, err
+	}
+
+	task, err := s.next.GetTask(taskID)
+	if err != nil {
+		return false, err
+	}
+
+	s.mu.Lock()
+	if indexes, ok := s.dirty[taskID]; ok {
+		delete(indexes, file.Index)
+		if len(indexes) == 0 {
+			delete(s.dirty, taskID)
+		}
+	}
+	s.refresh(task)
+	s.evict(taskID)
+	s.mu.Unlock()
+
+	return true, nil
+}
+
+// AppendFiles writes the files through and refreshes the cached task.
+func (s *Storage) AppendFiles(taskID string, files []models.File) ([]models.File, error) {
+	s.flushMu.Lock()
+	defer s.flushMu.Unlock()
+
+	appended, err := s.next.AppendFiles(taskID, files)
+	if err != nil {
+		return nil, err
+	}
+
+	task, err := s.next.GetTask(taskID)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	if _, ok := s.tasks[taskID]; ok {
+		s.refresh(task)
+	}
+	s.mu.Unlock()
+
+	return appended, nil
+}
+
+func (s *Storage) GetFileById(taskID string, fileID int) (models.File, error) {
+	task, err := s.GetTask(taskID)
+	if err != nil {
+		return models.File{}, err
+	}
+
+	for _, file := range task.File {
+		if file.Index == fileID {
+			return file, nil
+		}
+	}
+
+	return models.File{}, errors.New("not exist such file")
+}
+
+func (s *Storage) ResetToQueued() (fileMp map[string][]models.File, err error) {
+	s.Flush()
+
+	fileMp, err = s.next.ResetToQueued()
+	if err != nil {
+		return nil, err
+	}
+
+	// statuses were changed behind the cache
+	s.mu.Lock()
+	s.tasks = make(map[string]*models.Task)
+	s.byClient = make(map[string]map[string]struct{})
+	s.mu.Unlock()
+
+	return fileMp, nil
+}
+
+// ListTasks filters in the underlying storage, statuses are written through so they match.
+// Tasks held in the cache are returned with their progress that is not flushed yet.
+func (s *Storage) ListTasks(filter models.TaskFilter) (models.TaskPage, error) {
+	page, err := s.next.ListTasks(filter)
+	if err != nil {
+		return models.TaskPage{}, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for i := range page.Tasks {
+		if cached, ok := s.tasks[page.Tasks[i].ID]; ok {
+			page.Tasks[i] = copyTask(cached)
+		}
+	}
+
+	return page, nil
+}
+
+// TasksByClient returns the cached tasks of the client, the finished ones are not cached.
+func (s *Storage) TasksByClient(clientID string) []models.Task {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var tasks []models.Task
+	for taskID := range s.byClient[clientID] {
+		tasks = append(tasks, copyTask(s.tasks[taskID]))
+	}
+
+	return tasks
+}
+
+func (s *Storage) load(taskID string) (models.Task, error) {
+	task, err := s.next.GetTask(taskID)
+	if err != nil {
+		return models.Task{}, err
+	}
+
+	// the underlying storage returns an empty task when it does not exist
+	if task.ID == "" || finished(task.Status) {
+		return task, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// somebody could have loaded and updated it in the meantime
+	if cached, ok := s.tasks[taskID]; ok {
+		return copyTask(cached), nil
+	}
+	s.put(task)
+
+	return copyTask(s.tasks[taskID]), nil
+}
+
+// put must be called with mu held.
+func (s *Storage) put(task models.Task) {
+	t := copyTask(&task)
+	s.tasks[task.ID] = &t
+
+	if s.byClient[task.ClientID] == nil {
+		s.byClient[task.ClientID] = make(map[string]struct{})
+	}
+	s.byClient[task.ClientID][task.ID] = struct{}{}
+}
+
+// refresh replaces the cached task with the stored one keeping progress that is not flushed yet.
+// It must be called with mu held.
+func (s *Storage) refresh(task models.Task) {
+	old, ok := s.tasks[task.ID]
+	s.put(task)
+	if !ok {
+		return
+	}
+
+	for index := range s.dirty[task.ID] {
+		for oi := range old.File {
+			if old.File[oi].Index != index {
+				continue
+			}
+			if f, err := s.file(task.ID, index); err == nil {
+				startedAt, finishedAt := f.StartedAt, f.FinishedAt
+				*f = old.File[oi]
+				f.StartedAt, f.FinishedAt = startedAt, finishedAt
+			}
+		}
+	}
+}
+
+// file must be called with mu held.
+func (s *Storage) file(taskID string, index int) (*models.File, error) {
+	task, ok := s.tasks[taskID]
+	if !ok {
+		return nil, fmt.Errorf("not exist task %s", taskID)
+	}
+
+	for fi := range task.File {
+		if task.File[fi].Index == index {
+			return &task.File[fi], nil
+		}
+	}
+
+	return nil, fmt.Errorf("not exist file %d in task %s", index, taskID)
+}
+
+// evict drops the task when it is finished and none of its progress waits for a flush,
+// the cache holds the tasks that are being worked on. It must be called with mu held.
+func (s *Storage) evict(taskID string) {
+	task, ok := s.tasks[taskID]
+	if !ok || !finished(task.Status) || len(s.dirty[taskID]) > 0 {
+		return
+	}
+
+	delete(s.tasks, taskID)
+	if ids, ok := s.byClient[task.ClientID]; ok {
+		delete(ids, taskID)
+		if len(ids) == 0 {
+			delete(s.byClient, task.ClientID)
+		}
+	}
+}
+
+func finished(status string) bool {
+	return status == taskstatus.Completed || status == taskstatus.Failed || status == taskstatus.Cancelled
+}
+
+// markDirty must be called with mu held.
+func (s *Storage) markDirty(taskID string, index int) {
+	if s.dirty[taskID] == nil {
+		s.dirty[taskID] = make(map[int]struct{})
+	}
+	s.dirty[taskID][index] = struct{}{}
+}
+
+func copyTask(task *models.Task) models.Task {
+	t := *task
+	t.File = append([]models.File(nil), task.File...)
+	for fi := range t.File {
+		t.File[fi].Segments = copySegments(t.File[fi].Segments)
+	}
+
+	return t
+}
+
+func copySegments(segments []models.Segment) []models.Segment {
+	if segments == nil {
+		return nil
+	}
+
+	return append([]models.Segment(nil), segments...)
+}
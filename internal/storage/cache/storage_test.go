@@ -0,0 +1,300 @@
+package cache
+
+import (
+	"errors"
+	"log/slog"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/LashkaPashka/TaskDownloader/internal/models"
+)
+
+var logger = slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+// memoryBackend counts writes to check that progress updates are coalesced.
+type memoryBackend struct {
+	mu            sync.Mutex
+	tasks         map[string]models.Task
+	saveFileCalls int
+}
+
+func newMemoryBackend() *memoryBackend {
+	return &memoryBackend{tasks: make(map[string]models.Task)}
+}
+
+func (m *memoryBackend) SaveTask(task models.Task) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.tasks[task.ID] = copyTask(&task)
+	return true, nil
+}
+
+func (m *memoryBackend) GetTask(taskID string) (models.Task, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	task, ok := m.tasks[taskID]
+	if !ok {
+		return models.Task{}, nil
+	}
+	return copyTask(&task), nil
+}
+
+func (m *memoryBackend) SaveFile(taskID string, file *models.File) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.saveFileCalls++
+	task := m.tasks[taskID]
+	for fi := range task.File {
+		if task.File[fi].Index == file.Index {
+			task.File[fi] = *file
+			if file.Status == "done" {
+				task.Status = "completed"
+			}
+			m.tasks[taskID] = task
+			return true, nil
+		}
+	}
+	return false, errors.New("not exist such file")
+}
+
+func (m *memoryBackend) GetFileById(taskID string, fileID int) (models.File, error) {
+	return models.File{}, errors.New("not implemented")
+}
+
+func (m *memoryBackend) ResetToQueued() (map[string][]models.File, error) {
+	return nil, nil
+}
+
+func (m *memoryBackend) AppendFiles(taskID string, files []models.File) ([]models.File, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	task, ok := m.tasks[taskID]
+	if !ok {
+		return nil, errors.New("not exist task")
+	}
+
+	for i := range files {
+		files[i].Index = len(task.File) + i + 1
+	}
+	task.File = append(task.File, files...)
+	m.tasks[taskID] = task
+
+	return files, nil
+}
+
+func (m *memoryBackend) ListTasks(filter models.TaskFilter) (models.TaskPage, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var page models.TaskPage
+	for _, task := range m.tasks {
+		if filter.ClientID == "" || task.ClientID == filter.ClientID {
+			page.Tasks = append(page.Tasks, task)
+		}
+	}
+
+	return page, nil
+}
+
+func (m *memoryBackend) calls() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.saveFileCalls
+}
+
+func newTask() models.Task {
+	return models.Task{
+		ID:       "task_cache",
+		ClientID: "client",
+		Status:   "queued",
+		File: []models.File{
+			{Index: 1, Url: "https://example.com/a.zip", Filename: "a.zip", Status: "in_progress"},
+		},
+	}
+}
+
+func TestProgressIsCoalesced(t *testing.T) {
+	backend := newMemoryBackend()
+	st := New(backend, time.Hour, logger)
+	defer st.Close()
+
+	task := newTask()
+	if _, err := st.SaveTask(task); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	file := task.File[0]
+	for n := 1; n <= 100; n++ {
+		file.DownloadedBytes = int64(n)
+		if _, err := st.SaveFile(task.ID, &file); err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+	}
+
+	if backend.calls() != 0 {
+		t.Fatalf("Error: progress was written through %d times", backend.calls())
+	}
+
+	cached, _ := st.GetTask(task.ID)
+	if cached.File[0].DownloadedBytes != 100 {
+		t.Fatalf("Error: cached progress %d, want 100", cached.File[0].DownloadedBytes)
+	}
+
+	st.Flush()
+
+	if backend.calls() != 1 {
+		t.Fatalf("Error: flush made %d writes, want 1", backend.calls())
+	}
+
+	stored, _ := backend.GetTask(task.ID)
+	if stored.File[0].DownloadedBytes != 100 {
+		t.Fatalf("Error: stored progress %d, want 100", stored.File[0].DownloadedBytes)
+	}
+}
+
+func TestStatusChangeIsWrittenThrough(t *testing.T) {
+	backend := newMemoryBackend()
+	st := New(backend, time.Hour, logger)
+	defer st.Close()
+
+	task := newTask()
+	st.SaveTask(task)
+
+	file := task.File[0]
+	file.DownloadedBytes = 10
+	st.SaveFile(task.ID, &file)
+
+	file.DownloadedBytes = 20
+	file.Status = "done"
+	if _, err := st.SaveFile(task.ID, &file); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	stored, _ := backend.GetTask(task.ID)
+	if stored.File[0].Status != "done" || stored.File[0].DownloadedBytes != 20 || stored.Status != "completed" {
+		t.Fatalf("Error: status was not written through: %+v", stored)
+	}
+
+	cached, _ := st.GetTask(task.ID)
+	if cached.Status != "completed" {
+		t.Fatalf("Error: cached task status %s, want completed", cached.Status)
+	}
+
+	// nothing pending, the stale progress must not overwrite the final status
+	st.Flush()
+	stored, _ = backend.GetTask(task.ID)
+	if stored.File[0].Status != "done" {
+		t.Fatalf("Error: flush overwrote status with %s", stored.File[0].Status)
+	}
+}
+
+func TestCloseFlushesPending(t *testing.T) {
+	backend := newMemoryBackend()
+	st := New(backend, time.Hour, logger)
+
+	task := newTask()
+	st.SaveTask(task)
+
+	file := task.File[0]
+	file.DownloadedBytes = 42
+	st.SaveFile(task.ID, &file)
+
+	st.Close()
+
+	stored, _ := backend.GetTask(task.ID)
+	if stored.File[0].DownloadedBytes != 42 {
+		t.Fatalf("Error: pending progress lost on close, stored %d", stored.File[0].DownloadedBytes)
+	}
+}
+
+func TestTasksByClient(t *testing.T) {
+	st := New(newMemoryBackend(), time.Hour, logger)
+	defer st.Close()
+
+	st.SaveTask(newTask())
+
+	if tasks := st.TasksByClient("client"); len(tasks) != 1 {
+		t.Fatalf("Error: got %d tasks for client, want 1", len(tasks))
+	}
+}
+
+func TestAppendFilesKeepsProgress(t *testing.T) {
+	backend := newMemoryBackend()
+	st := New(backend, time.Hour, logger)
+	defer st.Close()
+
+	task := newTask()
+	if _, err := st.SaveTask(task); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	file := task.File[0]
+	file.DownloadedBytes = 42
+	if _, err := st.SaveFile(task.ID, &file); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	appended, err := st.AppendFiles(task.ID, []models.File{{Url: "https://example.com/b.zip", Filename: "b.zip", Status: "queued"}})
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if len(appended) != 1 || appended[0].Index != 2 {
+		t.Fatalf("Error: unexpected appended files %+v", appended)
+	}
+
+	cached, _ := st.GetTask(task.ID)
+	if len(cached.File) != 2 || cached.File[0].DownloadedBytes != 42 {
+		t.Fatalf("Error: unexpected cached task %+v", cached)
+	}
+}
+
+func TestFinishedTaskIsEvicted(t *testing.T) {
+	backend := newMemoryBackend()
+	st := New(backend, time.Hour, logger)
+	defer st.Close()
+
+	task := newTask()
+	st.SaveTask(task)
+
+	file := task.File[0]
+	file.DownloadedBytes = 10
+	st.SaveFile(task.ID, &file)
+
+	file.Status = "done"
+	if _, err := st.SaveFile(task.ID, &file); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	st.mu.RLock()
+	_, cached := st.tasks[task.ID]
+	clients := len(st.byClient)
+	st.mu.RUnlock()
+	if cached || clients != 0 {
+		t.Fatalf("Error: completed task is still cached")
+	}
+
+	// reading it does not cache it again
+	got, err := st.GetTask(task.ID)
+	if err != nil || got.Status != "completed" {
+		t.Fatalf("Error: unexpected task %+v, %v", got, err)
+	}
+	if tasks := st.TasksByClient("client"); len(tasks) != 0 {
+		t.Fatalf("Error: completed task was cached on read")
+	}
+
+	// a finished task that is retried goes through the cache again
+	file.Status = "in_progress"
+	if _, err := st.SaveFile(task.ID, &file); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if stored, _ := backend.GetTask(task.ID); stored.File[0].Status != "in_progress" {
+		t.Fatalf("Error: change of a finished task was not written through: %+v", stored)
+	}
+}
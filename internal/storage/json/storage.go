@@ -1,22 +1,24 @@
 package storage
 
 import (
-	"bufio"
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"log/slog"
 	"os"
+	"sync"
 	"time"
 
+	"github.com/LashkaPashka/TaskDownloader/internal/lib/atomicfile"
 	"github.com/LashkaPashka/TaskDownloader/internal/lib/encode"
+	"github.com/LashkaPashka/TaskDownloader/internal/lib/pagination"
+	"github.com/LashkaPashka/TaskDownloader/internal/lib/taskstatus"
 	"github.com/LashkaPashka/TaskDownloader/internal/models"
 )
 
 const (
 	statusInProgress = "in_progress"
-	statusRunning = "running"
-	statusFailed = "failed"
 	statusQueued = "queued"
 	statusCompleted = "completed"
 	statusDone = "done"
@@ -39,20 +41,22 @@ func updateTask(tasks []models.Task, taskID string, file *models.File) []models.
 
 		for fi := range tasks[ti].File {
 			if tasks[ti].File[fi].Index == file.Index {	
-				tasks[ti].File[fi].DownloadedBytes = file.DownloadedBytes
-				tasks[ti].File[fi].Size = file.Size
-				tasks[ti].File[fi].Status = file.Status
+				// timestamps are set by the storage itself
+				startedAt, finishedAt := tasks[ti].File[fi].StartedAt, tasks[ti].File[fi].FinishedAt
+				previous := tasks[ti].File[fi].Status
+				tasks[ti].File[fi] = *file
+				tasks[ti].File[fi].StartedAt, tasks[ti].File[fi].FinishedAt = startedAt, finishedAt
 			
 				switch file.Status {
 					case statusInProgress:
-						tasks[ti].File[fi].StartedAt = time.Now()
-						tasks[ti].Status = statusRunning
+						// set when the file starts, not on every saved chunk
+						if previous != statusInProgress {
+							tasks[ti].File[fi].StartedAt = time.Now()
+						}
 					case statusDone:
 						tasks[ti].File[fi].FinishedAt = time.Now()
-						tasks[ti].Status = statusCompleted
-					default:
-						tasks[ti].Status = statusFailed
 				}
+				tasks[ti].Status = taskstatus.Aggregate(tasks[ti].File)
 
 				return tasks
 			}			
@@ -63,6 +67,7 @@ func updateTask(tasks []models.Task, taskID string, file *models.File) []models.
 }
 
 type Storage struct {
+	mu sync.RWMutex
 	storagePath string
 	logger *slog.Logger
 }
@@ -82,186 +87,333 @@ func New(storagePath string, logger *slog.Logger) (*Storage, error) {
 		return nil, err
 	}
 
-	return &Storage{
+	s := &Storage{
 		storagePath: storagePath,
 		logger: logger,
-	}, nil
+	}
+
+	if err := s.recover(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
 }
 
-func (s *Storage) SaveTask(task models.Task) (success bool, err error) {
-	const op = "TaskDonwloader.storage.methodsForJson.SaveTask"
+// recover checks that the storage file can be decoded and restores it from the backup otherwise.
+func (s *Storage) recover() error {
+	const op = "TaskDonwloader.storage.methodsForJson.recover"
+
+	_, _, err := s.load()
+	if err == nil {
+		return nil
+	}
 
-	file, err := os.ReadFile(s.storagePath)
+	s.logger.Warn("Storage file is corrupted, trying backup",
+		slog.String("op", op),
+		slog.String("path", s.storagePath),
+		slog.String("err", err.Error()),
+	)
+
+	backup, err := os.ReadFile(s.backupPath())
 	if err != nil {
-		s.logger.Error("Invalied readfile", 
+		s.logger.Error("Backup of storage file is not available",
 			slog.String("op", op),
+			slog.String("path", s.backupPath()),
 			slog.String("err", err.Error()),
 		)
-		return false, err
+		return fmt.Errorf("storage file %s is corrupted and has no backup: %w", s.storagePath, err)
 	}
 
-	tasks := []models.Task{}
+	if _, err := decode(backup); err != nil {
+		s.logger.Error("Backup of storage file is corrupted",
+			slog.String("op", op),
+			slog.String("path", s.backupPath()),
+			slog.String("err", err.Error()),
+		)
+		return fmt.Errorf("storage file %s and its backup are corrupted: %w", s.storagePath, err)
+	}
 
-	json.Unmarshal(file, &tasks)
+	// keep the broken file around for inspection
+	corruptPath := fmt.Sprintf("%s.corrupt-%d", s.storagePath, time.Now().Unix())
+	if err := os.Rename(s.storagePath, corruptPath); err != nil {
+		return err
+	}
 
-	tasks = append(tasks, task)
+	if err := atomicfile.Write(s.storagePath, backup); err != nil {
+		return err
+	}
 
-	encodeTasks, err := encode.Encode(tasks, s.logger)
+	s.logger.Warn("Storage file restored from backup",
+		slog.String("op", op),
+		slog.String("path", s.storagePath),
+		slog.String("corrupted", corruptPath),
+	)
+
+	return nil
+}
+
+func (s *Storage) backupPath() string {
+	return s.storagePath + ".bak"
+}
+
+// load reads and decodes the storage file, raw is the content as it is on disk.
+func (s *Storage) load() (tasks []models.Task, raw []byte, err error) {
+	raw, err = os.ReadFile(s.storagePath)
 	if err != nil {
-		return false, err
+		return nil, nil, err
 	}
 
-	if err = os.WriteFile(s.storagePath, encodeTasks, 0644); err != nil {
-		s.logger.Error("Invalid save task in file",
+	tasks, err = decode(raw)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return tasks, raw, nil
+}
+
+// mutate serializes read-modify-write cycles of the storage file.
+// The previous content is kept as a backup before the new one atomically replaces it.
+func (s *Storage) mutate(op string, fn func(tasks []models.Task) ([]models.Task, error)) error {
+	return s.modify(op, func(tasks []models.Task) ([]models.Task, bool, error) {
+		tasks, err := fn(tasks)
+		return tasks, true, err
+	})
+}
+
+// modify is mutate where fn also tells whether the change is durable. A change that is not,
+// the progress of a file saved for every chunk, skips the backup and the sync of the directory:
+// a crash may lose it, but never leaves a partial file.
+func (s *Storage) modify(op string, fn func(tasks []models.Task) (updated []models.Task, durable bool, err error)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tasks, raw, err := s.load()
+	if err != nil {
+		s.logger.Error("Invalid load storage file",
 			slog.String("op", op),
 			slog.String("err", err.Error()),
 		)
-		return false, err
+		return err
 	}
 
-	return true, nil
-}
+	tasks, durable, err := fn(tasks)
+	if err != nil {
+		return err
+	}
 
-func (s *Storage) GetTask(taskID string) (models.Task, error) {
-	const op = "TaskDonwloader.storage.methodsForJson.GetTask"
-	
-	file, err := os.Open(s.storagePath)
+	encodeTasks, err := encode.Encode(tasks, s.logger)
 	if err != nil {
-		s.logger.Error("Failed to open storage file",
-        	slog.String("file", s.storagePath),
-        	slog.String("err", err.Error()),
-    	)
-		return models.Task{}, err
+		return err
 	}
-	
-	scanner := bufio.NewScanner(file)	
 
-	var b []byte
-	for scanner.Scan() {
-		b = append(b, []byte(scanner.Text()+"\n")...)
+	if !durable {
+		if err := atomicfile.Replace(s.storagePath, encodeTasks); err != nil {
+			s.logger.Error("Invalid save storage file",
+				slog.String("op", op),
+				slog.String("err", err.Error()),
+			)
+			return err
+		}
+		return nil
+	}
+
+	if len(bytes.TrimSpace(raw)) > 0 {
+		if err := atomicfile.Write(s.backupPath(), raw); err != nil {
+			s.logger.Error("Invalid save backup of storage file",
+				slog.String("op", op),
+				slog.String("err", err.Error()),
+			)
+			return err
+		}
 	}
-	if err := scanner.Err(); err != nil {
-		 s.logger.Error("Scanner encountered an error",
+
+	if err := atomicfile.Write(s.storagePath, encodeTasks); err != nil {
+		s.logger.Error("Invalid save storage file",
 			slog.String("op", op),
 			slog.String("err", err.Error()),
-    	)
-		return models.Task{}, err
+		)
+		return err
 	}
 
+	return nil
+}
+
+func decode(raw []byte) ([]models.Task, error) {
 	var tasks []models.Task
 
-	json.Unmarshal(b, &tasks)
+	// an empty file is a fresh storage
+	if len(bytes.TrimSpace(raw)) == 0 {
+		return tasks, nil
+	}
 
-	task := searchTask(tasks, taskID)
+	if err := json.Unmarshal(raw, &tasks); err != nil {
+		return nil, err
+	}
 
-	return task, nil
+	return tasks, nil
 }
 
-func (s *Storage) SaveFile(taskID string, file *models.File) (success bool, err error) {
-	const op = "TaskDonwloader.storage.methodsForJson.UpdateTask"
+func (s *Storage) SaveTask(task models.Task) (success bool, err error) {
+	const op = "TaskDonwloader.storage.methodsForJson.SaveTask"
 
-	f, err := os.Open(s.storagePath)
+	err = s.mutate(op, func(tasks []models.Task) ([]models.Task, error) {
+		return append(tasks, task), nil
+	})
 	if err != nil {
+		s.logger.Error("Invalid save task in file",
+			slog.String("op", op),
+			slog.String("err", err.Error()),
+		)
 		return false, err
 	}
-	
-	scanner := bufio.NewScanner(f)	
 
-	var b []byte
-	for scanner.Scan() {
-		b = append(b, []byte(scanner.Text()+"\n")...)
-	}
-	if err := scanner.Err(); err != nil {
-		s.logger.Error("Invalid scanner text", 
+	return true, nil
+}
+
+// AppendFiles adds the files to the task. They are numbered after the last file of the task
+// keeping their order, the stored files are returned.
+func (s *Storage) AppendFiles(taskID string, files []models.File) ([]models.File, error) {
+	const op = "TaskDonwloader.storage.methodsForJson.AppendFiles"
+
+	var appended []models.File
+
+	err := s.mutate(op, func(tasks []models.Task) ([]models.Task, error) {
+		for ti := range tasks {
+			if tasks[ti].ID != taskID {
+				continue
+			}
+
+			last := 0
+			for _, file := range tasks[ti].File {
+				last = max(last, file.Index)
+			}
+
+			appended = make([]models.File, 0, len(files))
+			for i, file := range files {
+				file.Index = last + i + 1
+				appended = append(appended, file)
+			}
+
+			tasks[ti].File = append(tasks[ti].File, appended...)
+			tasks[ti].Status = taskstatus.Aggregate(tasks[ti].File)
+
+			return tasks, nil
+		}
+
+		return nil, fmt.Errorf("not exist task %s", taskID)
+	})
+	if err != nil {
+		s.logger.Error("Invalid append files in file",
 			slog.String("op", op),
 			slog.String("err", err.Error()),
 		)
-		return false, err
+		return nil, err
 	}
 
-	var tasks []models.Task
+	return appended, nil
+}
 
-	json.Unmarshal(b, &tasks)
+func (s *Storage) GetTask(taskID string) (models.Task, error) {
+	const op = "TaskDonwloader.storage.methodsForJson.GetTask"
 
-	// TODO: update status of Task  
-	updatedTasks := updateTask(tasks, taskID, file)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 
-	// TODO: convert Task
-	bytesTasks, err := encode.Encode(updatedTasks, s.logger)
+	tasks, _, err := s.load()
 	if err != nil {
-		s.logger.Error("Invalid encode tasks", 
+		s.logger.Error("Failed to load storage file",
 			slog.String("op", op),
+			slog.String("file", s.storagePath),
 			slog.String("err", err.Error()),
 		)
-		return false, err
+		return models.Task{}, err
 	}
 
-	if err := os.WriteFile(s.storagePath, bytesTasks, 0644); err != nil {
-		panic(err)
-	}
+	task := searchTask(tasks, taskID)
 
-	return true, nil
+	return task, nil
 }
 
-func (s *Storage) ResetToQueued() (fileMp map[string][]models.File, err error) {
-	const op = "TaskDonwloader.storage.methodsForJson.ResetToQueued"
+func (s *Storage) ListTasks(filter models.TaskFilter) (models.TaskPage, error) {
+	const op = "TaskDonwloader.storage.methodsForJson.ListTasks"
 
-	f, err := os.Open(s.storagePath)
-	if err != nil {
-		return nil, err
-	}
-	
-	scanner := bufio.NewScanner(f)	
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 
-	var b []byte
-	for scanner.Scan() {
-		b = append(b, []byte(scanner.Text()+"\n")...)
-	}
-	if err := scanner.Err(); err != nil {
-		s.logger.Error("Invalid scanner text", 
+	tasks, _, err := s.load()
+	if err != nil {
+		s.logger.Error("Failed to load storage file",
 			slog.String("op", op),
+			slog.String("file", s.storagePath),
 			slog.String("err", err.Error()),
 		)
-		return nil, err
+		return models.TaskPage{}, err
 	}
 
-	var tasks []models.Task
+	return pagination.Page(tasks, filter)
+}
 
-	json.Unmarshal(b, &tasks)
+func (s *Storage) SaveFile(taskID string, file *models.File) (success bool, err error) {
+	const op = "TaskDonwloader.storage.methodsForJson.UpdateTask"
 
-	// If length is equal 0 then return nil
-	if len(tasks) == 0 {
-		return nil, nil
+	err = s.modify(op, func(tasks []models.Task) ([]models.Task, bool, error) {
+		// a save without a change of the status is progress only
+		durable := true
+		for _, f := range searchTask(tasks, taskID).File {
+			if f.Index == file.Index {
+				durable = f.Status != file.Status
+			}
+		}
+
+		// TODO: update status of Task
+		updatedTasks := updateTask(tasks, taskID, file)
+		if updatedTasks == nil {
+			return nil, false, fmt.Errorf("not exist file %d in task %s", file.Index, taskID)
+		}
+
+		return updatedTasks, durable, nil
+	})
+	if err != nil {
+		s.logger.Error("Invalid save file",
+			slog.String("op", op),
+			slog.String("err", err.Error()),
+		)
+		return false, err
 	}
 
-	fileMp = make(map[string][]models.File, len(tasks))
+	return true, nil
+}
 
-	for ti := range tasks {
-		if tasks[ti].Status == statusCompleted {
-			continue
+func (s *Storage) ResetToQueued() (fileMp map[string][]models.File, err error) {
+	const op = "TaskDonwloader.storage.methodsForJson.ResetToQueued"
+
+	err = s.mutate(op, func(tasks []models.Task) ([]models.Task, error) {
+		// If length is equal 0 then return nil
+		if len(tasks) == 0 {
+			return tasks, nil
 		}
 
-		for fi := range tasks[ti].File {
-			if tasks[ti].File[fi].Status == statusInProgress || tasks[ti].File[fi].Status == statusQueued {
-				tasks[ti].File[fi].Status = statusQueued
-				fileMp[tasks[ti].ID] = append(fileMp[tasks[ti].ID], tasks[ti].File[fi])
+		fileMp = make(map[string][]models.File, len(tasks))
+
+		for ti := range tasks {
+			if tasks[ti].Status == statusCompleted {
+				continue
+			}
+
+			for fi := range tasks[ti].File {
+				if tasks[ti].File[fi].Status == statusInProgress || tasks[ti].File[fi].Status == statusQueued {
+					tasks[ti].File[fi].Status = statusQueued
+					fileMp[tasks[ti].ID] = append(fileMp[tasks[ti].ID], tasks[ti].File[fi])
+				}
 			}
 		}
-	}
 
-	bytesTasks, err := encode.Encode(tasks, s.logger)
+		return tasks, nil
+	})
 	if err != nil {
-		s.logger.Error("Invalid encode tasks", 
-			slog.String("op", op),
-			slog.String("Err", err.Error()),
-		)
 		return nil, err
 	}
 
-	if err := os.WriteFile(s.storagePath, bytesTasks, 0644); err != nil {
-		panic(err)
-	}
-
 	return fileMp, nil
 }
 
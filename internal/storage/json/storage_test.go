@@ -1,12 +1,18 @@
 package storage
 
 import (
+	"fmt"
 	"log/slog"
 	"os"
+	"path/filepath"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/LashkaPashka/TaskDownloader/internal/models"
 	"github.com/LashkaPashka/TaskDownloader/internal/payload"
 	converttotask "github.com/LashkaPashka/TaskDownloader/internal/lib/convertToTask"
+	"github.com/LashkaPashka/TaskDownloader/internal/lib/taskstatus"
 )
 
 const storagePath = "../tasks/tasks.json"
@@ -33,9 +39,9 @@ func TestGetTask(t *testing.T) {
 
 func TestSaveTask(t *testing.T) {
 	body := payload.SaveTaskRequest{
-			Urls: []string{
-				"https://getsamplefiles.com/download/zip/sample-1.zip",
-				"https://getsamplefiles.com/download/zip/sample-4.zip",
+			Urls: []payload.FileRequest{
+				{Url: "https://getsamplefiles.com/download/zip/sample-1.zip"},
+				{Url: "https://getsamplefiles.com/download/zip/sample-4.zip"},
 			},
 			ClientID: "3f3f32f2",
 
@@ -60,6 +66,265 @@ func TestUpdateTask(t *testing.T) {
 	// t.Log(success)
 }
 
+func newTempStorage(t *testing.T, content string) *Storage {
+	path := filepath.Join(t.TempDir(), "tasks.json")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	s, err := New(path, logger)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	return s
+}
+
+func TestSaveTaskKeepsBackup(t *testing.T) {
+	s := newTempStorage(t, "[]")
+
+	first := converttotask.Convert(&payload.SaveTaskRequest{Urls: []payload.FileRequest{{Url: "https://example.com/a.zip"}}, ClientID: "c1"})
+	second := converttotask.Convert(&payload.SaveTaskRequest{Urls: []payload.FileRequest{{Url: "https://example.com/b.zip"}}, ClientID: "c1"})
+	second.ID = first.ID + "_2"
+
+	if _, err := s.SaveTask(first); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if _, err := s.SaveTask(second); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	backup, err := os.ReadFile(s.backupPath())
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	tasks, err := decode(backup)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	if len(tasks) != 1 || tasks[0].ID != first.ID {
+		t.Fatalf("Error: backup should hold the state before the last write, got %+v", tasks)
+	}
+
+	matches, _ := filepath.Glob(filepath.Join(filepath.Dir(s.storagePath), "*.tmp-*"))
+	if len(matches) != 0 {
+		t.Fatalf("Error: temp files left behind: %v", matches)
+	}
+}
+
+func TestProgressSkipsBackup(t *testing.T) {
+	s := newTempStorage(t, "[]")
+
+	task := converttotask.Convert(&payload.SaveTaskRequest{Urls: []payload.FileRequest{{Url: "https://example.com/a.zip"}}, ClientID: "c1"})
+	if _, err := s.SaveTask(task); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	file := task.File[0]
+	file.Status = statusInProgress
+	if _, err := s.SaveFile(task.ID, &file); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	before, _ := os.ReadFile(s.backupPath())
+
+	for n := 1; n <= 3; n++ {
+		file.DownloadedBytes = int64(n * 32 * 1024)
+		if _, err := s.SaveFile(task.ID, &file); err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+	}
+
+	after, _ := os.ReadFile(s.backupPath())
+	if string(after) != string(before) {
+		t.Fatalf("Error: progress rewrote the backup")
+	}
+
+	got, _ := s.GetTask(task.ID)
+	if got.File[0].DownloadedBytes != 3*32*1024 {
+		t.Fatalf("Error: progress was not saved, downloaded %d", got.File[0].DownloadedBytes)
+	}
+}
+
+func TestRecoverFromCorruptedFile(t *testing.T) {
+	s := newTempStorage(t, "[]")
+
+	task := converttotask.Convert(&payload.SaveTaskRequest{Urls: []payload.FileRequest{{Url: "https://example.com/a.zip"}}, ClientID: "c1"})
+	if _, err := s.SaveTask(task); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	// a second write moves the state with the task into the backup
+	file := task.File[0]
+	file.Status = statusInProgress
+	if _, err := s.SaveFile(task.ID, &file); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	// simulate a crash in the middle of a non-atomic write
+	if err := os.WriteFile(s.storagePath, []byte(`[{"files":[{"downloadedBy`), 0644); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	recovered, err := New(s.storagePath, logger)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	got, err := recovered.GetTask(task.ID)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	if got.ID != task.ID {
+		t.Fatalf("Error: task was not recovered from backup")
+	}
+}
+
+func TestCorruptedFileWithoutBackup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tasks.json")
+	if err := os.WriteFile(path, []byte(`[{"id":`), 0644); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	if _, err := New(path, logger); err == nil {
+		t.Fatalf("Error: expected error for corrupted storage without backup")
+	}
+}
+
+func TestConcurrentSaveFile(t *testing.T) {
+	s := newTempStorage(t, "[]")
+
+	var tasks []models.Task
+	for i := 0; i < 5; i++ {
+		task := converttotask.Convert(&payload.SaveTaskRequest{Urls: []payload.FileRequest{{Url: "https://example.com/a.zip"}}, ClientID: "c1"})
+		task.ID = fmt.Sprintf("task_%d", i)
+		if _, err := s.SaveTask(task); err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		tasks = append(tasks, task)
+	}
+
+	var wg sync.WaitGroup
+	for _, task := range tasks {
+		wg.Add(1)
+		go func(task models.Task) {
+			defer wg.Done()
+
+			file := task.File[0]
+			file.Status = statusInProgress
+			for n := 1; n <= 20; n++ {
+				file.DownloadedBytes = int64(n)
+				if _, err := s.SaveFile(task.ID, &file); err != nil {
+					t.Errorf("Error: %v", err)
+					return
+				}
+			}
+		}(task)
+	}
+	wg.Wait()
+
+	for _, task := range tasks {
+		got, err := s.GetTask(task.ID)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if got.File[0].DownloadedBytes != 20 {
+			t.Fatalf("Error: task %s lost updates, downloaded %d", task.ID, got.File[0].DownloadedBytes)
+		}
+	}
+}
+
+func TestStartedAtIsKeptBetweenChunks(t *testing.T) {
+	s := newTempStorage(t, "[]")
+
+	task := converttotask.Convert(&payload.SaveTaskRequest{Urls: []payload.FileRequest{{Url: "https://example.com/a.zip"}}, ClientID: "c1"})
+	if _, err := s.SaveTask(task); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	file := task.File[0]
+	file.Status = statusInProgress
+	file.DownloadedBytes = 1024
+	if _, err := s.SaveFile(task.ID, &file); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	first, _ := s.GetTask(task.ID)
+
+	time.Sleep(10 * time.Millisecond)
+	file.DownloadedBytes = 2048
+	if _, err := s.SaveFile(task.ID, &file); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	second, _ := s.GetTask(task.ID)
+
+	startedAt := first.File[0].StartedAt
+	if startedAt.IsZero() || !second.File[0].StartedAt.Equal(startedAt) || second.File[0].DownloadedBytes != 2048 {
+		t.Fatalf("Error: started_at moved from %v to %v", startedAt, second.File[0].StartedAt)
+	}
+}
+
+func TestAppendFiles(t *testing.T) {
+	s := newTempStorage(t, "[]")
+
+	task := converttotask.Convert(&payload.SaveTaskRequest{Urls: []payload.FileRequest{{Url: "https://example.com/a.zip"}}, ClientID: "c1"})
+	if _, err := s.SaveTask(task); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	file := task.File[0]
+	file.Status = statusDone
+	if _, err := s.SaveFile(task.ID, &file); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	files := converttotask.ConvertFiles([]payload.FileRequest{{Url: "https://example.com/b.zip"}, {Url: "https://example.com/c.zip"}}, 1)
+	appended, err := s.AppendFiles(task.ID, files)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if len(appended) != 2 || appended[0].Index != 2 || appended[1].Index != 3 {
+		t.Fatalf("Error: unexpected appended files %+v", appended)
+	}
+
+	// the completed task is reopened
+	got, _ := s.GetTask(task.ID)
+	if len(got.File) != 3 || got.File[2].Filename != "c.zip" || got.Status != taskstatus.Running {
+		t.Fatalf("Error: unexpected task %+v", got)
+	}
+
+	if _, err := s.AppendFiles("task_missing", files); err == nil {
+		t.Fatalf("Error: expected error for missing task")
+	}
+}
+
+func TestListTasks(t *testing.T) {
+	s := newTempStorage(t, "[]")
+
+	for i := 0; i < 3; i++ {
+		task := converttotask.Convert(&payload.SaveTaskRequest{Urls: []payload.FileRequest{{Url: "https://example.com/a.zip"}}, ClientID: fmt.Sprintf("c%d", i%2)})
+		if _, err := s.SaveTask(task); err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+	}
+
+	page, err := s.ListTasks(models.TaskFilter{ClientID: "c0", Limit: 1})
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if len(page.Tasks) != 1 || page.NextCursor == "" {
+		t.Fatalf("Error: unexpected first page %+v", page)
+	}
+
+	next, err := s.ListTasks(models.TaskFilter{ClientID: "c0", Limit: 1, Cursor: page.NextCursor})
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if len(next.Tasks) != 1 || next.NextCursor != "" || next.Tasks[0].ID == page.Tasks[0].ID {
+		t.Fatalf("Error: unexpected second page %+v", next)
+	}
+}
+
 func setupLogger(env string) *slog.Logger {
 	var log *slog.Logger
 
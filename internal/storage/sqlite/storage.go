@@ -0,0 +1,690 @@
+package sqlite
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/LashkaPashka/TaskDownloader/internal/lib/pagination"
+	"github.com/LashkaPashka/TaskDownloader/internal/lib/taskstatus"
+	"github.com/LashkaPashka/TaskDownloader/internal/models"
+	_ "modernc.org/sqlite"
+)
+
+const (
+	statusInProgress = "in_progress"
+	statusQueued     = "queued"
+	statusCompleted  = "completed"
+	statusDone       = "done"
+)
+
+// timeLayout is fixed-width so that stored timestamps sort lexically.
+const timeLayout = "2006-01-02T15:04:05.000000000Z"
+
+// migrations are applied in order, PRAGMA user_version keeps the number of applied ones.
+var migrations = []string{
+	`CREATE TABLE IF NOT EXISTS tasks (
+		id			TEXT PRIMARY KEY,
+		client_id	TEXT NOT NULL,
+		status		TEXT NOT NULL,
+		created_at	TEXT NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS idx_tasks_client_id ON tasks(client_id);
+	CREATE TABLE IF NOT EXISTS files (
+		task_id				TEXT NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
+		idx					INTEGER NOT NULL,
+		url					TEXT NOT NULL,
+		filename			TEXT NOT NULL,
+		status				TEXT NOT NULL,
+		downloaded_bytes	INTEGER NOT NULL DEFAULT 0,
+		size				INTEGER NOT NULL DEFAULT 0,
+		started_at			TEXT NOT NULL,
+		finished_at			TEXT NOT NULL,
+		PRIMARY KEY (task_id, idx)
+	);
+	CREATE INDEX IF NOT EXISTS idx_files_task_id ON files(task_id);`,
+	`ALTER TABLE files ADD COLUMN segments TEXT NOT NULL DEFAULT '';`,
+	`ALTER TABLE files ADD COLUMN etag TEXT NOT NULL DEFAULT '';
+	ALTER TABLE files ADD COLUMN last_modified TEXT NOT NULL DEFAULT '';`,
+	`ALTER TABLE files ADD COLUMN checksum_algo TEXT NOT NULL DEFAULT '';
+	ALTER TABLE files ADD COLUMN expected_checksum TEXT NOT NULL DEFAULT '';
+	ALTER TABLE files ADD COLUMN checksum TEXT NOT NULL DEFAULT '';
+	ALTER TABLE files ADD COLUMN fail_reason TEXT NOT NULL DEFAULT '';`,
+	`ALTER TABLE files ADD COLUMN attempts INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE files ADD COLUMN last_error TEXT NOT NULL DEFAULT '';`,
+	`ALTER TABLE tasks ADD COLUMN max_bytes_per_sec INTEGER NOT NULL DEFAULT 0;`,
+	`ALTER TABLE tasks ADD COLUMN callback_url TEXT NOT NULL DEFAULT '';`,
+	`ALTER TABLE files ADD COLUMN next_attempt_at TEXT NOT NULL DEFAULT '';`,
+}
+
+type Storage struct {
+	db     *sql.DB
+	logger *slog.Logger
+}
+
+func New(storagePath string, logger *slog.Logger) (*Storage, error) {
+	const op = "TaskDownloader.storage.sqlite.New"
+
+	db, err := sql.Open("sqlite", storagePath+"?_pragma=foreign_keys(1)&_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)")
+	if err != nil {
+		logger.Error("Error open database",
+			slog.String("op", op),
+			slog.String("path", storagePath),
+			slog.String("err", err.Error()),
+		)
+		return nil, err
+	}
+
+	// sqlite allows a single writer, serialize access on our side instead of getting SQLITE_BUSY
+	db.SetMaxOpenConns(1)
+
+	s := &Storage{
+		db:     db,
+		logger: logger,
+	}
+
+	if err := s.migrate(); err != nil {
+		logger.Error("Error migrate database",
+			slog.String("op", op),
+			slog.String("path", storagePath),
+			slog.String("err", err.Error()),
+		)
+		db.Close()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (s *Storage) migrate() error {
+	var version int
+	if err := s.db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return err
+	}
+
+	for i := version; i < len(migrations); i++ {
+		tx, err := s.db.Begin()
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec(migrations[i]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d: %w", i+1, err)
+		}
+
+		if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", i+1)); err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *Storage) Close() error {
+	return s.db.Close()
+}
+
+func (s *Storage) SaveTask(task models.Task) (success bool, err error) {
+	const op = "TaskDownloader.storage.sqlite.SaveTask"
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(
+		`INSERT INTO tasks (id, client_id, status, created_at, max_bytes_per_sec, callback_url) VALUES (?, ?, ?, ?, ?, ?)`,
+		task.ID, task.ClientID, task.Status, formatTime(task.CreatedAt), task.MaxBytesPerSec, task.CallbackURL,
+	); err != nil {
+		s.logger.Error("Invalid insert task",
+			slog.String("op", op),
+			slog.String("err", err.Error()),
+		)
+		return false, err
+	}
+
+	for i := range task.File {
+		if err := insertFile(tx, task.ID, &task.File[i]); err != nil {
+			s.logger.Error("Invalid insert file",
+				slog.String("op", op),
+				slog.String("err", err.Error()),
+			)
+			return false, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		s.logger.Error("Invalid commit task",
+			slog.String("op", op),
+			slog.String("err", err.Error()),
+		)
+		return false, err
+	}
+
+	return true, nil
+}
+
+// AppendFiles adds the files to the task. They are numbered after the last file of the task
+// keeping their order, the stored files are returned.
+func (s *Storage) AppendFiles(taskID string, files []models.File) ([]models.File, error) {
+	const op = "TaskDownloader.storage.sqlite.AppendFiles"
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var (
+		exists bool
+		last   int
+	)
+	if err := tx.QueryRow(
+		`SELECT EXISTS (SELECT 1 FROM tasks WHERE id = ?), COALESCE((SELECT MAX(idx) FROM files WHERE task_id = ?), 0)`,
+		taskID, taskID,
+	).Scan(&exists, &last); err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, fmt.Errorf("not exist task %s", taskID)
+	}
+
+	appended := make([]models.File, 0, len(files))
+	for i, file := range files {
+		file.Index = last + i + 1
+		if err := insertFile(tx, taskID, &file); err != nil {
+			s.logger.Error("Invalid insert file",
+				slog.String("op", op),
+				slog.String("err", err.Error()),
+			)
+			return nil, err
+		}
+		appended = append(appended, file)
+	}
+
+	taskStatus, err := aggregateStatus(tx, taskID)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec(`UPDATE tasks SET status = ? WHERE id = ?`, taskStatus, taskID); err != nil {
+		s.logger.Error("Invalid update task status",
+			slog.String("op", op),
+			slog.String("err", err.Error()),
+		)
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return appended, nil
+}
+
+func (s *Storage) GetTask(taskID string) (models.Task, error) {
+	const op = "TaskDownloader.storage.sqlite.GetTask"
+
+	var (
+		task      models.Task
+		createdAt string
+	)
+
+	err := s.db.QueryRow(
+		`SELECT id, client_id, status, created_at, max_bytes_per_sec, callback_url FROM tasks WHERE id = ?`, taskID,
+	).Scan(&task.ID, &task.ClientID, &task.Status, &createdAt, &task.MaxBytesPerSec, &task.CallbackURL)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Task{}, nil
+	}
+	if err != nil {
+		s.logger.Error("Invalid select task",
+			slog.String("op", op),
+			slog.String("err", err.Error()),
+		)
+		return models.Task{}, err
+	}
+
+	task.CreatedAt = parseTime(createdAt)
+
+	task.File, err = selectFiles(s.db, taskID)
+	if err != nil {
+		s.logger.Error("Invalid select files",
+			slog.String("op", op),
+			slog.String("err", err.Error()),
+		)
+		return models.Task{}, err
+	}
+
+	return task, nil
+}
+
+func (s *Storage) ListTasks(filter models.TaskFilter) (models.TaskPage, error) {
+	const op = "TaskDownloader.storage.sqlite.ListTasks"
+
+	cursor, err := pagination.Decode(filter.Cursor)
+	if err != nil {
+		return models.TaskPage{}, err
+	}
+
+	var (
+		where []string
+		args  []any
+	)
+	if filter.ClientID != "" {
+		where = append(where, `client_id = ?`)
+		args = append(args, filter.ClientID)
+	}
+	if filter.Status != "" {
+		where = append(where, `status = ?`)
+		args = append(args, filter.Status)
+	}
+	if !filter.CreatedFrom.IsZero() {
+		where = append(where, `created_at >= ?`)
+		args = append(args, formatTime(filter.CreatedFrom))
+	}
+	if !filter.CreatedTo.IsZero() {
+		where = append(where, `created_at < ?`)
+		args = append(args, formatTime(filter.CreatedTo))
+	}
+	if filter.URL != "" {
+		where = append(where, `EXISTS (SELECT 1 FROM files f WHERE f.task_id = t.id AND instr(lower(f.url), lower(?)) > 0)`)
+		args = append(args, filter.URL)
+	}
+
+	cmp, order := "<", "DESC"
+	if filter.Ascending {
+		cmp, order = ">", "ASC"
+	}
+	if filter.Cursor != "" {
+		where = append(where, `(created_at `+cmp+` ? OR (created_at = ? AND id `+cmp+` ?))`)
+		createdAt := formatTime(cursor.CreatedAt)
+		args = append(args, createdAt, createdAt, cursor.ID)
+	}
+
+	query := `SELECT id, client_id, status, created_at, max_bytes_per_sec, callback_url FROM tasks t`
+	if len(where) > 0 {
+		query += ` WHERE ` + strings.Join(where, ` AND `)
+	}
+	// one more task than asked for tells whether there is a next page
+	query += ` ORDER BY created_at ` + order + `, id ` + order + ` LIMIT ?`
+	args = append(args, pagination.Limit(filter.Limit)+1)
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		s.logger.Error("Invalid select tasks",
+			slog.String("op", op),
+			slog.String("err", err.Error()),
+		)
+		return models.TaskPage{}, err
+	}
+
+	var tasks []models.Task
+	for rows.Next() {
+		var (
+			task      models.Task
+			createdAt string
+		)
+		if err := rows.Scan(&task.ID, &task.ClientID, &task.Status, &createdAt, &task.MaxBytesPerSec, &task.CallbackURL); err != nil {
+			rows.Close()
+			return models.TaskPage{}, err
+		}
+		task.CreatedAt = parseTime(createdAt)
+		tasks = append(tasks, task)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return models.TaskPage{}, err
+	}
+
+	for i := range tasks {
+		if tasks[i].File, err = selectFiles(s.db, tasks[i].ID); err != nil {
+			s.logger.Error("Invalid select files",
+				slog.String("op", op),
+				slog.String("err", err.Error()),
+			)
+			return models.TaskPage{}, err
+		}
+	}
+
+	return pagination.Cut(tasks, filter.Limit), nil
+}
+
+func (s *Storage) SaveFile(taskID string, file *models.File) (success bool, err error) {
+	const op = "TaskDownloader.storage.sqlite.SaveFile"
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	now := formatTime(time.Now())
+
+	// started_at is set when the file moves into in_progress, not on every saved chunk
+	if file.Status == statusInProgress {
+		if _, err := tx.Exec(`UPDATE files SET started_at = ? WHERE task_id = ? AND idx = ? AND status != ?`, now, taskID, file.Index, statusInProgress); err != nil {
+			s.logger.Error("Invalid update file",
+				slog.String("op", op),
+				slog.String("err", err.Error()),
+			)
+			return false, err
+		}
+	}
+
+	if err := updateFile(tx, taskID, file); err != nil {
+		s.logger.Error("Invalid update file",
+			slog.String("op", op),
+			slog.String("err", err.Error()),
+		)
+		return false, err
+	}
+
+	if file.Status == statusDone {
+		_, err = tx.Exec(`UPDATE files SET finished_at = ? WHERE task_id = ? AND idx = ?`, now, taskID, file.Index)
+	}
+	if err != nil {
+		s.logger.Error("Invalid update file",
+			slog.String("op", op),
+			slog.String("err", err.Error()),
+		)
+		return false, err
+	}
+
+	taskStatus, err := aggregateStatus(tx, taskID)
+	if err != nil {
+		s.logger.Error("Invalid select file statuses",
+			slog.String("op", op),
+			slog.String("err", err.Error()),
+		)
+		return false, err
+	}
+
+	if _, err := tx.Exec(`UPDATE tasks SET status = ? WHERE id = ?`, taskStatus, taskID); err != nil {
+		s.logger.Error("Invalid update task status",
+			slog.String("op", op),
+			slog.String("err", err.Error()),
+		)
+		return false, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// aggregateStatus derives the status of the task from the statuses of its files.
+func aggregateStatus(tx *sql.Tx, taskID string) (string, error) {
+	rows, err := tx.Query(`SELECT status FROM files WHERE task_id = ?`, taskID)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	var files []models.File
+	for rows.Next() {
+		var file models.File
+		if err := rows.Scan(&file.Status); err != nil {
+			return "", err
+		}
+		files = append(files, file)
+	}
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+
+	return taskstatus.Aggregate(files), nil
+}
+
+func (s *Storage) GetFileById(taskID string, fileID int) (models.File, error) {
+	rows, err := s.db.Query(fileColumns+` WHERE task_id = ? AND idx = ?`, taskID, fileID)
+	if err != nil {
+		return models.File{}, err
+	}
+	defer rows.Close()
+
+	files, err := scanFiles(rows)
+	if err != nil {
+		return models.File{}, err
+	}
+
+	if len(files) == 0 {
+		return models.File{}, errors.New("not exist such file")
+	}
+
+	return files[0], nil
+}
+
+func (s *Storage) ResetToQueued() (fileMp map[string][]models.File, err error) {
+	const op = "TaskDownloader.storage.sqlite.ResetToQueued"
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(
+		`UPDATE files SET status = ?
+		WHERE status = ? AND task_id IN (SELECT id FROM tasks WHERE status != ?)`,
+		statusQueued, statusInProgress, statusCompleted,
+	); err != nil {
+		s.logger.Error("Invalid reset files",
+			slog.String("op", op),
+			slog.String("err", err.Error()),
+		)
+		return nil, err
+	}
+
+	rows, err := tx.Query(
+		`SELECT f.task_id, `+fileFields+` FROM files f
+		JOIN tasks t ON t.id = f.task_id
+		WHERE t.status != ? AND f.status = ?
+		ORDER BY f.task_id, f.idx`,
+		statusCompleted, statusQueued,
+	)
+	if err != nil {
+		s.logger.Error("Invalid select queued files",
+			slog.String("op", op),
+			slog.String("err", err.Error()),
+		)
+		return nil, err
+	}
+
+	fileMp = make(map[string][]models.File)
+	for rows.Next() {
+		var taskID string
+		file, err := scanFile(rows, &taskID)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		fileMp[taskID] = append(fileMp[taskID], file)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	if len(fileMp) == 0 {
+		return nil, nil
+	}
+
+	return fileMp, nil
+}
+
+// fileStateColumns are written by SaveFile, values come from fileState in the same order.
+var fileStateColumns = []string{
+	"status", "downloaded_bytes", "size", "segments", "etag", "last_modified",
+	"checksum_algo", "expected_checksum", "checksum", "fail_reason", "attempts", "last_error",
+	"next_attempt_at",
+}
+
+var fileFields = "f.idx, f.url, f.filename, f.started_at, f.finished_at, f." + strings.Join(fileStateColumns, ", f.")
+
+var fileColumns = `SELECT ` + fileFields + ` FROM files f`
+
+func fileState(file *models.File) ([]any, error) {
+	segments, err := encodeSegments(file.Segments)
+	if err != nil {
+		return nil, err
+	}
+
+	return []any{
+		file.Status, file.DownloadedBytes, file.Size, segments, file.ETag, file.LastModified,
+		file.ChecksumAlgo, file.ExpectedChecksum, file.Checksum, file.FailReason, file.Attempts, file.LastError,
+		formatTime(file.NextAttemptAt),
+	}, nil
+}
+
+type queryer interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func insertFile(tx *sql.Tx, taskID string, file *models.File) error {
+	state, err := fileState(file)
+	if err != nil {
+		return err
+	}
+
+	columns := append([]string{"task_id", "idx", "url", "filename", "started_at", "finished_at"}, fileStateColumns...)
+	args := append([]any{
+		taskID, file.Index, file.Url, file.Filename, formatTime(file.StartedAt), formatTime(file.FinishedAt),
+	}, state...)
+
+	_, err = tx.Exec(
+		`INSERT INTO files (`+strings.Join(columns, ", ")+`) VALUES (?`+strings.Repeat(", ?", len(columns)-1)+`)`,
+		args...,
+	)
+	return err
+}
+
+func updateFile(tx *sql.Tx, taskID string, file *models.File) error {
+	state, err := fileState(file)
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.Exec(
+		`UPDATE files SET `+strings.Join(fileStateColumns, " = ?, ")+` = ? WHERE task_id = ? AND idx = ?`,
+		append(state, taskID, file.Index)...,
+	)
+	if err != nil {
+		return err
+	}
+
+	// the json storage fails the same way
+	if rows, err := result.RowsAffected(); err != nil {
+		return err
+	} else if rows == 0 {
+		return fmt.Errorf("not exist file %d in task %s", file.Index, taskID)
+	}
+
+	return nil
+}
+
+func selectFiles(q queryer, taskID string) ([]models.File, error) {
+	rows, err := q.Query(fileColumns+` WHERE task_id = ? ORDER BY idx`, taskID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanFiles(rows)
+}
+
+func scanFiles(rows *sql.Rows) ([]models.File, error) {
+	var files []models.File
+	for rows.Next() {
+		file, err := scanFile(rows)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+
+	return files, rows.Err()
+}
+
+// scanFile reads a row produced from fileFields, prefix holds destinations of columns selected before them.
+func scanFile(row scanner, prefix ...any) (models.File, error) {
+	var (
+		file                  models.File
+		startedAt, finishedAt string
+		segments              string
+		nextAttemptAt         string
+	)
+
+	dest := append(prefix,
+		&file.Index, &file.Url, &file.Filename, &startedAt, &finishedAt,
+		&file.Status, &file.DownloadedBytes, &file.Size, &segments, &file.ETag, &file.LastModified,
+		&file.ChecksumAlgo, &file.ExpectedChecksum, &file.Checksum, &file.FailReason, &file.Attempts, &file.LastError,
+		&nextAttemptAt,
+	)
+	if err := row.Scan(dest...); err != nil {
+		return models.File{}, err
+	}
+
+	if segments != "" {
+		if err := json.Unmarshal([]byte(segments), &file.Segments); err != nil {
+			return models.File{}, err
+		}
+	}
+
+	file.StartedAt = parseTime(startedAt)
+	file.FinishedAt = parseTime(finishedAt)
+	file.NextAttemptAt = parseTime(nextAttemptAt)
+
+	return file, nil
+}
+
+// encodeSegments stores segments as a JSON column, they are always read and written with their file.
+func encodeSegments(segments []models.Segment) (string, error) {
+	if len(segments) == 0 {
+		return "", nil
+	}
+
+	b, err := json.Marshal(segments)
+	if err != nil {
+		return "", err
+	}
+
+	return string(b), nil
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(timeLayout)
+}
+
+func parseTime(s string) time.Time {
+	t, err := time.Parse(timeLayout, s)
+	if err != nil {
+		return time.Time{}
+	}
+
+	if t.IsZero() {
+		return time.Time{}
+	}
+
+	return t.Local()
+}
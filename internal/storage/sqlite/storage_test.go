@@ -0,0 +1,305 @@
+package sqlite
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	converttotask "github.com/LashkaPashka/TaskDownloader/internal/lib/convertToTask"
+	"github.com/LashkaPashka/TaskDownloader/internal/lib/pagination"
+	"github.com/LashkaPashka/TaskDownloader/internal/lib/taskstatus"
+	"github.com/LashkaPashka/TaskDownloader/internal/models"
+	"github.com/LashkaPashka/TaskDownloader/internal/payload"
+)
+
+var logger = slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+var st *Storage
+
+var body = payload.SaveTaskRequest{
+	Urls: []payload.FileRequest{
+		{Url: "https://getsamplefiles.com/download/zip/sample-1.zip"},
+		{Url: "https://getsamplefiles.com/download/zip/sample-4.zip"},
+	},
+	ClientID: "3f3f32f2",
+	CallbackURL: "https://example.com/hooks/downloads",
+}
+
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "sqlite-storage")
+	if err != nil {
+		panic(err)
+	}
+
+	st, err = New(filepath.Join(dir, "tasks.db"), logger)
+	if err != nil {
+		panic(err)
+	}
+
+	code := m.Run()
+
+	st.Close()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+func TestSaveAndGetTask(t *testing.T) {
+	task := converttotask.Convert(&body)
+
+	if _, err := st.SaveTask(task); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	got, err := st.GetTask(task.ID)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	if got.ID != task.ID || got.ClientID != task.ClientID || got.CallbackURL != task.CallbackURL || len(got.File) != len(task.File) {
+		t.Fatalf("Error: got %+v, want %+v", got, task)
+	}
+
+	if !got.CreatedAt.Equal(task.CreatedAt) {
+		t.Fatalf("Error: created_at %v, want %v", got.CreatedAt, task.CreatedAt)
+	}
+}
+
+func TestGetMissingTask(t *testing.T) {
+	task, err := st.GetTask("task_missing")
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	if task.ID != "" {
+		t.Fatalf("Error: expected empty task, got %+v", task)
+	}
+}
+
+func TestSaveFile(t *testing.T) {
+	task := converttotask.Convert(&body)
+	if _, err := st.SaveTask(task); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	file := task.File[0]
+	file.Status = statusInProgress
+	file.DownloadedBytes = 1024
+	file.Size = 4096
+	file.NextAttemptAt = time.Now().Add(time.Minute)
+
+	if _, err := st.SaveFile(task.ID, &file); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	got, err := st.GetFileById(task.ID, file.Index)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	if got.DownloadedBytes != 1024 || got.Size != 4096 || got.Status != statusInProgress || got.StartedAt.IsZero() ||
+		!got.NextAttemptAt.Equal(file.NextAttemptAt) {
+		t.Fatalf("Error: unexpected file %+v", got)
+	}
+
+	saved, _ := st.GetTask(task.ID)
+	if saved.Status != taskstatus.Running {
+		t.Fatalf("Error: task status %s, want %s", saved.Status, taskstatus.Running)
+	}
+
+	if _, err := st.GetFileById(task.ID, 100); err == nil {
+		t.Fatalf("Error: expected error for missing file")
+	}
+
+	missing := models.File{Index: 100, Status: statusInProgress}
+	if success, err := st.SaveFile(task.ID, &missing); err == nil || success {
+		t.Fatalf("Error: saved a missing file")
+	}
+	if success, err := st.SaveFile("task_missing", &file); err == nil || success {
+		t.Fatalf("Error: saved a file of a missing task")
+	}
+}
+
+func TestStartedAtIsKeptBetweenChunks(t *testing.T) {
+	task := converttotask.Convert(&body)
+	if _, err := st.SaveTask(task); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	file := task.File[0]
+	file.Status = statusInProgress
+	file.DownloadedBytes = 1024
+	if _, err := st.SaveFile(task.ID, &file); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	first, _ := st.GetFileById(task.ID, file.Index)
+
+	time.Sleep(10 * time.Millisecond)
+	file.DownloadedBytes = 2048
+	if _, err := st.SaveFile(task.ID, &file); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	second, _ := st.GetFileById(task.ID, file.Index)
+
+	if first.StartedAt.IsZero() || !second.StartedAt.Equal(first.StartedAt) || second.DownloadedBytes != 2048 {
+		t.Fatalf("Error: started_at moved from %v to %v", first.StartedAt, second.StartedAt)
+	}
+}
+
+func TestResetToQueued(t *testing.T) {
+	task := converttotask.Convert(&body)
+	if _, err := st.SaveTask(task); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	file := task.File[1]
+	file.Status = statusInProgress
+	if _, err := st.SaveFile(task.ID, &file); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	fileMp, err := st.ResetToQueued()
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	if len(fileMp[task.ID]) != len(task.File) {
+		t.Fatalf("Error: got %d queued files, want %d", len(fileMp[task.ID]), len(task.File))
+	}
+
+	for _, f := range fileMp[task.ID] {
+		if f.Status != statusQueued {
+			t.Fatalf("Error: file %d has status %s", f.Index, f.Status)
+		}
+	}
+}
+
+func TestPausedFileIsNotReset(t *testing.T) {
+	task := converttotask.Convert(&body)
+	if _, err := st.SaveTask(task); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	done, paused := task.File[0], task.File[1]
+	done.Status = statusDone
+	paused.Status = "paused"
+
+	if _, err := st.SaveFile(task.ID, &done); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	// one of two files done does not complete the task
+	if saved, _ := st.GetTask(task.ID); saved.Status != taskstatus.Running {
+		t.Fatalf("Error: task status %s, want %s", saved.Status, taskstatus.Running)
+	}
+
+	if _, err := st.SaveFile(task.ID, &paused); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if saved, _ := st.GetTask(task.ID); saved.Status != taskstatus.Paused {
+		t.Fatalf("Error: task status %s, want %s", saved.Status, taskstatus.Paused)
+	}
+
+	fileMp, err := st.ResetToQueued()
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if files := fileMp[task.ID]; len(files) != 0 {
+		t.Fatalf("Error: paused task was queued again: %+v", files)
+	}
+}
+
+func TestAppendFiles(t *testing.T) {
+	task := converttotask.Convert(&body)
+	if _, err := st.SaveTask(task); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	for i := range task.File {
+		task.File[i].Status = statusDone
+		if _, err := st.SaveFile(task.ID, &task.File[i]); err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+	}
+
+	files := converttotask.ConvertFiles([]payload.FileRequest{{Url: "https://example.com/c.zip"}}, 1)
+	appended, err := st.AppendFiles(task.ID, files)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if len(appended) != 1 || appended[0].Index != 3 {
+		t.Fatalf("Error: unexpected appended files %+v", appended)
+	}
+
+	// the completed task is reopened
+	got, _ := st.GetTask(task.ID)
+	if len(got.File) != 3 || got.File[2].Url != "https://example.com/c.zip" || got.Status != taskstatus.Running {
+		t.Fatalf("Error: unexpected task %+v", got)
+	}
+
+	if _, err := st.AppendFiles("task_missing", files); err == nil {
+		t.Fatalf("Error: expected error for missing task")
+	}
+}
+
+func TestListTasks(t *testing.T) {
+	base := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for i := 0; i < 5; i++ {
+		task := converttotask.Convert(&payload.SaveTaskRequest{
+			Urls:     []payload.FileRequest{{Url: fmt.Sprintf("https://example.com/List_%d.zip", i)}},
+			ClientID: "list_client",
+		})
+		task.CreatedAt = base.Add(time.Duration(i) * time.Minute)
+		if _, err := st.SaveTask(task); err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+	}
+
+	filter := models.TaskFilter{ClientID: "list_client", Limit: 2, Ascending: true}
+
+	var created []time.Time
+	for {
+		page, err := st.ListTasks(filter)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		for _, task := range page.Tasks {
+			if len(task.File) != 1 {
+				t.Fatalf("Error: task %s listed without its files", task.ID)
+			}
+			created = append(created, task.CreatedAt)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		filter.Cursor = page.NextCursor
+	}
+
+	if len(created) != 5 {
+		t.Fatalf("Error: listed %d tasks, want 5", len(created))
+	}
+	for i := range created {
+		if !created[i].Equal(base.Add(time.Duration(i) * time.Minute)) {
+			t.Fatalf("Error: tasks are not sorted: %v", created)
+		}
+	}
+
+	page, err := st.ListTasks(models.TaskFilter{
+		ClientID:    "list_client",
+		URL:         "list_3",
+		CreatedFrom: base,
+		CreatedTo:   base.Add(time.Hour),
+	})
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if len(page.Tasks) != 1 || page.Tasks[0].File[0].Url != "https://example.com/List_3.zip" {
+		t.Fatalf("Error: unexpected page %+v", page.Tasks)
+	}
+
+	if _, err := st.ListTasks(models.TaskFilter{Cursor: "%%%"}); !errors.Is(err, pagination.ErrInvalidCursor) {
+		t.Fatalf("Error: got %v, want %v", err, pagination.ErrInvalidCursor)
+	}
+}